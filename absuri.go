@@ -0,0 +1,228 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	URN_SCHEME  = "urn"
+	IM_SCHEME   = "im"
+	PRES_SCHEME = "pres"
+	// URN_NID_SERVICE is the namespace of the RFC 5031 service urns
+	// (i.e. urn:service:sos)
+	URN_NID_SERVICE = "service"
+)
+
+// absUriSchemes are the schemes of absolute uris that are seen in
+// SIP msgs (i.e. in Call-Info, Alert-Info, Error-Info or
+// Geolocation).  Any other scheme is only treated as an absolute uri
+// if what follows it could not be the userinfo or port of a uri
+// without a scheme.
+var absUriSchemes = map[string]bool{
+	"cid":    true,
+	"data":   true,
+	"file":   true,
+	"ftp":    true,
+	"http":   true,
+	"https":  true,
+	"ldap":   true,
+	"mailto": true,
+	"mid":    true,
+	"ws":     true,
+	"wss":    true,
+	"xmpp":   true,
+}
+
+// isScheme returns true if s matches the RFC 3986 scheme rule
+// (ALPHA *( ALPHA / DIGIT / "+" / "-" / "." ))
+func isScheme(s string) bool {
+	if s == "" || !((s[0] >= 'a' && s[0] <= 'z') || (s[0] >= 'A' && s[0] <= 'Z')) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// URN is a parsed RFC 8141 urn (i.e. urn:service:sos).  It is in
+// URI.URN when the scheme of a URI is urn.
+// The fields are as follows:
+// -- NID is the lower case namespace identifier (i.e. "service")
+// -- NSS is the namespace specific string (i.e. "sos.fire")
+type URN struct {
+	NID string
+	NSS string
+}
+
+// ParseURN parses a urn with or without the "urn:" scheme
+func ParseURN(s string) (*URN, error) {
+	if len(s) > 4 && strings.EqualFold(s[0:4], URN_SCHEME+":") {
+		s = s[4:]
+	}
+	colon := strings.IndexByte(s, ':')
+	if colon < 1 || colon == len(s)-1 {
+		return nil, fmt.Errorf("%w: ParseURN err: no NID or NSS found in: %s", ErrBadURI, s)
+	}
+	n := &URN{NID: strings.ToLower(s[0:colon]), NSS: s[colon+1:]}
+	for i := 0; i < len(n.NID); i++ {
+		if !isTokenChar(n.NID[i]) {
+			return nil, fmt.Errorf("%w: ParseURN err: invalid NID in: %s", ErrBadURI, s)
+		}
+	}
+	return n, nil
+}
+
+// String returns the urn rendered from its fields
+func (n *URN) String() string {
+	return URN_SCHEME + ":" + n.NID + ":" + n.NSS
+}
+
+// Service returns the service (i.e. "sos.fire") of an RFC 5031
+// service urn or "" if the urn is not a service urn
+func (n *URN) Service() string {
+	if n.NID != URN_NID_SERVICE {
+		return ""
+	}
+	return strings.ToLower(n.NSS)
+}
+
+// IsEmergency returns true if the urn is an RFC 5031 emergency
+// service urn (urn:service:sos or one of its sub-services)
+func (n *URN) IsEmergency() bool {
+	s := n.Service()
+	return s == "sos" || strings.HasPrefix(s, "sos.")
+}
+
+// Equal returns true if n and o are the same urn.  The NID is not case
+// sensitive and neither is the NSS of a service urn (RFC 5031 4.2).
+func (n *URN) Equal(o *URN) bool {
+	if n == nil || o == nil {
+		return n == o
+	}
+	if n.NID != o.NID {
+		return false
+	}
+	if n.NID == URN_NID_SERVICE {
+		return strings.EqualFold(n.NSS, o.NSS)
+	}
+	return n.NSS == o.NSS
+}
+
+// parseUriUrn parses the rest of a urn into .URN
+func parseUriUrn(u *URI) uriStateFn {
+	u.URN, u.Error = ParseURN(u.rest)
+	u.rest = ""
+	return nil
+}
+
+// parseUriAbs parses the rest of an RFC 3986 absolute uri.  If it has
+// an authority (i.e. http://host/path) the authority goes into the
+// .UserInfo, .User, .Host and .Port and the rest into .Path, .Query
+// and .Fragment.  Otherwise (i.e. cid:foo@bar) everything before the
+// fragment is in .Opaque.
+func parseUriAbs(u *URI) uriStateFn {
+	if hash := strings.IndexByte(u.rest, '#'); hash != -1 {
+		u.Fragment = u.rest[hash+1:]
+		u.rest = u.rest[0:hash]
+	}
+	if !strings.HasPrefix(u.rest, "//") {
+		u.Opaque = u.rest
+		if u.Opaque == "" {
+			u.Error = fmt.Errorf("%w: parseUriAbs err: nothing after the scheme in: %s", ErrBadURI, u.Raw)
+		}
+		u.rest = ""
+		return nil
+	}
+	u.rest = u.rest[2:]
+	end := strings.IndexAny(u.rest, "/?")
+	if end == -1 {
+		end = len(u.rest)
+	}
+	authority := u.rest[0:end]
+	u.rest = u.rest[end:]
+	if q := strings.IndexByte(u.rest, '?'); q != -1 {
+		u.Query = u.rest[q+1:]
+		u.rest = u.rest[0:q]
+	}
+	u.Path = u.rest
+	u.rest = ""
+	if at := strings.LastIndexByte(authority, '@'); at != -1 {
+		u.UserInfo = authority[0:at]
+		u.User = u.UserInfo
+		if colon := strings.IndexByte(u.UserInfo, ':'); colon != -1 {
+			u.User, u.UserPassword = u.UserInfo[0:colon], u.UserInfo[colon+1:]
+		}
+		authority = authority[at+1:]
+	}
+	u.HostInfo = authority
+	hostEnd := len(authority)
+	switch {
+	case strings.HasPrefix(authority, "["):
+		hostEnd = strings.IndexByte(authority, ']') + 1
+		if hostEnd == 0 {
+			u.Error = fmt.Errorf("%w: parseUriAbs err: no closing brack on IPv6 reference in: %s", ErrBadURI, u.Raw)
+			return nil
+		}
+	case strings.IndexByte(authority, ':') != -1:
+		hostEnd = strings.IndexByte(authority, ':')
+	}
+	u.Host = authority[0:hostEnd]
+	if hostEnd < len(authority) {
+		u.Port = authority[hostEnd+1:]
+		if u.Port != "" && !isDigits(u.Port) {
+			u.Error = fmt.Errorf("%w: parseUriAbs err: invalid port in: %s", ErrBadURI, u.Raw)
+		}
+	}
+	return nil
+}
+
+// isAbs returns true if the uri is an absolute uri with a scheme
+// other than sip, sips, tel, urn, im or pres
+func (u *URI) isAbs() bool {
+	switch u.Scheme {
+	case "", SIP_SCHEME, SIPS_SCHEME, TEL_SCHEME, URN_SCHEME, IM_SCHEME, PRES_SCHEME:
+		return false
+	}
+	return true
+}
+
+// absString renders an absolute uri (one that is not sip, sips, tel,
+// im or pres) from its fields
+func (u *URI) absString() string {
+	str := u.Scheme + ":"
+	switch {
+	case u.Opaque != "":
+		str += u.Opaque
+	default:
+		str += "//"
+		if u.User != "" {
+			str += u.User
+			if u.UserPassword != "" {
+				str += ":" + u.UserPassword
+			}
+			str += "@"
+		}
+		str += u.Host
+		if u.Port != "" {
+			str += ":" + u.Port
+		}
+		str += u.Path
+		if u.Query != "" {
+			str += "?" + u.Query
+		}
+	}
+	if u.Fragment != "" {
+		str += "#" + u.Fragment
+	}
+	return str
+}
@@ -0,0 +1,96 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestAbsURI(t *testing.T) {
+	u := ParseURI("http://user:pw@[2001:db8::1]:8080/a/b.png?x=1&y=2#top")
+	if u.Error != nil {
+		t.Fatalf("[TestAbsURI] Error parsing http uri.  Received: %s", u.Error.Error())
+	}
+	if u.Scheme != "http" || u.User != "user" || u.UserPassword != "pw" || u.Host != "[2001:db8::1]" || u.Port != "8080" {
+		t.Errorf("[TestAbsURI] Authority was not parsed correctly.")
+	}
+	if u.Path != "/a/b.png" || u.Query != "x=1&y=2" || u.Fragment != "top" || u.Opaque != "" {
+		t.Errorf("[TestAbsURI] Path, query or fragment was not parsed correctly.")
+	}
+	if u.String() != "http://user:pw@[2001:db8::1]:8080/a/b.png?x=1&y=2#top" {
+		t.Errorf("[TestAbsURI] Http uri did not render correctly.  Received: %q", u.String())
+	}
+	u = ParseURI("cid:target123@atlanta.example.com")
+	if u.Error != nil || u.Scheme != "cid" || u.Opaque != "target123@atlanta.example.com" || u.Host != "" {
+		t.Errorf("[TestAbsURI] Cid uri was not parsed correctly.")
+	}
+	if u.String() != "cid:target123@atlanta.example.com" {
+		t.Errorf("[TestAbsURI] Cid uri did not render correctly.  Received: %q", u.String())
+	}
+	u = ParseURI("MAILTO:alice@atlanta.com")
+	if u.Error != nil || u.Scheme != "mailto" || u.Opaque != "alice@atlanta.com" {
+		t.Errorf("[TestAbsURI] Mailto uri was not parsed correctly.")
+	}
+	if ParseURI("http:").Error == nil {
+		t.Errorf("[TestAbsURI] An absolute uri with nothing after the scheme should be an error.")
+	}
+	if ParseURI("http://host:80x/").Error == nil {
+		t.Errorf("[TestAbsURI] An absolute uri with an invalid port should be an error.")
+	}
+	if !ParseURI("http://a.com/x").Equal(ParseURI("HTTP://A.COM/x")) || ParseURI("http://a.com/x").Equal(ParseURI("http://a.com/y")) {
+		t.Errorf("[TestAbsURI] Equal did not compare absolute uris correctly.")
+	}
+	// without a scheme these still parse as before
+	u = ParseURI("alice:secret@atlanta.com")
+	if u.Error != nil || u.Scheme != "" || u.User != "alice" || u.UserPassword != "secret" || u.Host != "atlanta.com" {
+		t.Errorf("[TestAbsURI] Uri with a password and no scheme was not parsed correctly.")
+	}
+	u = ParseURI("example.com:5060")
+	if u.Error != nil || u.Scheme != "" || u.Host != "example.com" || u.Port != "5060" {
+		t.Errorf("[TestAbsURI] Host and port with no scheme was not parsed correctly.")
+	}
+}
+
+func TestURN(t *testing.T) {
+	u := ParseURI("URN:Service:SOS.fire")
+	if u.Error != nil {
+		t.Fatalf("[TestURN] Error parsing urn.  Received: %s", u.Error.Error())
+	}
+	if u.Scheme != URN_SCHEME || u.URN == nil || u.URN.NID != "service" || u.URN.NSS != "SOS.fire" {
+		t.Fatalf("[TestURN] Urn was not parsed correctly.")
+	}
+	if u.URN.Service() != "sos.fire" || !u.URN.IsEmergency() {
+		t.Errorf("[TestURN] Urn should be the sos.fire emergency service.")
+	}
+	if u.String() != "urn:service:SOS.fire" {
+		t.Errorf("[TestURN] Urn did not render correctly.  Received: %q", u.String())
+	}
+	if !u.Equal(ParseURI("urn:service:sos.fire")) || u.Equal(ParseURI("urn:service:sos")) {
+		t.Errorf("[TestURN] Equal did not compare service urns correctly.")
+	}
+	n, err := ParseURN("urn:service:counseling")
+	if err != nil || n.Service() != "counseling" || n.IsEmergency() {
+		t.Errorf("[TestURN] Counseling urn should not be an emergency service.")
+	}
+	if _, err := ParseURN("urn:service"); err == nil {
+		t.Errorf("[TestURN] Urn with no NSS should be an error.")
+	}
+}
+
+func TestImPresURI(t *testing.T) {
+	for _, s := range []string{"im:alice@atlanta.com", "pres:alice@atlanta.com"} {
+		u := ParseURI(s)
+		if u.Error != nil || u.User != "alice" || u.Host != "atlanta.com" {
+			t.Errorf("[TestImPresURI] %q was not parsed correctly.", s)
+		}
+		if u.String() != s {
+			t.Errorf("[TestImPresURI] %q did not render correctly.  Received: %q", s, u.String())
+		}
+	}
+	if ParseURI("im:alice@atlanta.com").Scheme != IM_SCHEME || ParseURI("PRES:alice@atlanta.com").Scheme != PRES_SCHEME {
+		t.Errorf("[TestImPresURI] The scheme was not recorded correctly.")
+	}
+}
@@ -43,12 +43,20 @@ func (a *Accept) addParam(s string) {
 // parse just gets a comma seperated list of the parameters from 
 // the .Val and calls addparam on each of the parameters
 func (a *Accept) parse() {
-	cs := getCommaSeperated(a.Val)
-	if cs == nil {
-		a.addParam(a.Val)
-		return
-	}
+	cs := splitList(a.Val, ',')
 	for i := range cs {
 		a.addParam(cs[i])
 	}
 }
+
+// String returns the accept params joined as a comma seperated list
+func (a *Accept) String() string {
+	str := ""
+	for i := range a.Params {
+		if i != 0 {
+			str += ", "
+		}
+		str += a.Params[i].Type + "/" + a.Params[i].Val
+	}
+	return str
+}
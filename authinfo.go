@@ -0,0 +1,89 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strings"
+)
+
+// AuthenticationInfo is a parsed Authentication-Info hdr (RFC 3261
+// 20.6 and RFC 2617 3.2.3) that a server sends back after it has
+// accepted digest credentials.
+// The fields are as follows:
+// -- Val is the raw value
+// -- NextNonce is the nonce that the client should use next
+// -- Qop, CNonce and NC echo the credentials that were accepted
+// -- RspAuth is the response auth that proves that the server knows
+// the secret of the user too
+// -- Params are any other params
+type AuthenticationInfo struct {
+	Val       string
+	NextNonce string
+	Qop       string
+	RspAuth   string
+	CNonce    string
+	NC        string
+	Params    []*Param
+}
+
+// parse parses .Val into the typed fields
+func (a *AuthenticationInfo) parse() error {
+	parts := splitList(a.Val, ',')
+	if len(parts) == 0 {
+		return fmt.Errorf("%w: AuthenticationInfo.parse err: no params found.", ErrBadAuthenticationInfo)
+	}
+	for i := range parts {
+		p := getParam(parts[i])
+		if p.Param == "" {
+			return fmt.Errorf("%w: AuthenticationInfo.parse err: invalid param: %s", ErrBadAuthenticationInfo, parts[i])
+		}
+		p.Val = unquoteStr(p.Val)
+		switch strings.ToLower(p.Param) {
+		case "nextnonce":
+			a.NextNonce = p.Val
+		case "qop":
+			a.Qop = p.Val
+		case "rspauth":
+			a.RspAuth = p.Val
+		case "cnonce":
+			a.CNonce = p.Val
+		case "nc":
+			a.NC = p.Val
+		default:
+			a.Params = append(a.Params, p)
+		}
+	}
+	return nil
+}
+
+// String returns the hdr rendered from its fields
+func (a *AuthenticationInfo) String() string {
+	parts := make([]string, 0, 5+len(a.Params))
+	if a.NextNonce != "" {
+		parts = append(parts, "nextnonce="+quoteStr(a.NextNonce))
+	}
+	if a.Qop != "" {
+		parts = append(parts, "qop="+a.Qop)
+	}
+	if a.RspAuth != "" {
+		parts = append(parts, "rspauth="+quoteStr(a.RspAuth))
+	}
+	if a.CNonce != "" {
+		parts = append(parts, "cnonce="+quoteStr(a.CNonce))
+	}
+	if a.NC != "" {
+		parts = append(parts, "nc="+a.NC)
+	}
+	for i := range a.Params {
+		if authQuotedParams[a.Params[i].Param] {
+			parts = append(parts, a.Params[i].Param+"="+quoteStr(a.Params[i].Val))
+			continue
+		}
+		parts = append(parts, a.Params[i].String())
+	}
+	return strings.Join(parts, ", ")
+}
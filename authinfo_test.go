@@ -0,0 +1,43 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuthenticationInfo(t *testing.T) {
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bKnashds7\r\n" +
+		"From: <sip:bob@atlanta.com>;tag=456248\r\n" +
+		"To: <sip:bob@atlanta.com>;tag=2493k59kd\r\n" +
+		"Call-ID: 843817637684230@998sdasdh09\r\n" +
+		"CSeq: 2 REGISTER\r\n" +
+		"Authentication-Info: nextnonce=\"47364c23432d2e131a5fb210812c\", qop=auth, rspauth=\"6629fae49393a05397450978507c4ef1\", cnonce=\"0a4f113b\", nc=00000001, foo=bar\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	for _, lazy := range []bool{false, true} {
+		s := ParseMsgWithOptions(msg, ParseOptions{Lazy: lazy})
+		if s.Error != nil {
+			t.Fatalf("[TestAuthenticationInfo] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		a := s.GetAuthenticationInfo()
+		if a == nil || a.NextNonce != "47364c23432d2e131a5fb210812c" || a.Qop != "auth" || a.RspAuth != "6629fae49393a05397450978507c4ef1" || a.CNonce != "0a4f113b" || a.NC != "00000001" || len(a.Params) != 1 {
+			t.Errorf("[TestAuthenticationInfo] Authentication-Info was not parsed correctly.  Received: %v", a)
+		}
+	}
+	a := &AuthenticationInfo{NextNonce: "abc", Qop: "auth", RspAuth: "def", CNonce: "x", NC: "00000002"}
+	if str := a.String(); str != `nextnonce="abc", qop=auth, rspauth="def", cnonce="x", nc=00000002` {
+		t.Errorf("[TestAuthenticationInfo] String is wrong.  Received: %s", str)
+	}
+	if str := (&AuthenticationInfo{NextNonce: "abc"}).String(); str != `nextnonce="abc"` {
+		t.Errorf("[TestAuthenticationInfo] String is wrong.  Received: %s", str)
+	}
+	bad := &AuthenticationInfo{Val: " , "}
+	if err := bad.parse(); !errors.Is(err, ErrBadAuthenticationInfo) {
+		t.Errorf("[TestAuthenticationInfo] An empty hdr should be an ErrBadAuthenticationInfo.")
+	}
+}
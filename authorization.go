@@ -6,14 +6,54 @@ package sipparser
 
 // Imports from go standard library
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
+// authQuotedParams are the auth params that are rendered as a
+// quoted-string even if they were not set with .Quoted
+var authQuotedParams = map[string]bool{
+	"username":  true,
+	"realm":     true,
+	"nonce":     true,
+	"uri":       true,
+	"response":  true,
+	"cnonce":    true,
+	"opaque":    true,
+	"domain":    true,
+	"nextnonce": true,
+	"rspauth":   true,
+}
+
+// Authorization is the value of an Authorization or
+// Proxy-Authorization hdr (credentials) or of a WWW-Authenticate or
+// Proxy-Authenticate hdr (a challenge).  .Params is what gets
+// rendered (in order and quoted the way they were received).  The
+// typed fields are filled from .Params by parse and SetParam.
+// The fields are as follows:
+// -- Val is the raw value
+// -- Credentials is the auth scheme (i.e. Digest)
+// -- Params are all of the params with the values unquoted
+// -- Username, Realm, Nonce, URI, Response, Algorithm, CNonce, NC
+// and Opaque are the values of the digest params
+// -- Qop is the qop options of a challenge or the qop of credentials
+// (a list of one)
+// -- Stale is true for a challenge with stale=true
 type Authorization struct {
 	Val         string   "val"
 	Credentials string   "credentials"
 	Params      []*Param "params"
+	Username    string
+	Realm       string
+	Nonce       string
+	URI         string
+	Response    string
+	Algorithm   string
+	CNonce      string
+	NC          string
+	Opaque      string
+	Qop         []string
+	Stale       bool
 }
 
 func (a *Authorization) GetParam(param string) *Param {
@@ -28,19 +68,195 @@ func (a *Authorization) GetParam(param string) *Param {
 	return nil
 }
 
+// SetParam sets the value of the param (adding it if it is not
+// there) and updates the typed fields
+func (a *Authorization) SetParam(param string, val string) {
+	if p := a.GetParam(param); p != nil {
+		p.Val = val
+	} else {
+		a.Params = append(a.Params, &Param{Param: param, Val: val})
+	}
+	a.setFields()
+}
+
+// setFields fills the typed fields from .Params
+func (a *Authorization) setFields() {
+	a.Username, a.Realm, a.Nonce, a.URI, a.Response = "", "", "", "", ""
+	a.Algorithm, a.CNonce, a.NC, a.Opaque = "", "", "", ""
+	a.Qop, a.Stale = nil, false
+	for _, p := range a.Params {
+		switch strings.ToLower(p.Param) {
+		case "username":
+			a.Username = p.Val
+		case "realm":
+			a.Realm = p.Val
+		case "nonce":
+			a.Nonce = p.Val
+		case "uri":
+			a.URI = p.Val
+		case "response":
+			a.Response = p.Val
+		case "algorithm":
+			a.Algorithm = p.Val
+		case "cnonce":
+			a.CNonce = p.Val
+		case "nc":
+			a.NC = p.Val
+		case "opaque":
+			a.Opaque = p.Val
+		case "qop":
+			a.Qop = splitList(p.Val, ',')
+		case "stale":
+			a.Stale = strings.EqualFold(p.Val, "true")
+		}
+	}
+}
+
 func (a *Authorization) parse() error {
 	pos := strings.IndexRune(a.Val, ' ')
 	if pos == -1 {
-		return errors.New("Authorization.parse err: no LWS found.")
+		return fmt.Errorf("%w: Authorization.parse err: no LWS found.", ErrBadAuthorization)
 	}
 	a.Credentials = a.Val[0:pos]
 	if len(a.Val)-1 <= pos {
-		return errors.New("Authorization.parse err: no digest-resp found.")
+		return fmt.Errorf("%w: Authorization.parse err: no digest-resp found.", ErrBadAuthorization)
 	}
 	a.Params = make([]*Param, 0)
-	parts := strings.Split(a.Val[pos+1:], ",")
+	parts := splitList(a.Val[pos+1:], ',')
 	for i := range parts {
-		a.Params = append(a.Params, getParam(strings.Replace(parts[i], "\"", "", -1)))
+		p := getParam(parts[i])
+		if isQuotedString(p.Val) {
+			p.Val, p.Quoted = unquoteStr(p.Val), true
+		}
+		a.Params = append(a.Params, p)
 	}
+	a.setFields()
 	return nil
 }
+
+// String returns the hdr rendered from its credentials and params
+func (a *Authorization) String() string {
+	str := a.Credentials
+	for i := range a.Params {
+		switch {
+		case i == 0:
+			str += " "
+		default:
+			str += ", "
+		}
+		if a.Params[i].Quoted || authQuotedParams[strings.ToLower(a.Params[i].Param)] {
+			str += a.Params[i].Param + "=" + quoteStr(a.Params[i].Val)
+			continue
+		}
+		str += a.Params[i].String()
+	}
+	return str
+}
+
+// isAuthStart returns true if the list item s starts a new challenge
+// or credentials (i.e. "Digest realm=x") rather than being another
+// param of the one before it (i.e. "nonce=y")
+func isAuthStart(s string) bool {
+	i := strings.IndexAny(s, " \t")
+	if i == -1 || strings.IndexByte(s[0:i], '=') != -1 {
+		return false
+	}
+	rest := trimLWS(s[i:])
+	return rest != "" && rest[0] != '='
+}
+
+// splitAuths splits the value of an auth hdr into the challenges or
+// credentials in it.  More than one can be sent in a single hdr
+// separated by commas (RFC 7235 4.1) just like any other list.
+func splitAuths(s string) []string {
+	parts := splitList(s, ',')
+	auths := make([]string, 0, 1)
+	for i := range parts {
+		if len(auths) == 0 || isAuthStart(parts[i]) {
+			auths = append(auths, parts[i])
+			continue
+		}
+		auths[len(auths)-1] += ", " + parts[i]
+	}
+	if len(auths) == 0 {
+		// so that the empty value gets an error from parse
+		auths = append(auths, s)
+	}
+	return auths
+}
+
+// parseAuths parses every challenge or credentials in the value of
+// the auth hdr
+func (s *SipMsg) parseAuths(hdr string, str string) []*Authorization {
+	vals := splitAuths(str)
+	l := make([]*Authorization, len(vals))
+	for i := range vals {
+		l[i] = &Authorization{Val: vals[i]}
+		s.hdrErr(hdr, l[i].parse())
+	}
+	return l
+}
+
+// authValues returns the values of an auth hdr from the single field
+// (last) for the hdr and the list of every value (l).  The single
+// field is the last of the list (like it was before the list was
+// kept) unless it was set by hand (in which case it replaces the
+// list) or set to nil (which removes the hdr).
+func authValues(last *Authorization, l []*Authorization) []*Authorization {
+	switch {
+	case last == nil:
+		return nil
+	case len(l) == 0 || l[len(l)-1] != last:
+		return []*Authorization{last}
+	}
+	return l
+}
+
+// clone returns a copy of a that does not share its params
+func (a *Authorization) clone() *Authorization {
+	if a == nil {
+		return nil
+	}
+	n := *a
+	n.Params = cloneParams(a.Params)
+	if a.Qop != nil {
+		n.Qop = append([]string(nil), a.Qop...)
+	}
+	return &n
+}
+
+// cloneAuths returns a copy of every value in l (nil if l is empty)
+func cloneAuths(l []*Authorization) []*Authorization {
+	if len(l) == 0 {
+		return nil
+	}
+	n := make([]*Authorization, len(l))
+	for i := range l {
+		n[i] = l[i].clone()
+	}
+	return n
+}
+
+// authList returns the values of the auth hdr (see authValues)
+func (s *SipMsg) authList(hdr string) []*Authorization {
+	switch hdr {
+	case SIP_HDR_AUTHORIZATION:
+		return authValues(s.Authorization, s.Authorizations)
+	case SIP_HDR_PROXY_AUTHENTICATE:
+		return authValues(s.ProxyAuthenticate, s.ProxyAuthenticates)
+	case SIP_HDR_PROXY_AutHORIZATION:
+		return authValues(s.ProxyAuthorization, s.ProxyAuthorizations)
+	case SIP_HDR_WWW_AUTHENTICATE:
+		return authValues(s.WWWAuthenticate, s.WWWAuthenticates)
+	}
+	return nil
+}
+
+// isAuthHdr returns true for the hdrs that hold an *Authorization
+func isAuthHdr(hdr string) bool {
+	switch hdr {
+	case SIP_HDR_AUTHORIZATION, SIP_HDR_PROXY_AUTHENTICATE, SIP_HDR_PROXY_AutHORIZATION, SIP_HDR_WWW_AUTHENTICATE:
+		return true
+	}
+	return false
+}
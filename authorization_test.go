@@ -2,6 +2,7 @@ package sipparser
 
 // Imports from go standard library
 import (
+	"strings"
 	"testing"
 )
 
@@ -19,3 +20,140 @@ func TestAuthorization(t *testing.T) {
 		t.Errorf("[TestAuthorization] Err parsing authorization hdr.  Called a.GetParam(\"realm\") and did not get \"FOOBAR\".  rcvd: " + a.GetParam("realm").Val)
 	}
 }
+
+func TestAuthorizationString(t *testing.T) {
+	val := "Digest username=\"foo\", realm=\"FOOBAR\", algorithm=MD5, uri=\"sip:foo.bar.com\", nonce=\"4f6d7a1d\", response=\"6a79a5c7\""
+	a := &Authorization{Val: val}
+	a.parse()
+	if a.String() != val {
+		t.Errorf("[TestAuthorizationString] Error rendering authorization hdr.  Received: %q", a.String())
+	}
+}
+
+func TestAuthorizationFields(t *testing.T) {
+	val := `Digest username="bob", realm="atlanta.com", nonce="ea9c8e88df84f1cec4341ae6cbe5a359", uri="sip:a@b;x=1,2", response="dfe56131d1958046689d83306477ecc", algorithm="MD5", cnonce="0a4f113b", nc=00000001, qop=auth, opaque=""`
+	a := &Authorization{Val: val}
+	if err := a.parse(); err != nil {
+		t.Fatalf("[TestAuthorizationFields] Err parsing authorization hdr.  Received: %s", err.Error())
+	}
+	if a.Username != "bob" || a.Realm != "atlanta.com" || a.Nonce != "ea9c8e88df84f1cec4341ae6cbe5a359" || a.URI != "sip:a@b;x=1,2" || a.Response != "dfe56131d1958046689d83306477ecc" {
+		t.Errorf("[TestAuthorizationFields] Typed fields are wrong.  Received: %+v", a)
+	}
+	if a.Algorithm != "MD5" || a.CNonce != "0a4f113b" || a.NC != "00000001" || len(a.Qop) != 1 || a.Qop[0] != "auth" || a.Opaque != "" || len(a.Params) != 10 {
+		t.Errorf("[TestAuthorizationFields] Typed fields are wrong.  Received: %+v", a)
+	}
+	if !a.GetParam("algorithm").Quoted || a.GetParam("qop").Quoted {
+		t.Errorf("[TestAuthorizationFields] Quoting of the params was not kept.")
+	}
+	if a.String() != val {
+		t.Errorf("[TestAuthorizationFields] Error rendering authorization hdr.  Received: %q", a.String())
+	}
+	a.SetParam("nc", "00000002")
+	if a.NC != "00000002" || a.GetParam("nc").Val != "00000002" {
+		t.Errorf("[TestAuthorizationFields] SetParam did not update the param and field.")
+	}
+	c := &Authorization{Val: `Digest realm="atlanta.com", nonce="abc", qop="auth,auth-int", stale=TRUE`}
+	c.parse()
+	if len(c.Qop) != 2 || c.Qop[1] != "auth-int" || !c.Stale {
+		t.Errorf("[TestAuthorizationFields] Challenge fields are wrong.  Received: %+v", c)
+	}
+	if c.String() != `Digest realm="atlanta.com", nonce="abc", qop="auth,auth-int", stale=TRUE` {
+		t.Errorf("[TestAuthorizationFields] Error rendering challenge.  Received: %q", c.String())
+	}
+}
+
+func TestMultipleChallenges(t *testing.T) {
+	msg := "SIP/2.0 401 Unauthorized\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bKnashds7\r\n" +
+		"From: <sip:bob@atlanta.com>;tag=456248\r\n" +
+		"To: <sip:bob@atlanta.com>;tag=2493k59kd\r\n" +
+		"Call-ID: 843817637684230@998sdasdh09\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n1\", algorithm=SHA-1, qop=\"auth\"\r\n" +
+		"WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n2\", algorithm=SHA-256, qop=\"auth\"\r\n" +
+		"WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n3\", algorithm=MD5, qop=\"auth\", Digest realm=\"biloxi.com\", nonce=\"n4\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	for _, lazy := range []bool{false, true} {
+		s := ParseMsgWithOptions(msg, ParseOptions{Lazy: lazy})
+		if s.Error != nil {
+			t.Fatalf("[TestMultipleChallenges] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		chals := s.GetWWWAuthenticates()
+		if len(chals) != 4 || s.GetWWWAuthenticate() != chals[3] {
+			t.Fatalf("[TestMultipleChallenges] Should have 4 challenges.  Received: %d", len(chals))
+		}
+		for i, nonce := range []string{"n1", "n2", "n3", "n4"} {
+			if chals[i].Nonce != nonce {
+				t.Errorf("[TestMultipleChallenges] Challenge %d should have nonce %s.  Received: %s", i, nonce, chals[i].Nonce)
+			}
+		}
+		if chals[3].Realm != "biloxi.com" || chals[2].Val != `Digest realm="atlanta.com", nonce="n3", algorithm=MD5, qop="auth"` {
+			t.Errorf("[TestMultipleChallenges] Challenges in one hdr were not split correctly.  Received: %q", chals[2].Val)
+		}
+		str := s.String()
+		want := "WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n1\", algorithm=SHA-1, qop=\"auth\"\r\n" +
+			"WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n2\", algorithm=SHA-256, qop=\"auth\"\r\n" +
+			"WWW-Authenticate: Digest realm=\"atlanta.com\", nonce=\"n3\", algorithm=MD5, qop=\"auth\"\r\n" +
+			"WWW-Authenticate: Digest realm=\"biloxi.com\", nonce=\"n4\"\r\n"
+		if !strings.Contains(str, want) {
+			t.Errorf("[TestMultipleChallenges] Challenges were not rendered in order.  Received: %s", str)
+		}
+		// the topmost supported challenge for each realm is answered
+		req := NewRequest(SIP_METHOD_REGISTER, ParseURI("sip:registrar.atlanta.com"))
+		if err := NewDigestClient("bob", "zanzibar").Authorize(req, s); err != nil {
+			t.Fatalf("[TestMultipleChallenges] Error answering challenges.  Received: %s", err.Error())
+		}
+		r := ParseMsg(req.String())
+		creds := r.GetAuthorizations()
+		if len(creds) != 2 || creds[0].Nonce != "n2" || creds[0].Algorithm != DIGEST_ALG_SHA256 || creds[1].Realm != "biloxi.com" {
+			t.Fatalf("[TestMultipleChallenges] Wrong challenges were answered.  Received: %s", req.String())
+		}
+		if r.GetAuthorization() != creds[1] || req.Authorization.Realm != "biloxi.com" {
+			t.Errorf("[TestMultipleChallenges] The single Authorization field should be the last value.  Received: %s", r.GetAuthorization().String())
+		}
+		for _, realm := range []string{"atlanta.com", "biloxi.com"} {
+			v := NewDigestVerifier(realm, PasswordStore{"bob": "zanzibar"})
+			if err := v.VerifyRequest(ParseMsg(req.String()), false); err != nil {
+				t.Errorf("[TestMultipleChallenges] Error verifying credentials for %s.  Received: %s", realm, err.Error())
+			}
+		}
+		// setting the single field by hand replaces all of them
+		s.WWWAuthenticate = &Authorization{Credentials: DIGEST_SCHEME, Params: []*Param{{Param: "realm", Val: "x"}}}
+		if str := s.String(); strings.Count(str, "WWW-Authenticate:") != 1 || !strings.Contains(str, "WWW-Authenticate: Digest realm=\"x\"\r\n") {
+			t.Errorf("[TestMultipleChallenges] Hand set challenge should replace the list.  Received: %s", str)
+		}
+		s.WWWAuthenticate = nil
+		if strings.Contains(s.String(), "WWW-Authenticate") || s.GetWWWAuthenticates() != nil {
+			t.Errorf("[TestMultipleChallenges] A nil challenge should remove the hdrs.")
+		}
+	}
+}
+
+func TestSingleAuthFieldIsLast(t *testing.T) {
+	msg := "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n" +
+		"From: Alice <sip:alice@atlanta.com>;tag=1928301774\r\n" +
+		"To: Bob <sip:bob@biloxi.com>\r\n" +
+		"Call-ID: a84b4c76e66710@pc33.atlanta.com\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Authorization: Digest username=\"alice\", realm=\"atlanta.com\", nonce=\"n1\"\r\n" +
+		"Proxy-Authorization: Digest username=\"alice\", realm=\"proxy1.com\", nonce=\"p1\"\r\n" +
+		"Authorization: Digest username=\"alice\", realm=\"biloxi.com\", nonce=\"n2\"\r\n" +
+		"Proxy-Authorization: Digest username=\"alice\", realm=\"proxy2.com\", nonce=\"p2\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	for _, lazy := range []bool{false, true} {
+		s := ParseMsgWithOptions(msg, ParseOptions{Lazy: lazy})
+		if s.Error != nil {
+			t.Fatalf("[TestSingleAuthFieldIsLast] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		if a := s.GetAuthorization(); a == nil || a.Realm != "biloxi.com" || len(s.GetAuthorizations()) != 2 {
+			t.Errorf("[TestSingleAuthFieldIsLast] Authorization should be the last hdr.  Received: %v", a)
+		}
+		if a := s.GetProxyAuthorization(); a == nil || a.Realm != "proxy2.com" || len(s.GetProxyAuthorizations()) != 2 {
+			t.Errorf("[TestSingleAuthFieldIsLast] Proxy-Authorization should be the last hdr.  Received: %v", a)
+		}
+		if str := s.String(); strings.Count(str, "Authorization: Digest") != 4 {
+			t.Errorf("[TestSingleAuthFieldIsLast] Every credential should be rendered.  Received: %s", str)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// anonymousFrom is the From uri that RFC 3261 8.1.1.3 suggests
+	// when the identity of the client is to remain hidden
+	anonymousFromURI  = "sip:anonymous@anonymous.invalid"
+	anonymousFromName = "Anonymous"
+	// defaultMaxForwards is the RFC 3261 8.1.1.6 Max-Forwards value
+	defaultMaxForwards = "70"
+)
+
+// SIP_RESPONSE_REASONS holds the default reason phrase for a
+// response code.  It is used by NewResponse when no reason is given.
+var SIP_RESPONSE_REASONS = map[int]string{
+	100: "Trying",
+	180: "Ringing",
+	181: "Call Is Being Forwarded",
+	182: "Queued",
+	183: "Session Progress",
+	200: "OK",
+	202: "Accepted",
+	300: "Multiple Choices",
+	301: "Moved Permanently",
+	302: "Moved Temporarily",
+	305: "Use Proxy",
+	380: "Alternative Service",
+	400: "Bad Request",
+	401: "Unauthorized",
+	402: "Payment Required",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	406: "Not Acceptable",
+	407: "Proxy Authentication Required",
+	408: "Request Timeout",
+	410: "Gone",
+	413: "Request Entity Too Large",
+	414: "Request-URI Too Long",
+	415: "Unsupported Media Type",
+	416: "Unsupported URI Scheme",
+	420: "Bad Extension",
+	421: "Extension Required",
+	423: "Interval Too Brief",
+	480: "Temporarily Unavailable",
+	481: "Call/Transaction Does Not Exist",
+	482: "Loop Detected",
+	483: "Too Many Hops",
+	484: "Address Incomplete",
+	485: "Ambiguous",
+	486: "Busy Here",
+	487: "Request Terminated",
+	488: "Not Acceptable Here",
+	491: "Request Pending",
+	493: "Undecipherable",
+	500: "Server Internal Error",
+	501: "Not Implemented",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Server Time-out",
+	505: "Version Not Supported",
+	513: "Message Too Large",
+	600: "Busy Everywhere",
+	603: "Decline",
+	604: "Does Not Exist Anywhere",
+	606: "Not Acceptable",
+}
+
+// addrURIExcluded are the uri params that RFC 3261 19.1.1 does not
+// allow in the uri of a From or To hdr
+var addrURIExcluded = map[string]bool{
+	"method":    true,
+	"maddr":     true,
+	"ttl":       true,
+	"transport": true,
+	"lr":        true,
+}
+
+// addrURI returns a copy of u without the params and headers that are
+// not allowed in a From or To uri (RFC 3261 19.1.1)
+func addrURI(u *URI) *URI {
+	if u == nil {
+		return nil
+	}
+	n := u.clone()
+	n.Headers = nil
+	p := n.UriParams[0:0]
+	for i := range n.UriParams {
+		if !addrURIExcluded[strings.ToLower(n.UriParams[i].Param)] {
+			p = append(p, n.UriParams[i])
+		}
+	}
+	if len(p) == 0 {
+		p = nil
+	}
+	n.UriParams = p
+	return n
+}
+
+// randHex returns n random bytes as a hex string
+func randHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// localHost returns the hostname of the machine or "localhost" if
+// it can not be determined
+func localHost() string {
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		return "localhost"
+	}
+	return h
+}
+
+// NewBranch returns a new RFC 3261 branch value (i.e. one that
+// starts with the "z9hG4bK" magic cookie)
+func NewBranch() string {
+	return SIP_BRANCH_MAGIC_COOKIE + randHex(12)
+}
+
+// NewTag returns a new random value for a From or To tag
+func NewTag() string {
+	return randHex(8)
+}
+
+// NewCallId returns a new random Call-ID.  If host is not blank it is
+// appended as "@host".
+func NewCallId(host string) string {
+	if host == "" {
+		return randHex(16)
+	}
+	return randHex(16) + "@" + host
+}
+
+// NewVia returns a *Via for the transport (i.e. "UDP") and sent-by
+// (i.e. "10.0.0.1:5060") with a new branch
+func NewVia(transport string, sentBy string) *Via {
+	v := &Via{Proto: SIP_PROTO, Version: SIP_VERSION, Transport: transport, SentBy: sentBy, Branch: NewBranch()}
+	v.Via = v.String()
+	return v
+}
+
+// NewFrom returns a *From for the name and uri.  It can be used
+// for the From, To and Contact hdrs.
+func NewFrom(name string, u *URI) *From {
+	f := &From{Name: name, URI: u}
+	f.Val = f.String()
+	return f
+}
+
+// NewCseq returns a *Cseq for the digit and method
+func NewCseq(digit int, method string) *Cseq {
+	c := &Cseq{Digit: strconv.Itoa(digit), Method: method}
+	c.Val = c.String()
+	return c
+}
+
+// NewRequest builds a request for the method and request uri with
+// all of the mandatory hdrs of RFC 3261 8.1.1 filled in:
+// -- Via is SIP/2.0/UDP from the local hostname with a new branch
+// -- From is the anonymous uri from RFC 3261 8.1.1.3 with a new tag
+// -- To is the request uri (without the params and headers that are
+// not allowed in a To uri) without a tag
+// -- Call-ID is new
+// -- CSeq is 1 and the method
+// -- Max-Forwards is 70
+// Callers will normally replace the Via sent-by and the From uri
+// before sending the request.
+func NewRequest(method string, ruri *URI) *SipMsg {
+	s := &SipMsg{}
+	s.StartLine = &StartLine{Type: SIP_REQUEST, Method: method, URI: ruri, Proto: SIP_PROTO, Version: SIP_VERSION}
+	s.StartLine.Val = s.StartLine.String()
+	host := localHost()
+	s.Via = []*Via{NewVia("UDP", host)}
+	s.From = NewFrom(anonymousFromName, ParseURI(anonymousFromURI))
+	s.From.Tag = NewTag()
+	s.From.Val = s.From.String()
+	s.To = NewFrom("", addrURI(ruri))
+	s.CallId = NewCallId(host)
+	s.Cseq = NewCseq(1, method)
+	s.MaxForwards = defaultMaxForwards
+	s.MaxForwardsInt = 70
+	s.ContentLength = "0"
+	return s
+}
+
+// NewResponse builds a response to the request.  As RFC 3261 8.2.6.2
+// requires the Via, From, To, Call-ID and CSeq hdrs are copied from
+// the request and a To tag is added (unless the code is 100 or the
+// request already has one).  If reason is blank the default reason
+// phrase for the code is used.  Responses that can establish a
+// dialog (101-299) also get the Record-Route hdrs of the request.
+// It returns nil if req is nil.
+func NewResponse(req *SipMsg, code int, reason string) *SipMsg {
+	if req == nil {
+		return nil
+	}
+	if reason == "" {
+		reason = SIP_RESPONSE_REASONS[code]
+	}
+	s := &SipMsg{}
+	s.StartLine = &StartLine{Type: SIP_RESPONSE, Resp: strconv.Itoa(code), RespText: reason, Proto: SIP_PROTO, Version: SIP_VERSION}
+	s.StartLine.Val = s.StartLine.String()
+	for _, v := range req.GetVia() {
+		s.Via = append(s.Via, v.clone())
+	}
+	s.From = req.GetFrom().clone()
+	s.To = req.GetTo().clone()
+	if s.To != nil && s.To.Tag == "" && code != 100 {
+		s.To.Tag = NewTag()
+		s.To.Val = s.To.String()
+	}
+	s.CallId = req.CallId
+	if req.GetCseq() != nil {
+		c := *req.Cseq
+		s.Cseq = &c
+	}
+	if code > 100 && code < 300 {
+		for _, u := range req.GetRecordRoute() {
+			s.RecordRoute = append(s.RecordRoute, u.clone())
+		}
+	}
+	s.ContentLength = "0"
+	return s
+}
+
+// NewCancel builds a CANCEL for a request that was sent (RFC 3261
+// 9.1).  The Request-URI, Call-ID, From, To (without a tag for an
+// initial INVITE), Route hdrs and CSeq number are those of the
+// request and its only Via is the top Via of the request so that it
+// matches the same server transaction.  It returns nil if req is nil
+// or is not a request.
+func NewCancel(req *SipMsg) *SipMsg {
+	if req == nil || req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return nil
+	}
+	s := &SipMsg{}
+	s.StartLine = &StartLine{Type: SIP_REQUEST, Method: SIP_METHOD_CANCEL, URI: req.StartLine.URI.clone(), Proto: SIP_PROTO, Version: SIP_VERSION}
+	s.StartLine.Val = s.StartLine.String()
+	if via := topVia(req); via != nil {
+		s.Via = []*Via{via.clone()}
+	}
+	s.From = req.GetFrom().clone()
+	s.To = req.GetTo().clone()
+	s.CallId = req.CallId
+	if cseq := req.GetCseq(); cseq != nil {
+		s.Cseq = &Cseq{Digit: cseq.Digit, Method: SIP_METHOD_CANCEL}
+		s.Cseq.Val = s.Cseq.String()
+	}
+	s.Route = cloneURIs(req.GetRoute())
+	s.MaxForwards = defaultMaxForwards
+	s.MaxForwardsInt = 70
+	s.ContentLength = "0"
+	return s
+}
+
+// NewAckForNon2xx builds the ACK for a 300-699 response to an INVITE
+// (RFC 3261 17.1.1.3).  It is the ACK that the INVITE client
+// transaction sends itself.  The Request-URI, Call-ID, From, top Via,
+// Route hdrs and CSeq number are those of the INVITE and the To
+// (with the tag) is that of the response.  It returns nil if invite
+// is nil or is not a request or resp is nil.
+func NewAckForNon2xx(invite *SipMsg, resp *SipMsg) *SipMsg {
+	if invite == nil || invite.StartLine == nil || invite.StartLine.Type != SIP_REQUEST || resp == nil {
+		return nil
+	}
+	s := &SipMsg{}
+	s.StartLine = &StartLine{Type: SIP_REQUEST, Method: SIP_METHOD_ACK, URI: invite.StartLine.URI.clone(), Proto: SIP_PROTO, Version: SIP_VERSION}
+	s.StartLine.Val = s.StartLine.String()
+	if via := topVia(invite); via != nil {
+		s.Via = []*Via{via.clone()}
+	}
+	s.From = invite.GetFrom().clone()
+	s.To = resp.GetTo().clone()
+	s.CallId = invite.CallId
+	if cseq := invite.GetCseq(); cseq != nil {
+		s.Cseq = &Cseq{Digit: cseq.Digit, Method: SIP_METHOD_ACK}
+		s.Cseq.Val = s.Cseq.String()
+	}
+	s.Route = cloneURIs(invite.GetRoute())
+	s.MaxForwards = defaultMaxForwards
+	s.MaxForwardsInt = 70
+	s.ContentLength = "0"
+	return s
+}
+
+// NewAckFor2xx builds the ACK for a 2xx response to the INVITE (or
+// re-INVITE) that was last sent in the dialog (RFC 3261 13.2.2.4).
+// It is a request of the dialog (see Dialog.NewRequest) with a Via
+// with a new branch and the Request-URI and Route hdrs from the
+// remote target and route set.  The CSeq number and the
+// Authorization and Proxy-Authorization hdrs are copied from the
+// INVITE (so the proxies that challenged it accept the ACK too).  It
+// returns an error that wraps ErrDialog if d or invite is nil or the
+// INVITE has no CSeq.
+func NewAckFor2xx(d *Dialog, invite *SipMsg) (*SipMsg, error) {
+	switch {
+	case d == nil:
+		return nil, fmt.Errorf("%w: NewAckFor2xx err: no dialog", ErrDialog)
+	case invite == nil:
+		return nil, fmt.Errorf("%w: NewAckFor2xx err: no INVITE", ErrDialog)
+	}
+	cseq := invite.GetCseq()
+	if cseq == nil {
+		return nil, fmt.Errorf("%w: NewAckFor2xx err: INVITE has no CSeq", ErrDialog)
+	}
+	s, err := d.NewRequest(SIP_METHOD_ACK)
+	if err != nil {
+		return nil, err
+	}
+	s.Cseq = &Cseq{Digit: cseq.Digit, Method: SIP_METHOD_ACK}
+	s.Cseq.Val = s.Cseq.String()
+	if s.Authorizations = cloneAuths(invite.GetAuthorizations()); s.Authorizations != nil {
+		s.Authorization = s.Authorizations[len(s.Authorizations)-1]
+	}
+	if s.ProxyAuthorizations = cloneAuths(invite.GetProxyAuthorizations()); s.ProxyAuthorizations != nil {
+		s.ProxyAuthorization = s.ProxyAuthorizations[len(s.ProxyAuthorizations)-1]
+	}
+	return s, nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewRequest(t *testing.T) {
+	s := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	s.Via[0].SentBy = "pc33.atlanta.com"
+	s.From = NewFrom("Alice", ParseURI("sip:alice@atlanta.com"))
+	s.From.Tag = "1928301774"
+	if !strings.HasPrefix(s.Via[0].Branch, SIP_BRANCH_MAGIC_COOKIE) {
+		t.Errorf("[TestNewRequest] Via branch should start with the magic cookie.  Received: %s", s.Via[0].Branch)
+	}
+	if s.Via[0].Branch == NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com")).Via[0].Branch {
+		t.Errorf("[TestNewRequest] Two requests should not have the same branch.")
+	}
+	r := ParseMsg(s.String())
+	if r.Error != nil {
+		t.Fatalf("[TestNewRequest] Error parsing the rendered request.  Received: %s", r.Error.Error())
+	}
+	if r.StartLine.Method != SIP_METHOD_INVITE || r.StartLine.URI.String() != "sip:bob@biloxi.com" {
+		t.Errorf("[TestNewRequest] Request line is wrong.  Received: %s", r.StartLine.Val)
+	}
+	if r.Via[0].SentBy != "pc33.atlanta.com" || r.Via[0].Transport != "UDP" {
+		t.Errorf("[TestNewRequest] Via is wrong.  Received: %s", r.Via[0].Via)
+	}
+	if r.From.Tag != "1928301774" || r.From.Name != "Alice" {
+		t.Errorf("[TestNewRequest] From is wrong.  Received: %s", r.From.Val)
+	}
+	if r.To.Tag != "" || r.To.URI.String() != "sip:bob@biloxi.com" {
+		t.Errorf("[TestNewRequest] To should be the request uri without a tag.  Received: %s", r.To.Val)
+	}
+	if r.CallId == "" {
+		t.Errorf("[TestNewRequest] Call-ID should not be blank.")
+	}
+	if r.Cseq.Digit != "1" || r.Cseq.Method != SIP_METHOD_INVITE {
+		t.Errorf("[TestNewRequest] CSeq should be \"1 INVITE\".  Received: %s", r.Cseq.Val)
+	}
+	if r.MaxForwards != "70" || r.ContentLength != "0" {
+		t.Errorf("[TestNewRequest] Max-Forwards should be 70 and Content-Length should be 0.")
+	}
+	ruri := ParseURI("sip:bob@biloxi.com;transport=tcp;maddr=10.0.0.1;user=phone?subject=x")
+	s = NewRequest(SIP_METHOD_INVITE, ruri)
+	if s.To.URI.String() != "sip:bob@biloxi.com;user=phone" {
+		t.Errorf("[TestNewRequest] To should not have the request uri only params and headers.  Received: %s", s.To.URI.String())
+	}
+	if len(ruri.UriParams) != 3 || len(ruri.Headers) != 1 {
+		t.Errorf("[TestNewRequest] Building the To uri should not change the request uri.")
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	m := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP server10.biloxi.com;branch=z9hG4bKnashds8;received=192.0.2.3\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds;received=192.0.2.1\r\nMax-Forwards: 69\r\nTo: Bob <sip:bob@biloxi.com>\r\nFrom: Alice <sip:alice@atlanta.com>;tag=1928301774\r\nCall-ID: a84b4c76e66710@pc33.atlanta.com\r\nCSeq: 314159 INVITE\r\nRecord-Route: <sip:server10.biloxi.com;lr>\r\nContent-Length: 0\r\n\r\n"
+	req := ParseMsg(m)
+	if req.Error != nil {
+		t.Fatalf("[TestNewResponse] Error parsing request.  Received: %s", req.Error.Error())
+	}
+	s := NewResponse(req, 100, "")
+	if s.StartLine.String() != "SIP/2.0 100 Trying" {
+		t.Errorf("[TestNewResponse] Status line should be \"SIP/2.0 100 Trying\".  Received: %s", s.StartLine.String())
+	}
+	if s.To.Tag != "" {
+		t.Errorf("[TestNewResponse] 100 Trying should not add a To tag.")
+	}
+	if s.RecordRoute != nil {
+		t.Errorf("[TestNewResponse] 100 Trying should not copy Record-Route.")
+	}
+	s = NewResponse(req, 180, "")
+	r := ParseMsg(s.String())
+	if r.Error != nil {
+		t.Fatalf("[TestNewResponse] Error parsing the rendered response.  Received: %s", r.Error.Error())
+	}
+	if len(r.Via) != 2 || r.Via[0].String() != req.Via[0].String() || r.Via[1].String() != req.Via[1].String() {
+		t.Errorf("[TestNewResponse] Vias should be copied in order from the request.")
+	}
+	if r.From.String() != req.From.String() || r.CallId != req.CallId || r.Cseq.String() != req.Cseq.String() {
+		t.Errorf("[TestNewResponse] From, Call-ID and CSeq should be copied from the request.")
+	}
+	if r.To.Tag == "" || r.To.URI.String() != req.To.URI.String() {
+		t.Errorf("[TestNewResponse] To should be copied from the request with a tag added.  Received: %s", r.To.Val)
+	}
+	if req.To.Tag != "" {
+		t.Errorf("[TestNewResponse] Adding the To tag should not change the request.")
+	}
+	if len(r.RecordRoute) != 1 {
+		t.Errorf("[TestNewResponse] 180 Ringing should copy Record-Route.")
+	}
+	s = NewResponse(req, 486, "Busy")
+	if s.StartLine.RespText != "Busy" || s.StartLine.Resp != "486" {
+		t.Errorf("[TestNewResponse] Status line should use the passed in reason.")
+	}
+	if NewResponse(nil, 200, "") != nil {
+		t.Errorf("[TestNewResponse] A response to a nil request should be nil.")
+	}
+}
+
+// testSameRequest checks the request that a builder returned (got)
+// against the one from a call flow (want).  The branch of the top Via
+// is only checked if sameBranch is true.
+func testSameRequest(t *testing.T, name string, got *SipMsg, want string, sameBranch bool) {
+	r, w := ParseMsg(got.String()), ParseMsg(want)
+	if r.Error != nil || w.Error != nil {
+		t.Fatalf("[%s] Error parsing the requests.  Received: %v and %v", name, r.Error, w.Error)
+	}
+	if r.StartLine.Method != w.StartLine.Method || r.StartLine.URI.String() != w.StartLine.URI.String() {
+		t.Errorf("[%s] Request line should be %q.  Received: %q", name, w.StartLine.Val, r.StartLine.Val)
+	}
+	if len(r.Via) != 1 || r.Via[0].SentBy != w.Via[0].SentBy || r.Via[0].Transport != w.Via[0].Transport {
+		t.Errorf("[%s] Via should be %q.  Received: %d vias", name, w.Via[0].Via, len(r.Via))
+	} else if (r.Via[0].Branch == w.Via[0].Branch) != sameBranch {
+		t.Errorf("[%s] Via branch is wrong.  Received: %q", name, r.Via[0].Branch)
+	}
+	if r.From.URI.String() != w.From.URI.String() || r.From.Tag != w.From.Tag {
+		t.Errorf("[%s] From should be %q.  Received: %q", name, w.From.Val, r.From.Val)
+	}
+	if r.To.URI.String() != w.To.URI.String() || r.To.Tag != w.To.Tag {
+		t.Errorf("[%s] To should be %q.  Received: %q", name, w.To.Val, r.To.Val)
+	}
+	if r.CallId != w.CallId || r.Cseq.Val != w.Cseq.Val || r.MaxForwards != w.MaxForwards {
+		t.Errorf("[%s] Call-ID, CSeq and Max-Forwards should be %q, %q and %q.  Received: %q, %q and %q", name, w.CallId, w.Cseq.Val, w.MaxForwards, r.CallId, r.Cseq.Val, r.MaxForwards)
+	}
+	if len(r.Route) != len(w.Route) {
+		t.Fatalf("[%s] Should have %d routes.  Received: %d", name, len(w.Route), len(r.Route))
+	}
+	for i := range r.Route {
+		if r.Route[i].String() != w.Route[i].String() {
+			t.Errorf("[%s] Route %d should be %q.  Received: %q", name, i, w.Route[i].String(), r.Route[i].String())
+		}
+	}
+	if r.ContentLength != "0" {
+		t.Errorf("[%s] Should have no body.  Received: %s", name, r.ContentLength)
+	}
+}
+
+// The INVITE of the RFC 3665 call flows (after the 407 challenge of
+// proxy 1)
+const rfc3665Invite = "INVITE sip:bob@biloxi.example.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74bfa\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"Route: <sip:ss1.atlanta.example.com;lr>\r\n" +
+	"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+	"To: Bob <sip:bob@biloxi.example.com>\r\n" +
+	"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+	"CSeq: 2 INVITE\r\n" +
+	"Contact: <sip:alice@client.atlanta.example.com;transport=tcp>\r\n" +
+	"Proxy-Authorization: Digest username=\"alice\", realm=\"atlanta.example.com\", nonce=\"wf84f1cczx41ae6cbeaea9ce88d359\", opaque=\"\", uri=\"sip:bob@biloxi.example.com\", response=\"42ce3cef44b22f50c6a6071bc8\"\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestNewCancel(t *testing.T) {
+	// RFC 3665 3.8 Unsuccessful No Answer: Alice gives up on Bob
+	cancel := "CANCEL sip:bob@biloxi.example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74bfa\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"Route: <sip:ss1.atlanta.example.com;lr>\r\n" +
+		"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+		"To: Bob <sip:bob@biloxi.example.com>\r\n" +
+		"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+		"CSeq: 2 CANCEL\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	inv := ParseMsg(rfc3665Invite)
+	s := NewCancel(inv)
+	testSameRequest(t, "TestNewCancel", s, cancel, true)
+	if s.ProxyAuthorization != nil || s.Contact != nil || s.ContentType != "" {
+		t.Errorf("[TestNewCancel] CANCEL should not copy the other hdrs of the INVITE.")
+	}
+	s.Via[0].Branch = "changed"
+	if inv.Via[0].Branch != "z9hG4bK74bfa" {
+		t.Errorf("[TestNewCancel] CANCEL should have a copy of the Via.")
+	}
+	key, _ := ServerTxnKey(ParseMsg(NewCancel(inv).String()))
+	invKey, _ := ServerTxnKey(inv)
+	if key == "" || key != strings.Replace(invKey, SIP_METHOD_INVITE, SIP_METHOD_CANCEL, 1) {
+		t.Errorf("[TestNewCancel] CANCEL should have the branch and sent-by of the INVITE.  Received: %q and %q", key, invKey)
+	}
+	if NewCancel(nil) != nil || NewCancel(&SipMsg{}) != nil {
+		t.Errorf("[TestNewCancel] A nil msg or one without a request line should not get a CANCEL.")
+	}
+}
+
+func TestNewAckForNon2xx(t *testing.T) {
+	// RFC 3665 3.9 Unsuccessful Busy: Alice ACKs the 486 from Bob
+	busy := "SIP/2.0 486 Busy Here\r\n" +
+		"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74bfa;received=192.0.2.101\r\n" +
+		"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+		"To: Bob <sip:bob@biloxi.example.com>;tag=314159\r\n" +
+		"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	ack := "ACK sip:bob@biloxi.example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74bfa\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"Route: <sip:ss1.atlanta.example.com;lr>\r\n" +
+		"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+		"To: Bob <sip:bob@biloxi.example.com>;tag=314159\r\n" +
+		"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+		"CSeq: 2 ACK\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	s := NewAckForNon2xx(ParseMsg(rfc3665Invite), ParseMsg(busy))
+	testSameRequest(t, "TestNewAckForNon2xx", s, ack, true)
+	if s.Via[0].Received != "" {
+		t.Errorf("[TestNewAckForNon2xx] The Via should be the one of the INVITE.  Received: %q", s.Via[0].Via)
+	}
+	if NewAckForNon2xx(nil, nil) != nil || NewAckForNon2xx(&SipMsg{}, ParseMsg(busy)) != nil || NewAckForNon2xx(ParseMsg(rfc3665Invite), nil) != nil {
+		t.Errorf("[TestNewAckForNon2xx] A nil INVITE or response should not get an ACK.")
+	}
+}
+
+func TestNewAckFor2xx(t *testing.T) {
+	// RFC 3665 3.2 Session Establishment Through Two Proxies: Alice
+	// ACKs the 200 OK from Bob through the proxies that
+	// record-routed
+	ok := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74bfa;received=192.0.2.101\r\n" +
+		"Record-Route: <sip:ss2.biloxi.example.com;lr>, <sip:ss1.atlanta.example.com;lr>\r\n" +
+		"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+		"To: Bob <sip:bob@biloxi.example.com>;tag=314159\r\n" +
+		"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+		"CSeq: 2 INVITE\r\n" +
+		"Contact: <sip:bob@client.biloxi.example.com;transport=tcp>\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	ack := "ACK sip:bob@client.biloxi.example.com;transport=tcp SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP client.atlanta.example.com:5060;branch=z9hG4bK74b76\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"Route: <sip:ss1.atlanta.example.com;lr>, <sip:ss2.biloxi.example.com;lr>\r\n" +
+		"Proxy-Authorization: Digest username=\"alice\", realm=\"atlanta.example.com\", nonce=\"wf84f1cczx41ae6cbeaea9ce88d359\", opaque=\"\", uri=\"sip:bob@biloxi.example.com\", response=\"42ce3cef44b22f50c6a6071bc8\"\r\n" +
+		"From: Alice <sip:alice@atlanta.example.com>;tag=9fxced76sl\r\n" +
+		"To: Bob <sip:bob@biloxi.example.com>;tag=314159\r\n" +
+		"Call-ID: 3848276298220188511@atlanta.example.com\r\n" +
+		"CSeq: 2 ACK\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	invite := ParseMsg(rfc3665Invite)
+	d, err := NewDialogUAC(invite, ParseMsg(ok))
+	if err != nil {
+		t.Fatalf("[TestNewAckFor2xx] Error creating the dialog: %s", err)
+	}
+	s, err := NewAckFor2xx(d, invite)
+	if err != nil {
+		t.Fatalf("[TestNewAckFor2xx] Error building the ACK: %s", err)
+	}
+	testSameRequest(t, "TestNewAckFor2xx", s, ack, false)
+	r, w := ParseMsg(s.String()), ParseMsg(ack)
+	if r.GetProxyAuthorization() == nil || r.GetProxyAuthorization().String() != w.GetProxyAuthorization().String() || len(r.GetProxyAuthorizations()) != 1 || r.GetAuthorization() != nil {
+		t.Errorf("[TestNewAckFor2xx] The ACK should have the Proxy-Authorization of the INVITE.  Received: %q", s.String())
+	}
+	if s.ProxyAuthorization == invite.ProxyAuthorization || s.ProxyAuthorization.Params[0] == invite.ProxyAuthorization.Params[0] {
+		t.Errorf("[TestNewAckFor2xx] The Proxy-Authorization should be a copy.")
+	}
+	if !isRFC3261Branch(s.Via[0].Branch) || s.Via[0].Received != "" {
+		t.Errorf("[TestNewAckFor2xx] Via should get a new branch.  Received: %q", s.Via[0].Via)
+	}
+	if s.Contact != nil || d.LocalSeq != 2 {
+		t.Errorf("[TestNewAckFor2xx] ACK should not have a Contact or use a new CSeq.")
+	}
+	if _, err := NewAckFor2xx(nil, invite); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestNewAckFor2xx] A nil dialog should be an ErrDialog.")
+	}
+	if _, err := NewAckFor2xx(d, &SipMsg{}); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestNewAckFor2xx] An INVITE without a CSeq should be an ErrDialog.")
+	}
+	if bye, _ := d.NewRequest(SIP_METHOD_BYE); bye.Cseq.Val != "3 BYE" {
+		t.Errorf("[TestNewAckFor2xx] BYE after the ACK should have CSeq \"3 BYE\".  Received: %q", bye.Cseq.Val)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ClientTransaction is an INVITE (RFC 3261 17.1.1) or non-INVITE
+// (17.1.2) client transaction.  The callbacks are called without the
+// transaction locked (and from the goroutine of the timer for the
+// ones that come from a timer).
+// The fields are as follows:
+// -- Request is the request that the transaction sends
+// -- OnResponse is called with each response that goes to the TU
+// (retransmissions of a final response do not)
+// -- OnTimeout is called when Timer B or F fires (no final response)
+// -- OnTimerC is called when Timer C fires (see TxnConfig.TimerC)
+// -- OnTransportError is called when Send fails
+// -- OnTerminated is called once the transaction is terminated
+type ClientTransaction struct {
+	txn
+	Request          *SipMsg
+	OnResponse       func(resp *SipMsg)
+	OnTimeout        func()
+	OnTimerC         func()
+	OnTransportError func(err error)
+	OnTerminated     func()
+	invite           bool
+	interval         time.Duration
+	ack              *SipMsg
+}
+
+// NewClientTransaction returns a client transaction for the request.
+// Start sends the request.
+func NewClientTransaction(req *SipMsg, cfg *TxnConfig) (*ClientTransaction, error) {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return nil, fmt.Errorf("%w: NewClientTransaction err: msg is not a request", ErrTransaction)
+	}
+	if req.StartLine.Method == SIP_METHOD_ACK {
+		return nil, fmt.Errorf("%w: NewClientTransaction err: an ACK has no transaction", ErrTransaction)
+	}
+	key, err := ClientTxnKey(req)
+	if err != nil {
+		return nil, err
+	}
+	tx := &ClientTransaction{Request: req, invite: req.StartLine.Method == SIP_METHOD_INVITE}
+	tx.cfg = cfg.withDefaults()
+	tx.key = key
+	tx.timers = make(map[string]*txnTimer)
+	tx.state = TXN_STATE_TRYING
+	if tx.invite {
+		tx.state = TXN_STATE_CALLING
+	}
+	return tx, nil
+}
+
+// send sends the msg and terminates the transaction if it fails.
+// It returns false (and the funcs to call) if it failed.  t.mu must
+// be held.
+func (t *ClientTransaction) send(msg *SipMsg) ([]func(), bool) {
+	if t.cfg.Send == nil {
+		return nil, true
+	}
+	if err := t.cfg.Send(msg); err != nil {
+		after := []func(){}
+		if t.OnTransportError != nil {
+			f := t.OnTransportError
+			after = append(after, func() { f(err) })
+		}
+		return append(after, t.terminate(t.OnTerminated)...), false
+	}
+	return nil, true
+}
+
+// Start sends the request and starts Timers A and B (INVITE) or E
+// and F (non-INVITE)
+func (t *ClientTransaction) Start() {
+	t.mu.Lock()
+	after, ok := t.send(t.Request)
+	if ok {
+		t.interval = t.cfg.T1
+		retransmit, timeout := "E", "F"
+		if t.invite {
+			retransmit, timeout = "A", "B"
+			if t.cfg.TimerC != 0 {
+				t.startTimer("C", t.cfg.TimerC, t.timerC)
+			}
+		}
+		if !t.cfg.Reliable {
+			t.startTimer(retransmit, t.cfg.T1, t.retransmit)
+		}
+		t.startTimer(timeout, 64*t.cfg.T1, t.timeout)
+	}
+	t.mu.Unlock()
+	runAll(after)
+}
+
+// retransmit is Timer A or E.  Timer A doubles each time.  Timer E
+// doubles up to T2 while Trying and is T2 once Proceeding.
+func (t *ClientTransaction) retransmit() []func() {
+	if t.state != TXN_STATE_CALLING && t.state != TXN_STATE_TRYING && t.state != TXN_STATE_PROCEEDING {
+		return nil
+	}
+	if after, ok := t.send(t.Request); !ok {
+		return after
+	}
+	t.interval *= 2
+	name := "A"
+	if !t.invite {
+		name = "E"
+		if t.interval > t.cfg.T2 || t.state == TXN_STATE_PROCEEDING {
+			t.interval = t.cfg.T2
+		}
+	}
+	t.startTimer(name, t.interval, t.retransmit)
+	return nil
+}
+
+// timeout is Timer B or F
+func (t *ClientTransaction) timeout() []func() {
+	if t.state != TXN_STATE_CALLING && t.state != TXN_STATE_TRYING && t.state != TXN_STATE_PROCEEDING {
+		return nil
+	}
+	return append([]func(){t.OnTimeout}, t.terminate(t.OnTerminated)...)
+}
+
+// timerC is Timer C.  The transaction is left as is since it is up
+// to the proxy to CANCEL the request.
+func (t *ClientTransaction) timerC() []func() {
+	if t.state != TXN_STATE_CALLING && t.state != TXN_STATE_PROCEEDING {
+		return nil
+	}
+	return []func(){t.OnTimerC}
+}
+
+// terminated is Timer D or K
+func (t *ClientTransaction) terminated() []func() {
+	return t.terminate(t.OnTerminated)
+}
+
+// complete moves the transaction to Completed and starts Timer D or
+// K (or terminates it right away for a reliable transport).  t.mu
+// must be held.
+func (t *ClientTransaction) complete() []func() {
+	t.state = TXN_STATE_COMPLETED
+	for _, name := range []string{"A", "B", "C", "E", "F"} {
+		t.stopTimer(name)
+	}
+	name, d := "K", t.cfg.unreliable(t.cfg.T4)
+	if t.invite {
+		name, d = "D", t.cfg.unreliable(SIP_TIMER_D)
+	}
+	if d == 0 {
+		return t.terminate(t.OnTerminated)
+	}
+	t.startTimer(name, d, t.terminated)
+	return nil
+}
+
+// Receive handles a response that matched the transaction
+func (t *ClientTransaction) Receive(resp *SipMsg) {
+	if resp.StartLine == nil || resp.StartLine.Type != SIP_RESPONSE {
+		return
+	}
+	code, err := strconv.Atoi(resp.StartLine.Resp)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	after := t.receive(resp, code)
+	t.mu.Unlock()
+	runAll(after)
+}
+
+// receive does the work of Receive with t.mu held
+func (t *ClientTransaction) receive(resp *SipMsg, code int) []func() {
+	var after []func()
+	if t.OnResponse != nil {
+		f := t.OnResponse
+		after = append(after, func() { f(resp) })
+	}
+	switch {
+	case t.state == TXN_STATE_TERMINATED:
+		return nil
+	case t.state == TXN_STATE_COMPLETED:
+		// a retransmission of the final response
+		if t.invite && code >= 300 && t.ack != nil {
+			a, _ := t.send(t.ack)
+			return a
+		}
+		return nil
+	case code < 200:
+		if t.state != TXN_STATE_PROCEEDING {
+			t.state = TXN_STATE_PROCEEDING
+			t.stopTimer("A")
+			t.stopTimer("B")
+		}
+		if t.invite && code > 100 && t.cfg.TimerC != 0 {
+			t.startTimer("C", t.cfg.TimerC, t.timerC)
+		}
+		return after
+	case t.invite && code < 300:
+		// the TU sends the ACK for a 2xx itself
+		return append(after, t.terminate(t.OnTerminated)...)
+	case t.invite:
+		t.ack = NewAckForNon2xx(t.Request, resp)
+		if a, ok := t.send(t.ack); !ok {
+			return append(after, a...)
+		}
+	}
+	return append(after, t.complete()...)
+}
+
+// Terminate terminates the transaction (i.e. when the TU gives up
+// on it)
+func (t *ClientTransaction) Terminate() {
+	t.mu.Lock()
+	after := t.terminate(t.OnTerminated)
+	t.mu.Unlock()
+	runAll(after)
+}
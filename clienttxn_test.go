@@ -0,0 +1,185 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// clientTxnEvents records the callbacks of a client transaction
+type clientTxnEvents struct {
+	responses  []string
+	timeout    int
+	timerC     int
+	terminated int
+	err        error
+}
+
+func newTestClientTxn(t *testing.T, method string, cfg *TxnConfig) (*ClientTransaction, *clientTxnEvents) {
+	tx, err := NewClientTransaction(NewRequest(method, ParseURI("sip:bob@biloxi.com")), cfg)
+	if err != nil {
+		t.Fatalf("[newTestClientTxn] Error creating transaction.  Received: %s", err.Error())
+	}
+	ev := &clientTxnEvents{}
+	tx.OnResponse = func(resp *SipMsg) { ev.responses = append(ev.responses, resp.StartLine.Resp) }
+	tx.OnTimeout = func() { ev.timeout++ }
+	tx.OnTimerC = func() { ev.timerC++ }
+	tx.OnTerminated = func() { ev.terminated++ }
+	tx.OnTransportError = func(err error) { ev.err = err }
+	return tx, ev
+}
+
+func TestClientInviteTimeout(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestClientTxn(t, SIP_METHOD_INVITE, testTxnConfig(c, tt))
+	tx.Start()
+	if tx.State() != TXN_STATE_CALLING || len(tt.sent) != 1 {
+		t.Fatalf("[TestClientInviteTimeout] INVITE should be sent in Calling.")
+	}
+	// Timer A fires at 0.5, 1.5, 3.5, 7.5, 15.5 and 31.5s
+	for i, at := range []time.Duration{500, 1500, 3500, 7500, 15500, 31500} {
+		c.Advance(at*time.Millisecond - c.Now().Sub(time.Unix(0, 0)))
+		if len(tt.sent) != i+2 {
+			t.Errorf("[TestClientInviteTimeout] Should have retransmitted %d times at %s.  Received: %d", i+1, c.Now().Sub(time.Unix(0, 0)), len(tt.sent)-1)
+		}
+	}
+	c.Advance(499 * time.Millisecond)
+	if tx.State() != TXN_STATE_CALLING || ev.timeout != 0 {
+		t.Errorf("[TestClientInviteTimeout] Timer B should not have fired yet.")
+	}
+	c.Advance(time.Millisecond)
+	if tx.State() != TXN_STATE_TERMINATED || ev.timeout != 1 || ev.terminated != 1 {
+		t.Errorf("[TestClientInviteTimeout] Timer B should terminate the transaction at 64*T1.")
+	}
+	c.Advance(time.Hour)
+	if len(tt.sent) != 7 || ev.terminated != 1 {
+		t.Errorf("[TestClientInviteTimeout] Nothing should happen after the transaction is terminated.")
+	}
+}
+
+func TestClientInviteNon2xx(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestClientTxn(t, SIP_METHOD_INVITE, testTxnConfig(c, tt))
+	tx.Start()
+	tx.Receive(ParseMsg(NewResponse(tx.Request, 100, "").String()))
+	if tx.State() != TXN_STATE_PROCEEDING {
+		t.Fatalf("[TestClientInviteNon2xx] A 100 should move the transaction to Proceeding.")
+	}
+	c.Advance(10 * time.Second)
+	if len(tt.sent) != 1 {
+		t.Errorf("[TestClientInviteNon2xx] Should not retransmit in Proceeding.  Received: %d", len(tt.sent)-1)
+	}
+	busy := ParseMsg(NewResponse(tx.Request, 486, "").String())
+	tx.Receive(busy)
+	if tx.State() != TXN_STATE_COMPLETED || tt.count(SIP_METHOD_ACK) != 1 {
+		t.Fatalf("[TestClientInviteNon2xx] A 486 should be ACKed and move the transaction to Completed.")
+	}
+	ack := tt.sent[1]
+	if ack.StartLine.URI.String() != "sip:bob@biloxi.com" || ack.Via[0].Branch != tx.Request.Via[0].Branch || ack.To.Tag != busy.To.Tag || ack.Cseq.Digit != tx.Request.Cseq.Digit || ack.Cseq.Method != SIP_METHOD_ACK {
+		t.Errorf("[TestClientInviteNon2xx] ACK is wrong.  Received: %s", ack.String())
+	}
+	tx.Receive(busy)
+	if tt.count(SIP_METHOD_ACK) != 2 || len(ev.responses) != 2 {
+		t.Errorf("[TestClientInviteNon2xx] A retransmitted 486 should be ACKed again and not go to the TU.  Received: %v", ev.responses)
+	}
+	c.Advance(SIP_TIMER_D)
+	if tx.State() != TXN_STATE_TERMINATED || ev.timeout != 0 || ev.terminated != 1 {
+		t.Errorf("[TestClientInviteNon2xx] Timer D should terminate the transaction.")
+	}
+}
+
+func TestClientInvite2xx(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	cfg := testTxnConfig(c, tt)
+	cfg.TimerC = 180 * time.Second
+	tx, ev := newTestClientTxn(t, SIP_METHOD_INVITE, cfg)
+	tx.Start()
+	c.Advance(10 * time.Second)
+	tx.Receive(ParseMsg(NewResponse(tx.Request, 180, "").String()))
+	c.Advance(179 * time.Second)
+	if ev.timerC != 0 {
+		t.Errorf("[TestClientInvite2xx] Timer C should be reset by a 180.")
+	}
+	c.Advance(time.Second)
+	if ev.timerC != 1 || tx.State() != TXN_STATE_PROCEEDING {
+		t.Errorf("[TestClientInvite2xx] Timer C should fire 180s after the 180.")
+	}
+	tx.Receive(ParseMsg(NewResponse(tx.Request, 200, "").String()))
+	if tx.State() != TXN_STATE_TERMINATED || tt.count(SIP_METHOD_ACK) != 0 || len(ev.responses) != 2 || ev.responses[1] != "200" {
+		t.Errorf("[TestClientInvite2xx] A 200 should go to the TU and terminate the transaction without an ACK.")
+	}
+}
+
+func TestClientNonInvite(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestClientTxn(t, SIP_METHOD_REGISTER, testTxnConfig(c, tt))
+	tx.Start()
+	if tx.State() != TXN_STATE_TRYING {
+		t.Fatalf("[TestClientNonInvite] Should start in Trying.")
+	}
+	// Timer E fires at 0.5, 1.5, 3.5, 7.5 and then every T2
+	c.Advance(7500 * time.Millisecond)
+	if len(tt.sent) != 5 {
+		t.Errorf("[TestClientNonInvite] Should have retransmitted 4 times.  Received: %d", len(tt.sent)-1)
+	}
+	c.Advance(4 * time.Second)
+	if len(tt.sent) != 6 {
+		t.Errorf("[TestClientNonInvite] Timer E should be capped at T2.  Received: %d", len(tt.sent)-1)
+	}
+	tx.Receive(ParseMsg(NewResponse(tx.Request, 100, "").String()))
+	if tx.State() != TXN_STATE_PROCEEDING {
+		t.Errorf("[TestClientNonInvite] A 100 should move the transaction to Proceeding.")
+	}
+	c.Advance(4 * time.Second)
+	if len(tt.sent) != 7 {
+		t.Errorf("[TestClientNonInvite] Should retransmit every T2 in Proceeding.  Received: %d", len(tt.sent)-1)
+	}
+	ok := ParseMsg(NewResponse(tx.Request, 200, "").String())
+	tx.Receive(ok)
+	tx.Receive(ok)
+	if tx.State() != TXN_STATE_COMPLETED || len(ev.responses) != 2 {
+		t.Errorf("[TestClientNonInvite] A 200 should go to the TU once.  Received: %v", ev.responses)
+	}
+	c.Advance(SIP_T4)
+	if tx.State() != TXN_STATE_TERMINATED || len(tt.sent) != 7 {
+		t.Errorf("[TestClientNonInvite] Timer K should terminate the transaction.")
+	}
+
+	// Timer F
+	tx, ev = newTestClientTxn(t, SIP_METHOD_OPTIONS, testTxnConfig(c, tt))
+	tx.Start()
+	c.Advance(64 * SIP_T1)
+	if tx.State() != TXN_STATE_TERMINATED || ev.timeout != 1 {
+		t.Errorf("[TestClientNonInvite] Timer F should time the transaction out.")
+	}
+}
+
+func TestClientTxnReliable(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	cfg := testTxnConfig(c, tt)
+	cfg.Reliable = true
+	tx, _ := newTestClientTxn(t, SIP_METHOD_INVITE, cfg)
+	tx.Start()
+	c.Advance(31 * time.Second)
+	if len(tt.sent) != 1 {
+		t.Errorf("[TestClientTxnReliable] Should not retransmit on a reliable transport.")
+	}
+	tx.Receive(ParseMsg(NewResponse(tx.Request, 603, "").String()))
+	if tx.State() != TXN_STATE_TERMINATED || tt.count(SIP_METHOD_ACK) != 1 {
+		t.Errorf("[TestClientTxnReliable] Timer D should be 0 on a reliable transport.")
+	}
+	tt.err = errors.New("connection reset")
+	tx, ev := newTestClientTxn(t, SIP_METHOD_BYE, cfg)
+	tx.Start()
+	if tx.State() != TXN_STATE_TERMINATED || ev.err != tt.err || ev.terminated != 1 {
+		t.Errorf("[TestClientTxnReliable] A transport error should terminate the transaction.")
+	}
+	if _, err := NewClientTransaction(ParseMsg("SIP/2.0 200 OK\r\n\r\n"), cfg); !errors.Is(err, ErrTransaction) {
+		t.Errorf("[TestClientTxnReliable] A response should not create a client transaction.")
+	}
+}
@@ -9,6 +9,11 @@ const (
 	// SIP request or response
 	SIP_REQUEST  = "REQUEST"
 	SIP_RESPONSE = "RESPONSE"
+	// SIP Version
+	SIP_PROTO   = "SIP"
+	SIP_VERSION = "2.0"
+	// RFC 3261 branch magic cookie
+	SIP_BRANCH_MAGIC_COOKIE = "z9hG4bK"
 	// SIP Methods
 	SIP_METHOD_INVITE    = "INVITE"
 	SIP_METHOD_ACK       = "ACK"
@@ -144,3 +149,24 @@ const (
 	SIP_HDR_P_USER_DATABASE               = "p-user-database"               // RFC4457
 	SIP_HDR_P_VISITED_NETWORK_ID          = "p-visited-network-id"          // RFC3455
 )
+
+// SIP_HDR_COMPACT_FORMS maps the compact form of a hdr to its long form
+var SIP_HDR_COMPACT_FORMS = map[string]string{
+	SIP_HDR_ACCEPT_CONTACT_CMP:   SIP_HDR_ACCEPT_CONTACT,
+	SIP_HDR_ALLOW_EVENTS_CMP:     SIP_HDR_ALLOW_EVENTS,
+	SIP_HDR_CALL_ID_CMP:          SIP_HDR_CALL_ID,
+	SIP_HDR_CONTACT_CMP:          SIP_HDR_CONTACT,
+	SIP_HDR_CONTENT_ENCODING_CMP: SIP_HDR_CONTENT_ENCODING,
+	SIP_HDR_CONTENT_LENGTH_CMP:   SIP_HDR_CONTENT_LENGTH,
+	SIP_HDR_CONTENT_TYPE_CMP:     SIP_HDR_CONTENT_TYPE,
+	SIP_HDR_FROM_CMP:             SIP_HDR_FROM,
+	SIP_HDR_IDENTITY_CMP:         SIP_HDR_IDENTITY,
+	SIP_HDR_IDENTITY_INFO_CMP:    SIP_HDR_IDENTITY_INFO,
+	SIP_HDR_REFERRED_BY_CMP:      SIP_HDR_REFERRED_BY,
+	SIP_HDR_REJECT_CONTACT_CMP:   SIP_HDR_REJECT_CONTACT,
+	SIP_HDR_SESSION_EXPIRES_CMP:  SIP_HDR_SESSION_EXPIRES,
+	SIP_HDR_SUBJECT_CMP:          SIP_HDR_SUBJECT,
+	SIP_HDR_SUPPORTED_CMP:        SIP_HDR_SUPPORTED,
+	SIP_HDR_TO_CMP:               SIP_HDR_TO,
+	SIP_HDR_VIA_CMP:              SIP_HDR_VIA,
+}
@@ -0,0 +1,229 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// contactFeatureTags are the RFC 3840 base feature tags.  Any other
+// feature tag starts with a "+" (i.e. +g.3gpp.icsi-ref).
+var contactFeatureTags = map[string]bool{
+	"actor":       true,
+	"application": true,
+	"audio":       true,
+	"automata":    true,
+	"class":       true,
+	"control":     true,
+	"data":        true,
+	"description": true,
+	"duplex":      true,
+	"events":      true,
+	"extensions":  true,
+	"isfocus":     true,
+	"language":    true,
+	"methods":     true,
+	"mobility":    true,
+	"priority":    true,
+	"schemes":     true,
+	"text":        true,
+	"type":        true,
+	"video":       true,
+}
+
+// Contact is a single value of a Contact hdr.  A Contact hdr with
+// more than one comma separated value (or more than one Contact hdr)
+// is parsed into one Contact for each.
+// The fields are as follows:
+// -- Error is the error (or nil)
+// -- Val is the raw value
+// -- Wildcard is true for the "*" contact (which removes all of the
+// bindings of a REGISTER)
+// -- Name is the display name
+// -- URI is the parsed uri
+// -- Expires is the expires param or -1 if there isn't one
+// -- Q is the q param (0 to 1) or -1 if there isn't one
+// -- Instance is the +sip.instance param without the quotes (i.e.
+// "<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>") (RFC 5626)
+// -- RegId is the reg-id param (RFC 5626)
+// -- PubGruu and TempGruu are the pub-gruu and temp-gruu params
+// without the quotes (RFC 5627)
+// -- FeatureTags are the feature tag params (RFC 3840) other than
+// +sip.instance (i.e. audio or +g.3gpp.icsi-ref)
+// -- Params are any other params
+type Contact struct {
+	Error       error
+	Val         string
+	Wildcard    bool
+	Name        string
+	URI         *URI
+	Expires     int
+	Q           float64
+	Instance    string
+	RegId       string
+	PubGruu     string
+	TempGruu    string
+	FeatureTags []*Param
+	Params      []*Param
+}
+
+// NewContact returns a *Contact for the name and uri without an
+// expires or q param
+func NewContact(name string, u *URI) *Contact {
+	c := &Contact{Name: name, URI: u, Expires: -1, Q: -1}
+	c.Val = c.String()
+	return c
+}
+
+// getContact parses a single contact value
+func getContact(s string) *Contact {
+	c := &Contact{Val: s, Expires: -1, Q: -1}
+	if s == "*" {
+		c.Wildcard = true
+		return c
+	}
+	f := getFrom(s)
+	if f.Error != nil {
+		c.Error = fmt.Errorf("%w: getContact err: rcvd err parsing contact: %w", ErrBadContact, f.Error)
+		return c
+	}
+	c.Name, c.URI = f.Name, f.URI
+	if f.Tag != "" {
+		// the From parser pulls out the tag but it is just another
+		// param for a contact
+		f.Params = append(f.Params, &Param{Param: "tag", Val: f.Tag})
+	}
+	for _, p := range f.Params {
+		if c.Error = c.addParam(p); c.Error != nil {
+			return c
+		}
+	}
+	return c
+}
+
+// addParam puts p in the typed field for it (or in .FeatureTags or
+// .Params)
+func (c *Contact) addParam(p *Param) error {
+	name := strings.ToLower(p.Param)
+	switch {
+	case name == "expires":
+		n, err := strconv.Atoi(p.Val)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: addParam err: invalid expires param: %s", ErrBadContact, p.Val)
+		}
+		c.Expires = n
+	case name == "q":
+		q, err := strconv.ParseFloat(p.Val, 64)
+		if err != nil || q < 0 || q > 1 {
+			return fmt.Errorf("%w: addParam err: invalid q param: %s", ErrBadContact, p.Val)
+		}
+		c.Q = q
+	case name == "+sip.instance":
+		c.Instance = unquoteStr(p.Val)
+	case name == "reg-id":
+		c.RegId = p.Val
+	case name == "pub-gruu":
+		c.PubGruu = unquoteStr(p.Val)
+	case name == "temp-gruu":
+		c.TempGruu = unquoteStr(p.Val)
+	case strings.HasPrefix(name, "+"), contactFeatureTags[name]:
+		c.FeatureTags = append(c.FeatureTags, p)
+	default:
+		c.Params = append(c.Params, p)
+	}
+	return nil
+}
+
+// String returns the contact rendered from its parsed fields.  The
+// uri is always enclosed in bracks.
+func (c *Contact) String() string {
+	if c.Wildcard {
+		return "*"
+	}
+	str := nameAddr(c.Name, c.URI)
+	if c.Q >= 0 {
+		str += ";q=" + strconv.FormatFloat(c.Q, 'f', -1, 64)
+	}
+	if c.Expires >= 0 {
+		str += ";expires=" + strconv.Itoa(c.Expires)
+	}
+	if c.Instance != "" {
+		str += ";+sip.instance=" + quoteStr(c.Instance)
+	}
+	if c.RegId != "" {
+		str += ";reg-id=" + c.RegId
+	}
+	if c.PubGruu != "" {
+		str += ";pub-gruu=" + quoteStr(c.PubGruu)
+	}
+	if c.TempGruu != "" {
+		str += ";temp-gruu=" + quoteStr(c.TempGruu)
+	}
+	for i := range c.FeatureTags {
+		str += ";" + c.FeatureTags[i].String()
+	}
+	for i := range c.Params {
+		str += ";" + c.Params[i].String()
+	}
+	return str
+}
+
+// parseContacts parses every Contact hdr into .Contacts and checks
+// that a wildcard is the only contact and is only sent with an
+// Expires hdr of 0 (RFC 3261 10.2.2)
+func (s *SipMsg) parseContacts() {
+	s.contactsParsed = true
+	wildcard := false
+	for _, raw := range s.RawHeaders {
+		if raw.Canonical != SIP_HDR_CONTACT {
+			continue
+		}
+		s.curHdr = raw
+		vals := splitList(cleanWs(raw.Val), ',')
+		if len(vals) == 0 {
+			s.hdrErr(SIP_HDR_CONTACT, fmt.Errorf("%w: parseContacts err: no contact in: %s", ErrBadContact, raw.Val))
+			continue
+		}
+		for _, val := range vals {
+			c := getContact(val)
+			if c.Error != nil {
+				s.hdrErr(SIP_HDR_CONTACT, c.Error)
+				continue
+			}
+			wildcard = wildcard || c.Wildcard
+			s.Contacts = append(s.Contacts, c)
+		}
+	}
+	s.curHdr = nil
+	if !wildcard {
+		return
+	}
+	switch {
+	case len(s.Contacts) != 1:
+		s.hdrErr(SIP_HDR_CONTACT, fmt.Errorf("%w: parseContacts err: wildcard contact with other contacts", ErrBadContact))
+	case s.GetHeader(SIP_HDR_EXPIRES) == nil || strings.TrimSpace(s.GetHeader(SIP_HDR_EXPIRES).Val) != "0":
+		s.hdrErr(SIP_HDR_CONTACT, fmt.Errorf("%w: parseContacts err: wildcard contact without an Expires hdr of 0", ErrBadContact))
+	}
+}
+
+// GetContacts returns every value of every Contact hdr in the order
+// they were received.  ParseMsg fills .Contacts unless the msg is
+// parsed in lazy mode, in which case the hdrs are parsed the first
+// time this is called.
+func (s *SipMsg) GetContacts() []*Contact {
+	if !s.contactsParsed {
+		s.parseContacts()
+	}
+	return s.Contacts
+}
+
+// IsWildcardContact returns true if the msg has the "*" contact
+func (s *SipMsg) IsWildcardContact() bool {
+	c := s.GetContacts()
+	return len(c) == 1 && c[0].Wildcard
+}
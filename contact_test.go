@@ -0,0 +1,96 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+)
+
+func TestContacts(t *testing.T) {
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds\r\n" +
+		"From: <sip:bob@biloxi.com>;tag=456248\r\n" +
+		"To: <sip:bob@biloxi.com>;tag=2493k59kd\r\n" +
+		"Call-ID: 843817637684230@998sdasdh09\r\n" +
+		"CSeq: 1826 REGISTER\r\n" +
+		"Contact: \"Bob, Jr\" <sip:bob@192.0.2.4;transport=tcp>;expires=3600;q=0.7;+sip.instance=\"<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>\";reg-id=1, <sip:bob@192.0.2.5>;expires=60;audio;+g.3gpp.icsi-ref=\"urn%3Aurn-7%3A3gpp-service.ims.icsi.mmtel\";foo=bar\r\n" +
+		"m: <sip:bob@192.0.2.6>;pub-gruu=\"sip:bob@biloxi.com;gr=urn:uuid:f81d4fae\";temp-gruu=\"sip:tgruu.7hs==@biloxi.com;gr\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	s := ParseMsg(msg)
+	if s.Error != nil {
+		t.Fatalf("[TestContacts] Error parsing msg.  Received: %s", s.Error.Error())
+	}
+	if len(s.Contacts) != 3 {
+		t.Fatalf("[TestContacts] ParseMsg should fill Contacts.  Received: %d", len(s.Contacts))
+	}
+	c := s.GetContacts()
+	if len(c) != 3 {
+		t.Fatalf("[TestContacts] Expected 3 contacts but received: %d", len(c))
+	}
+	if c[0].Name != "Bob, Jr" || c[0].URI.Host != "192.0.2.4" || c[0].URI.Transport() != "tcp" {
+		t.Errorf("[TestContacts] First contact name or uri was not parsed correctly.")
+	}
+	if c[0].Expires != 3600 || c[0].Q != 0.7 || c[0].Instance != "<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>" || c[0].RegId != "1" {
+		t.Errorf("[TestContacts] First contact params were not parsed correctly.")
+	}
+	if c[1].Expires != 60 || c[1].Q != -1 || len(c[1].FeatureTags) != 2 || len(c[1].Params) != 1 || c[1].Params[0].Param != "foo" {
+		t.Errorf("[TestContacts] Second contact params were not parsed correctly.")
+	}
+	if c[2].Expires != -1 || c[2].PubGruu != "sip:bob@biloxi.com;gr=urn:uuid:f81d4fae" || c[2].TempGruu != "sip:tgruu.7hs==@biloxi.com;gr" {
+		t.Errorf("[TestContacts] Gruu params were not parsed correctly.")
+	}
+	if c[0].String() != "\"Bob, Jr\" <sip:bob@192.0.2.4;transport=tcp>;q=0.7;expires=3600;+sip.instance=\"<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>\";reg-id=1" {
+		t.Errorf("[TestContacts] Unexpected contact.  Received: %q", c[0].String())
+	}
+	if len(ParseMsg(s.String()).GetContacts()) != 3 {
+		t.Errorf("[TestContacts] Contacts did not render correctly.  Received: %q", s.String())
+	}
+	if s.IsWildcardContact() {
+		t.Errorf("[TestContacts] Msg should not have a wildcard contact.")
+	}
+	if NewContact("", ParseURI("sip:a@b")).String() != "<sip:a@b>" {
+		t.Errorf("[TestContacts] A new contact should not have an expires or q param.")
+	}
+}
+
+func TestContactsWildcard(t *testing.T) {
+	base := "REGISTER sip:registrar.biloxi.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bKnashds7\r\n" +
+		"From: <sip:bob@biloxi.com>;tag=456248\r\n" +
+		"To: <sip:bob@biloxi.com>\r\n" +
+		"Call-ID: 843817637684230@998sdasdh09\r\n" +
+		"CSeq: 1826 REGISTER\r\n"
+	tests := []struct {
+		hdrs string
+		ok   bool
+	}{
+		{"Contact: *\r\nExpires: 0\r\n", true},
+		{"Contact: *\r\n", false},
+		{"Contact: *\r\nExpires: 3600\r\n", false},
+		{"Contact: *, <sip:bob@192.0.2.4>\r\nExpires: 0\r\n", false},
+		{"Contact: *\r\nContact: <sip:bob@192.0.2.4>\r\nExpires: 0\r\n", false},
+	}
+	for _, tt := range tests {
+		s := ParseMsg(base + tt.hdrs + "Content-Length: 0\r\n\r\n")
+		c := s.Contacts
+		if lazy := ParseMsgWithOptions(base+tt.hdrs+"Content-Length: 0\r\n\r\n", ParseOptions{Lazy: true}); lazy.Contacts != nil || len(lazy.GetContacts()) != len(c) {
+			t.Errorf("[TestContactsWildcard] %q should only be parsed by GetContacts in lazy mode.", tt.hdrs)
+		}
+		switch {
+		case tt.ok && (s.Error != nil || !s.IsWildcardContact()):
+			t.Errorf("[TestContactsWildcard] %q should be a valid wildcard contact.", tt.hdrs)
+		case !tt.ok && !errors.Is(s.Error, ErrBadContact):
+			t.Errorf("[TestContactsWildcard] %q should be an ErrBadContact.", tt.hdrs)
+		case len(c) == 0 || !c[0].Wildcard:
+			t.Errorf("[TestContactsWildcard] %q should have a wildcard contact first.", tt.hdrs)
+		}
+	}
+	s := ParseMsg(base + "Contact: <sip:bob@192.0.2.4>;q=2\r\nContent-Length: 0\r\n\r\n")
+	if len(s.GetContacts()) != 0 || !errors.Is(s.Error, ErrBadContact) {
+		t.Errorf("[TestContactsWildcard] A q param above 1 should be an ErrBadContact.")
+	}
+}
@@ -37,12 +37,19 @@ func (c *ContentDisposition) parse() {
 		c.DispType = c.Val
 		return
 	}
-	c.DispType = c.Val[0:charPos]
-	if len(c.Val)-1 > charPos {
-		params := strings.Split(c.Val[charPos+1:], ";")
-		for i := range params {
-			c.addParam(params[i])
-		}
+	c.DispType = trimLWS(c.Val[0:charPos])
+	params := splitList(c.Val[charPos+1:], ';')
+	for i := range params {
+		c.addParam(params[i])
 	}
-	return
+}
+
+// String returns the content-disposition rendered from its parsed
+// fields
+func (c *ContentDisposition) String() string {
+	str := c.DispType
+	for i := range c.Params {
+		str += ";" + c.Params[i].String()
+	}
+	return str
 }
@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -22,19 +22,24 @@ type Cseq struct {
 
 func (c *Cseq) parse() error {
 	if c.Val == "" {
-		return errors.New("Cseq.parse err: val can not be blank.")
+		return fmt.Errorf("%w: Cseq.parse err: val can not be blank.", ErrBadCSeq)
 	}
 	s := strings.IndexRune(c.Val, ' ')
 	if s == -1 {
-		return errors.New("Cseq.parse err: lws err with: " + c.Val)
+		return fmt.Errorf("%w: Cseq.parse err: lws err with: %s", ErrBadCSeq, c.Val)
 	}
 	if s == 0 {
-		return errors.New("Cseq.parse err: lws at pos 0 in val: " + c.Val)
+		return fmt.Errorf("%w: Cseq.parse err: lws at pos 0 in val: %s", ErrBadCSeq, c.Val)
 	}
 	if len(c.Val)-1 < s+1 {
-		return errors.New("Cseq.parse err: first lws is end of line in val: " + c.Val)
+		return fmt.Errorf("%w: Cseq.parse err: first lws is end of line in val: %s", ErrBadCSeq, c.Val)
 	}
 	c.Method = c.Val[s+1:]
 	c.Digit = c.Val[0:s]
 	return nil
 }
+
+// String returns the cseq as "digit method"
+func (c *Cseq) String() string {
+	return c.Digit + " " + c.Method
+}
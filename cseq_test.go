@@ -22,3 +22,11 @@ func TestCseq(t *testing.T) {
 		t.Errorf("[TestCseq] Error parsing cseq: \"100 INVITE\".  Method should be \"INVITE\".")
 	}
 }
+
+func TestCseqString(t *testing.T) {
+	c := &Cseq{Val: "100 INVITE"}
+	c.parse()
+	if c.String() != "100 INVITE" {
+		t.Errorf("[TestCseqString] Error rendering cseq.  Received: %q", c.String())
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strconv"
+)
+
+// DialogState is the state of a dialog (RFC 3261 12)
+type DialogState int
+
+const (
+	DIALOG_STATE_EARLY DialogState = iota
+	DIALOG_STATE_CONFIRMED
+	DIALOG_STATE_TERMINATED
+)
+
+// String returns the name of the state
+func (s DialogState) String() string {
+	switch s {
+	case DIALOG_STATE_EARLY:
+		return "Early"
+	case DIALOG_STATE_CONFIRMED:
+		return "Confirmed"
+	case DIALOG_STATE_TERMINATED:
+		return "Terminated"
+	}
+	return "Unknown"
+}
+
+// DialogId identifies a dialog (RFC 3261 12): the Call-ID and the
+// local and remote tags
+type DialogId struct {
+	CallId    string
+	LocalTag  string
+	RemoteTag string
+}
+
+// String returns the id as "callid;local;remote"
+func (id DialogId) String() string {
+	return id.CallId + ";" + id.LocalTag + ";" + id.RemoteTag
+}
+
+// RequestDialogId returns the id of the dialog that a received
+// request belongs to (the local tag is the To tag)
+func RequestDialogId(req *SipMsg) DialogId {
+	id := DialogId{CallId: req.CallId, LocalTag: toTag(req)}
+	if from := req.GetFrom(); from != nil {
+		id.RemoteTag = from.Tag
+	}
+	return id
+}
+
+// ResponseDialogId returns the id of the dialog that a received
+// response belongs to (the local tag is the From tag)
+func ResponseDialogId(resp *SipMsg) DialogId {
+	id := DialogId{CallId: resp.CallId, RemoteTag: toTag(resp)}
+	if from := resp.GetFrom(); from != nil {
+		id.LocalTag = from.Tag
+	}
+	return id
+}
+
+// Dialog is the state that a UA keeps for a dialog (RFC 3261 12) that
+// an INVITE (or SUBSCRIBE) created.  It checks the CSeq of the
+// requests that it receives and builds the requests that are sent in
+// it (see NewRequest).
+// The fields are as follows:
+// -- Id is the Call-ID and the local and remote tags
+// -- State is Early (a 101-199 response with a To tag) or Confirmed
+// (a 2xx or a NOTIFY) until it is Terminated
+// -- UAC is true if this side sent the request that created it
+// -- Method is the method of the request that created it
+// -- LocalSeq and RemoteSeq are the CSeq numbers of the last request
+// that was sent and received (-1 if none has been)
+// -- InviteSeq is the CSeq number of the last INVITE that was sent
+// (-1 if none has been), which is the CSeq number of its ACK
+// -- Local and Remote are the local and remote uris with their tags
+// (the From and To of the requests that are sent)
+// -- LocalTarget is the Contact that is sent in target refresh
+// requests
+// -- RemoteTarget is the Contact of the peer (the Request-URI of the
+// requests that are sent)
+// -- RouteSet is from the Record-Route hdrs (see SipMsg.RouteSet)
+// -- Secure is true if the request that created it had a sips
+// Request-URI
+// -- Via is the Via that requests are sent with (a copy with a new
+// branch for each request).  If nil a UDP Via from the local
+// hostname is used.
+type Dialog struct {
+	Id           DialogId
+	State        DialogState
+	UAC          bool
+	Method       string
+	LocalSeq     int
+	RemoteSeq    int
+	InviteSeq    int
+	Local        *From
+	Remote       *From
+	LocalTarget  *URI
+	RemoteTarget *URI
+	RouteSet     []*URI
+	Secure       bool
+	Via          *Via
+}
+
+// isTargetRefresh returns true for the methods that replace the
+// remote target of a dialog (RFC 3261 12.2, 3311, 3265 and 3515)
+func isTargetRefresh(method string) bool {
+	switch method {
+	case SIP_METHOD_INVITE, SIP_METHOD_UPDATE, SIP_METHOD_SUBSCRIBE, SIP_METHOD_NOTIFY, SIP_METHOD_REFER:
+		return true
+	}
+	return false
+}
+
+// contactURI returns a copy of the uri of the first Contact of the
+// msg (nil if it has none)
+func contactURI(msg *SipMsg) *URI {
+	if c := msg.GetContacts(); len(c) != 0 && c[0].URI != nil {
+		return c[0].URI.clone()
+	}
+	if c := msg.GetContact(); c != nil {
+		return c.URI.clone()
+	}
+	return nil
+}
+
+// cseqNum returns the CSeq number of the msg (-1 if it has none)
+func cseqNum(msg *SipMsg) int {
+	c := msg.GetCseq()
+	if c == nil {
+		return -1
+	}
+	n, err := strconv.Atoi(c.Digit)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// cseqMethod returns the CSeq method of the msg
+func cseqMethod(msg *SipMsg) string {
+	if c := msg.GetCseq(); c != nil {
+		return c.Method
+	}
+	return ""
+}
+
+// respCode returns the status code of a response (0 if msg is not
+// one)
+func respCode(msg *SipMsg) int {
+	if msg.StartLine == nil || msg.StartLine.Type != SIP_RESPONSE {
+		return 0
+	}
+	code, _ := strconv.Atoi(msg.StartLine.Resp)
+	return code
+}
+
+// NewDialogUAC returns the dialog that a response (101-299 with a To
+// tag) creates for the UAC that sent the request (RFC 3261 12.1.2).
+// The route set is the Record-Route hdrs of the response in reverse
+// order and the remote target is its Contact.
+func NewDialogUAC(req *SipMsg, resp *SipMsg) (*Dialog, error) {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return nil, fmt.Errorf("%w: NewDialogUAC err: msg is not a request", ErrDialog)
+	}
+	code := respCode(resp)
+	if code < 101 || code > 299 {
+		return nil, fmt.Errorf("%w: NewDialogUAC err: response can not create a dialog: %d", ErrDialog, code)
+	}
+	if toTag(resp) == "" {
+		return nil, fmt.Errorf("%w: NewDialogUAC err: response has no To tag", ErrDialog)
+	}
+	d := &Dialog{UAC: true, Method: req.StartLine.Method, RemoteSeq: -1, InviteSeq: -1}
+	d.Id = ResponseDialogId(resp)
+	d.Id.CallId = req.CallId
+	d.LocalSeq = cseqNum(req)
+	if d.Method == SIP_METHOD_INVITE {
+		d.InviteSeq = d.LocalSeq
+	}
+	d.Local = req.GetFrom().clone()
+	d.Remote = resp.GetTo().clone()
+	d.LocalTarget = contactURI(req)
+	d.RemoteTarget = contactURI(resp)
+	if d.RemoteTarget == nil {
+		if code >= 200 {
+			return nil, fmt.Errorf("%w: NewDialogUAC err: response has no Contact", ErrDialog)
+		}
+		// a provisional response without a Contact: keep sending to
+		// the Request-URI until one shows up
+		d.RemoteTarget = req.StartLine.URI.clone()
+	}
+	d.RouteSet = resp.RouteSet(true)
+	d.Secure = req.StartLine.URI != nil && req.StartLine.URI.Scheme == SIPS_SCHEME
+	d.Via = topVia(req).clone()
+	if code >= 200 {
+		d.State = DIALOG_STATE_CONFIRMED
+	}
+	return d, nil
+}
+
+// NewDialogUAS returns the dialog that a response (101-299 with a To
+// tag) that the UAS sends creates (RFC 3261 12.1.1).  The route set
+// is the Record-Route hdrs of the request in order and the remote
+// target is its Contact.
+func NewDialogUAS(req *SipMsg, resp *SipMsg) (*Dialog, error) {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return nil, fmt.Errorf("%w: NewDialogUAS err: msg is not a request", ErrDialog)
+	}
+	code := respCode(resp)
+	if code < 101 || code > 299 {
+		return nil, fmt.Errorf("%w: NewDialogUAS err: response can not create a dialog: %d", ErrDialog, code)
+	}
+	if toTag(resp) == "" {
+		return nil, fmt.Errorf("%w: NewDialogUAS err: response has no To tag", ErrDialog)
+	}
+	d := &Dialog{Method: req.StartLine.Method, LocalSeq: -1, InviteSeq: -1}
+	d.Id = DialogId{CallId: req.CallId, LocalTag: toTag(resp)}
+	d.Remote = req.GetFrom().clone()
+	if d.Remote != nil {
+		d.Id.RemoteTag = d.Remote.Tag
+	}
+	d.RemoteSeq = cseqNum(req)
+	d.Local = resp.GetTo().clone()
+	d.LocalTarget = contactURI(resp)
+	d.RemoteTarget = contactURI(req)
+	if d.RemoteTarget == nil {
+		return nil, fmt.Errorf("%w: NewDialogUAS err: request has no Contact", ErrDialog)
+	}
+	d.RouteSet = req.RouteSet(false)
+	d.Secure = req.StartLine.URI != nil && req.StartLine.URI.Scheme == SIPS_SCHEME
+	if code >= 200 {
+		d.State = DIALOG_STATE_CONFIRMED
+	}
+	return d, nil
+}
+
+// NewDialogNotify returns the dialog that a NOTIFY creates for the
+// subscriber that sent the SUBSCRIBE (RFC 6665 4.1.2.4).  The NOTIFY
+// can get to the subscriber before the 2xx to the SUBSCRIBE and
+// there is one dialog for each notifier that a forked SUBSCRIBE
+// reached.  The route set and remote target come from the NOTIFY the
+// way a UAS gets them from a request.
+func NewDialogNotify(subscribe *SipMsg, notify *SipMsg) (*Dialog, error) {
+	if subscribe.StartLine == nil || subscribe.StartLine.Type != SIP_REQUEST {
+		return nil, fmt.Errorf("%w: NewDialogNotify err: msg is not a request", ErrDialog)
+	}
+	if notify.StartLine == nil || notify.StartLine.Type != SIP_REQUEST || notify.StartLine.Method != SIP_METHOD_NOTIFY {
+		return nil, fmt.Errorf("%w: NewDialogNotify err: msg is not a NOTIFY", ErrDialog)
+	}
+	d := &Dialog{UAC: true, Method: subscribe.StartLine.Method, State: DIALOG_STATE_CONFIRMED, InviteSeq: -1}
+	d.Id = RequestDialogId(notify)
+	from := subscribe.GetFrom()
+	if from == nil || notify.CallId != subscribe.CallId || d.Id.LocalTag == "" || d.Id.LocalTag != from.Tag {
+		return nil, fmt.Errorf("%w: NewDialogNotify err: NOTIFY does not match the SUBSCRIBE", ErrDialog)
+	}
+	if d.Id.RemoteTag == "" {
+		return nil, fmt.Errorf("%w: NewDialogNotify err: NOTIFY has no From tag", ErrDialog)
+	}
+	d.LocalSeq = cseqNum(subscribe)
+	d.RemoteSeq = cseqNum(notify)
+	d.Local = from.clone()
+	d.Remote = notify.GetFrom().clone()
+	d.LocalTarget = contactURI(subscribe)
+	d.RemoteTarget = contactURI(notify)
+	if d.RemoteTarget == nil {
+		return nil, fmt.Errorf("%w: NewDialogNotify err: NOTIFY has no Contact", ErrDialog)
+	}
+	d.RouteSet = notify.RouteSet(false)
+	d.Secure = subscribe.StartLine.URI != nil && subscribe.StartLine.URI.Scheme == SIPS_SCHEME
+	d.Via = topVia(subscribe).clone()
+	return d, nil
+}
+
+// ReceiveRequest updates the dialog for a request that was received
+// in it (RFC 3261 12.2.2).  It returns an error that wraps ErrDialog
+// if the request is out of order (the UAS responds with a 500) or the
+// dialog is terminated (a 481).  A target refresh request replaces
+// the remote target and a BYE terminates the dialog.
+func (d *Dialog) ReceiveRequest(req *SipMsg) error {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return fmt.Errorf("%w: ReceiveRequest err: msg is not a request", ErrDialog)
+	}
+	if d.State == DIALOG_STATE_TERMINATED {
+		return fmt.Errorf("%w: ReceiveRequest err: dialog is terminated", ErrDialog)
+	}
+	method := req.StartLine.Method
+	seq := cseqNum(req)
+	if seq == -1 {
+		return fmt.Errorf("%w: ReceiveRequest err: request has no CSeq", ErrDialog)
+	}
+	if method != SIP_METHOD_ACK && method != SIP_METHOD_CANCEL {
+		if d.RemoteSeq != -1 && seq < d.RemoteSeq {
+			return fmt.Errorf("%w: ReceiveRequest err: CSeq %d is lower than %d", ErrDialog, seq, d.RemoteSeq)
+		}
+		d.RemoteSeq = seq
+	}
+	if isTargetRefresh(method) {
+		if u := contactURI(req); u != nil {
+			d.RemoteTarget = u
+		}
+	}
+	if method == SIP_METHOD_BYE {
+		d.State = DIALOG_STATE_TERMINATED
+	}
+	return nil
+}
+
+// ReceiveResponse updates the dialog for a response to a request that
+// was sent in it (or to the request that created it):
+// -- a 2xx to the request that created an early dialog confirms it
+// and the route set is recomputed from it (RFC 3261 13.2.2.4)
+// -- a response with a Contact to a target refresh request replaces
+// the remote target (only a 2xx once the dialog is confirmed)
+// -- a 481 or 408 terminates the dialog (RFC 3261 12.2.1.2)
+func (d *Dialog) ReceiveResponse(resp *SipMsg) {
+	code := respCode(resp)
+	if code == 0 || d.State == DIALOG_STATE_TERMINATED {
+		return
+	}
+	method := cseqMethod(resp)
+	switch {
+	case code == 481 || code == 408:
+		d.State = DIALOG_STATE_TERMINATED
+		return
+	case code >= 300:
+		if d.State == DIALOG_STATE_EARLY && method == d.Method {
+			d.State = DIALOG_STATE_TERMINATED
+		}
+		return
+	case code >= 200 && d.State == DIALOG_STATE_EARLY && method == d.Method:
+		d.State = DIALOG_STATE_CONFIRMED
+		if d.UAC {
+			d.RouteSet = resp.RouteSet(true)
+		}
+	case code < 200 && d.State == DIALOG_STATE_CONFIRMED:
+		return
+	}
+	if isTargetRefresh(method) {
+		if u := contactURI(resp); u != nil {
+			d.RemoteTarget = u
+		}
+	}
+}
+
+// SendResponse updates the dialog of a UAS for a response that it
+// sends to the request that created the dialog: a 2xx confirms an
+// early dialog and a 300-699 terminates it.
+func (d *Dialog) SendResponse(resp *SipMsg) {
+	code := respCode(resp)
+	if d.State != DIALOG_STATE_EARLY || cseqMethod(resp) != d.Method {
+		return
+	}
+	switch {
+	case code >= 300:
+		d.State = DIALOG_STATE_TERMINATED
+	case code >= 200:
+		d.State = DIALOG_STATE_CONFIRMED
+	}
+}
+
+// NewRequest builds a request within the dialog (RFC 3261 12.2.1.1):
+// -- the From and To are the local and remote uris with their tags
+// and the Call-ID is the one of the dialog
+// -- the CSeq is one more than the last one sent (an ACK has the
+// CSeq number of the last INVITE that was sent, see InviteSeq)
+// -- the Request-URI and Route hdrs come from the route set and the
+// remote target (see ApplyRouteSet)
+// -- target refresh requests (i.e. a re-INVITE or UPDATE) get a
+// Contact with the local target
+// Sending a BYE terminates the dialog (RFC 3261 15.1.1) so NewRequest
+// moves it to Terminated for a BYE.  It returns an error that wraps
+// ErrDialog if the dialog is terminated, for a CANCEL (which is built
+// from the request it cancels with NewCancel) and for an ACK before
+// an INVITE was sent in the dialog.
+func (d *Dialog) NewRequest(method string) (*SipMsg, error) {
+	switch {
+	case d.State == DIALOG_STATE_TERMINATED:
+		return nil, fmt.Errorf("%w: NewRequest err: dialog is terminated", ErrDialog)
+	case method == SIP_METHOD_CANCEL:
+		return nil, fmt.Errorf("%w: NewRequest err: a CANCEL has to be built with NewCancel", ErrDialog)
+	case method == SIP_METHOD_ACK && d.InviteSeq < 0:
+		return nil, fmt.Errorf("%w: NewRequest err: no INVITE was sent for the ACK", ErrDialog)
+	}
+	s := &SipMsg{}
+	s.StartLine = &StartLine{Type: SIP_REQUEST, Method: method, Proto: SIP_PROTO, Version: SIP_VERSION}
+	s.ApplyRouteSet(d.RouteSet, d.RemoteTarget)
+	if d.Via != nil {
+		v := d.Via.clone()
+		v.Branch = NewBranch()
+		v.Received, v.RPort, v.rport = "", "", false
+		v.Via = v.String()
+		s.Via = []*Via{v}
+	} else {
+		s.Via = []*Via{NewVia("UDP", localHost())}
+	}
+	s.From = d.Local.clone()
+	s.To = d.Remote.clone()
+	s.CallId = d.Id.CallId
+	seq := d.InviteSeq
+	if method != SIP_METHOD_ACK {
+		if d.LocalSeq < 0 {
+			d.LocalSeq = 0
+		}
+		d.LocalSeq++
+		seq = d.LocalSeq
+	}
+	if method == SIP_METHOD_INVITE {
+		d.InviteSeq = seq
+	}
+	s.Cseq = NewCseq(seq, method)
+	s.MaxForwards = defaultMaxForwards
+	s.MaxForwardsInt = 70
+	if isTargetRefresh(method) && d.LocalTarget != nil {
+		s.Contact = NewFrom("", d.LocalTarget.clone())
+	}
+	s.ContentLength = "0"
+	if method == SIP_METHOD_BYE {
+		d.State = DIALOG_STATE_TERMINATED
+	}
+	return s, nil
+}
+
+// DialogSet holds the dialogs that the responses to a request that
+// was sent create: a forked INVITE can get provisional responses
+// (early dialogs) and even 2xx responses from more than one UAS, each
+// with its own To tag (RFC 3261 12.1.2 and 13.2.2.4).
+// The fields are as follows:
+// -- Request is the request that was sent
+// -- Dialogs are the dialogs in the order they were created
+type DialogSet struct {
+	Request *SipMsg
+	Dialogs []*Dialog
+}
+
+// NewDialogSet returns a *DialogSet for the request
+func NewDialogSet(req *SipMsg) *DialogSet {
+	return &DialogSet{Request: req}
+}
+
+// Dialog returns the dialog with the remote tag (nil if there is
+// none)
+func (ds *DialogSet) Dialog(remoteTag string) *Dialog {
+	for _, d := range ds.Dialogs {
+		if d.Id.RemoteTag == remoteTag {
+			return d
+		}
+	}
+	return nil
+}
+
+// Update handles a response to the request.  A 101-299 response
+// with a To tag creates a dialog (or updates the one with that tag)
+// which is returned.  A 300-699 response terminates every dialog that
+// is still early (the request failed) and nil is returned, as it is
+// for a response that does not belong to a dialog (i.e. a 100).
+func (ds *DialogSet) Update(resp *SipMsg) (*Dialog, error) {
+	code := respCode(resp)
+	if code == 0 {
+		return nil, fmt.Errorf("%w: Update err: msg is not a response", ErrDialog)
+	}
+	if code >= 300 {
+		for _, d := range ds.Dialogs {
+			if d.State == DIALOG_STATE_EARLY {
+				d.State = DIALOG_STATE_TERMINATED
+			}
+		}
+		return nil, nil
+	}
+	tag := toTag(resp)
+	if code == 100 || tag == "" {
+		return nil, nil
+	}
+	if d := ds.Dialog(tag); d != nil {
+		d.ReceiveResponse(resp)
+		return d, nil
+	}
+	d, err := NewDialogUAC(ds.Request, resp)
+	if err != nil {
+		return nil, err
+	}
+	ds.Dialogs = append(ds.Dialogs, d)
+	return d, nil
+}
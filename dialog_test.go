@@ -0,0 +1,242 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// testDialogResponse returns a response to req with the To tag (if
+// not blank) and a Contact for the uri (if not blank)
+func testDialogResponse(req *SipMsg, code int, tag string, contact string) *SipMsg {
+	resp := NewResponse(req, code, "")
+	if tag != "" {
+		resp.To.Tag = tag
+		resp.To.Val = resp.To.String()
+	}
+	if contact != "" {
+		resp.Contact = NewFrom("", ParseURI(contact))
+	}
+	return resp
+}
+
+// testWire returns the msg as it is received on the other side
+func testWire(msg *SipMsg) *SipMsg {
+	return ParseMsg(msg.String())
+}
+
+func TestDialogInvite(t *testing.T) {
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	inv.Contact = NewFrom("", ParseURI("sip:alice@pc33.atlanta.com"))
+	rx := testWire(inv)
+	// the proxies record-route on the way to bob
+	rx.RecordRoute = []*URI{ParseURI("sip:p2.biloxi.com;lr"), ParseURI("sip:p1.atlanta.com;lr")}
+	ringing := testDialogResponse(rx, 180, "", "sip:bob@192.0.2.4")
+	uas, err := NewDialogUAS(rx, ringing)
+	if err != nil {
+		t.Fatalf("[TestDialogInvite] Error creating the uas dialog: %s", err)
+	}
+	if uas.State != DIALOG_STATE_EARLY || uas.RemoteSeq != 1 || uas.LocalSeq != -1 || uas.RemoteTarget.Host != "pc33.atlanta.com" {
+		t.Errorf("[TestDialogInvite] The uas dialog is wrong: %+v", uas)
+	}
+	if len(uas.RouteSet) != 2 || uas.RouteSet[0].Host != "p2.biloxi.com" {
+		t.Errorf("[TestDialogInvite] The uas route set should be the record-route in order.")
+	}
+	uac, err := NewDialogUAC(inv, testWire(ringing))
+	if err != nil {
+		t.Fatalf("[TestDialogInvite] Error creating the uac dialog: %s", err)
+	}
+	if uac.State != DIALOG_STATE_EARLY || uac.LocalSeq != 1 || uac.RemoteSeq != -1 || uac.RemoteTarget.Host != "192.0.2.4" {
+		t.Errorf("[TestDialogInvite] The uac dialog is wrong: %+v", uac)
+	}
+	if len(uac.RouteSet) != 2 || uac.RouteSet[0].Host != "p1.atlanta.com" {
+		t.Errorf("[TestDialogInvite] The uac route set should be the record-route in reverse order.")
+	}
+	if uac.Id != (DialogId{CallId: uas.Id.CallId, LocalTag: uas.Id.RemoteTag, RemoteTag: uas.Id.LocalTag}) {
+		t.Errorf("[TestDialogInvite] The dialog ids do not match: %s and %s", uac.Id, uas.Id)
+	}
+	ok := testDialogResponse(rx, 200, ringing.To.Tag, "sip:bob@192.0.2.4")
+	uas.SendResponse(ok)
+	uac.ReceiveResponse(testWire(ok))
+	if uas.State != DIALOG_STATE_CONFIRMED || uac.State != DIALOG_STATE_CONFIRMED {
+		t.Errorf("[TestDialogInvite] A 2xx should confirm the dialogs.  Received: %s and %s", uac.State, uas.State)
+	}
+	ack, err := uac.NewRequest(SIP_METHOD_ACK)
+	if err != nil {
+		t.Fatalf("[TestDialogInvite] Error building the ACK: %s", err)
+	}
+	if ack.Cseq.Val != "1 ACK" || ack.StartLine.URI.String() != "sip:bob@192.0.2.4" || len(ack.Route) != 2 || ack.Route[0].Host != "p1.atlanta.com" {
+		t.Errorf("[TestDialogInvite] The ACK is wrong: %q", ack.String())
+	}
+	if ack.Contact != nil || ack.To.Tag != ringing.To.Tag || ack.From.Tag != inv.From.Tag || ack.CallId != inv.CallId {
+		t.Errorf("[TestDialogInvite] The ACK is wrong: %q", ack.String())
+	}
+	if err := uas.ReceiveRequest(testWire(ack)); err != nil || uas.RemoteSeq != 1 {
+		t.Errorf("[TestDialogInvite] The uas should accept the ACK.  Received: %v", err)
+	}
+	for i, method := range []string{SIP_METHOD_INVITE, SIP_METHOD_UPDATE, SIP_METHOD_INFO} {
+		req, _ := uac.NewRequest(method)
+		if req.Cseq.Digit != strconv.Itoa(i+2) || req.Cseq.Method != method {
+			t.Errorf("[TestDialogInvite] The %s should have CSeq %d.  Received: %q", method, i+2, req.Cseq.Val)
+		}
+		if (req.Contact != nil) != (method != SIP_METHOD_INFO) {
+			t.Errorf("[TestDialogInvite] Only target refresh requests should have a Contact.  Received one for %s: %t", method, req.Contact != nil)
+		}
+		if req.Via[0].Branch == inv.Via[0].Branch || !isRFC3261Branch(req.Via[0].Branch) {
+			t.Errorf("[TestDialogInvite] Each request should have a new branch.")
+		}
+		if err := uas.ReceiveRequest(testWire(req)); err != nil {
+			t.Errorf("[TestDialogInvite] The uas should accept the %s.  Received: %s", method, err)
+		}
+	}
+	// the UPDATE and INFO went out after the re-INVITE so its ACK
+	// has the CSeq of the re-INVITE
+	if ack, err := uac.NewRequest(SIP_METHOD_ACK); err != nil || ack.Cseq.Val != "2 ACK" || uac.LocalSeq != 4 {
+		t.Errorf("[TestDialogInvite] The ACK should have the CSeq of the last INVITE.  Received: %v", err)
+	}
+	// a re-INVITE from bob moves him
+	if _, err := uas.NewRequest(SIP_METHOD_ACK); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogInvite] An ACK before any request was sent should be an ErrDialog.")
+	}
+	reinv, _ := uas.NewRequest(SIP_METHOD_INVITE)
+	uas.LocalTarget = ParseURI("sip:bob@192.0.2.5")
+	reinv2, _ := uas.NewRequest(SIP_METHOD_INVITE)
+	if reinv.Cseq.Val != "1 INVITE" || reinv2.Cseq.Val != "2 INVITE" || reinv.StartLine.URI.Host != "pc33.atlanta.com" || reinv.Route[0].Host != "p2.biloxi.com" {
+		t.Errorf("[TestDialogInvite] The re-INVITE from the uas is wrong: %q", reinv.String())
+	}
+	if err := uac.ReceiveRequest(testWire(reinv2)); err != nil || uac.RemoteSeq != 2 || uac.RemoteTarget.Host != "192.0.2.5" {
+		t.Errorf("[TestDialogInvite] A re-INVITE should refresh the remote target.  Received: %v", err)
+	}
+	if err := uac.ReceiveRequest(testWire(reinv)); !errors.Is(err, ErrDialog) || uac.RemoteSeq != 2 {
+		t.Errorf("[TestDialogInvite] A request with a lower CSeq should be out of order.  Received: %v", err)
+	}
+	if _, err := uac.NewRequest(SIP_METHOD_CANCEL); !errors.Is(err, ErrDialog) || uac.LocalSeq != 4 {
+		t.Errorf("[TestDialogInvite] A CANCEL should be built with NewCancel.  Received: %v", err)
+	}
+	bye, _ := uac.NewRequest(SIP_METHOD_BYE)
+	if bye.Cseq.Val != "5 BYE" || uac.State != DIALOG_STATE_TERMINATED || bye.StartLine.URI.Host != "192.0.2.5" {
+		t.Errorf("[TestDialogInvite] Sending a BYE should terminate the dialog.  Received: %q", bye.String())
+	}
+	if _, err := uac.NewRequest(SIP_METHOD_INVITE); !errors.Is(err, ErrDialog) || uac.LocalSeq != 5 {
+		t.Errorf("[TestDialogInvite] A terminated dialog should not build requests.  Received: %v", err)
+	}
+	if err := uas.ReceiveRequest(testWire(bye)); err != nil || uas.State != DIALOG_STATE_TERMINATED {
+		t.Errorf("[TestDialogInvite] Receiving a BYE should terminate the dialog.  Received: %v", err)
+	}
+	if err := uas.ReceiveRequest(testWire(bye)); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogInvite] A terminated dialog should not accept requests.")
+	}
+}
+
+func TestDialogErrors(t *testing.T) {
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	if _, err := NewDialogUAC(inv, NewResponse(inv, 100, "")); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogErrors] A 100 should not create a dialog.")
+	}
+	if _, err := NewDialogUAC(inv, NewResponse(inv, 486, "")); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogErrors] A 486 should not create a dialog.")
+	}
+	if _, err := NewDialogUAC(inv, NewResponse(inv, 200, "")); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogErrors] A 2xx without a Contact should not create a dialog.")
+	}
+	if _, err := NewDialogUAS(inv, NewResponse(inv, 200, "")); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogErrors] A request without a Contact should not create a dialog.")
+	}
+	d, err := NewDialogUAC(inv, NewResponse(inv, 183, ""))
+	if err != nil || d.RemoteTarget.Host != "biloxi.com" {
+		t.Fatalf("[TestDialogErrors] A 183 without a Contact should use the Request-URI.  Received: %v", err)
+	}
+	d.ReceiveResponse(testDialogResponse(inv, 180, d.Id.RemoteTag, "sip:bob@192.0.2.4"))
+	if d.RemoteTarget.Host != "192.0.2.4" || d.State != DIALOG_STATE_EARLY {
+		t.Errorf("[TestDialogErrors] A provisional response should refresh the target of an early dialog.")
+	}
+	d.ReceiveResponse(testDialogResponse(inv, 481, d.Id.RemoteTag, ""))
+	if d.State != DIALOG_STATE_TERMINATED {
+		t.Errorf("[TestDialogErrors] A 481 should terminate the dialog.")
+	}
+	sips := NewRequest(SIP_METHOD_INVITE, ParseURI("sips:bob@biloxi.com"))
+	if d, err := NewDialogUAC(sips, testDialogResponse(sips, 200, "", "sips:bob@192.0.2.4")); err != nil || !d.Secure {
+		t.Errorf("[TestDialogErrors] A sips Request-URI should create a secure dialog.")
+	}
+}
+
+func TestDialogFork(t *testing.T) {
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	inv.Contact = NewFrom("", ParseURI("sip:alice@pc33.atlanta.com"))
+	ds := NewDialogSet(inv)
+	if d, err := ds.Update(NewResponse(inv, 100, "")); d != nil || err != nil {
+		t.Errorf("[TestDialogFork] A 100 should not create a dialog.")
+	}
+	a, _ := ds.Update(testDialogResponse(inv, 180, "a", "sip:bob@192.0.2.4"))
+	b, _ := ds.Update(testDialogResponse(inv, 183, "b", "sip:bob@192.0.2.5"))
+	if a == nil || b == nil || a == b || len(ds.Dialogs) != 2 {
+		t.Fatalf("[TestDialogFork] Each To tag should create its own early dialog.")
+	}
+	if again, _ := ds.Update(testDialogResponse(inv, 180, "a", "sip:bob@192.0.2.4")); again != a || len(ds.Dialogs) != 2 {
+		t.Errorf("[TestDialogFork] A response with a known To tag should update its dialog.")
+	}
+	if d, _ := ds.Update(testDialogResponse(inv, 200, "b", "sip:bob@192.0.2.5")); d != b || b.State != DIALOG_STATE_CONFIRMED || a.State != DIALOG_STATE_EARLY {
+		t.Errorf("[TestDialogFork] A 2xx should confirm only its own dialog.")
+	}
+	if d, _ := ds.Update(testDialogResponse(inv, 200, "c", "sip:carol@192.0.2.6")); d == nil || d.State != DIALOG_STATE_CONFIRMED || len(ds.Dialogs) != 3 {
+		t.Errorf("[TestDialogFork] A 2xx from another branch should create another dialog.")
+	}
+	if ds.Dialog("c").RemoteTarget.User != "carol" || ds.Dialog("x") != nil {
+		t.Errorf("[TestDialogFork] Dialog should find a dialog by its remote tag.")
+	}
+	fail := NewDialogSet(inv)
+	a, _ = fail.Update(testDialogResponse(inv, 180, "a", "sip:bob@192.0.2.4"))
+	b, _ = fail.Update(testDialogResponse(inv, 180, "b", "sip:bob@192.0.2.5"))
+	if d, err := fail.Update(NewResponse(inv, 486, "")); d != nil || err != nil || a.State != DIALOG_STATE_TERMINATED || b.State != DIALOG_STATE_TERMINATED {
+		t.Errorf("[TestDialogFork] A non-2xx final response should terminate every early dialog.")
+	}
+}
+
+func TestDialogNotify(t *testing.T) {
+	sub := NewRequest(SIP_METHOD_SUBSCRIBE, ParseURI("sip:bob@biloxi.com"))
+	sub.Contact = NewFrom("", ParseURI("sip:alice@pc33.atlanta.com"))
+	notify := NewRequest(SIP_METHOD_NOTIFY, ParseURI("sip:alice@pc33.atlanta.com"))
+	notify.CallId = sub.CallId
+	notify.From = NewFrom("", ParseURI("sip:bob@biloxi.com"))
+	notify.From.Tag = "4fe21"
+	notify.From.Val = notify.From.String()
+	notify.To = sub.From.clone()
+	notify.Contact = NewFrom("", ParseURI("sip:bob@192.0.2.4"))
+	notify.RecordRoute = []*URI{ParseURI("sip:p1.biloxi.com;lr")}
+	d, err := NewDialogNotify(sub, testWire(notify))
+	if err != nil {
+		t.Fatalf("[TestDialogNotify] Error creating the dialog: %s", err)
+	}
+	if d.State != DIALOG_STATE_CONFIRMED || d.Id.RemoteTag != "4fe21" || d.Id.LocalTag != sub.From.Tag || d.RemoteSeq != 1 || d.RemoteTarget.Host != "192.0.2.4" {
+		t.Errorf("[TestDialogNotify] The dialog is wrong: %+v", d)
+	}
+	refresh, _ := d.NewRequest(SIP_METHOD_SUBSCRIBE)
+	if refresh.Cseq.Val != "2 SUBSCRIBE" || refresh.Contact == nil || refresh.StartLine.URI.Host != "192.0.2.4" || len(refresh.Route) != 1 {
+		t.Errorf("[TestDialogNotify] The refresh SUBSCRIBE is wrong: %q", refresh.String())
+	}
+	notify.CallId = "other"
+	if _, err := NewDialogNotify(sub, testWire(notify)); !errors.Is(err, ErrDialog) {
+		t.Errorf("[TestDialogNotify] A NOTIFY for another SUBSCRIBE should not create a dialog.")
+	}
+}
+
+func TestDialogId(t *testing.T) {
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	resp := testDialogResponse(inv, 200, "b0b", "")
+	if id := ResponseDialogId(resp); id.LocalTag != inv.From.Tag || id.RemoteTag != "b0b" || id.CallId != inv.CallId {
+		t.Errorf("[TestDialogId] The response dialog id is wrong: %s", id)
+	}
+	req := inv
+	req.To = resp.To
+	if id := RequestDialogId(req); id.LocalTag != "b0b" || id.RemoteTag != inv.From.Tag {
+		t.Errorf("[TestDialogId] The request dialog id is wrong: %s", id)
+	}
+	if s := (DialogId{"c", "l", "r"}).String(); s != "c;l;r" {
+		t.Errorf("[TestDialogId] String should return \"c;l;r\".  Received: %s", s)
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DIGEST_SCHEME = "Digest"
+	// The digest algorithms (RFC 3261 22.4 and RFC 8760).  A "-sess"
+	// algorithm hashes the nonce and cnonce into the HA1.
+	DIGEST_ALG_MD5             = "MD5"
+	DIGEST_ALG_MD5_SESS        = "MD5-sess"
+	DIGEST_ALG_SHA256          = "SHA-256"
+	DIGEST_ALG_SHA256_SESS     = "SHA-256-sess"
+	DIGEST_ALG_SHA512_256      = "SHA-512-256"
+	DIGEST_ALG_SHA512_256_SESS = "SHA-512-256-sess"
+	DIGEST_QOP_AUTH            = "auth"
+	DIGEST_QOP_AUTH_INT        = "auth-int"
+)
+
+// digestHashes are the hash functions for the algorithms (without the
+// "-sess" suffix) in lower case
+var digestHashes = map[string]func() hash.Hash{
+	"md5":         md5.New,
+	"sha-256":     sha256.New,
+	"sha-512-256": sha512.New512_256,
+}
+
+// digestHash returns the hash function for the algorithm (MD5 if it
+// is blank) and whether it is a "-sess" algorithm
+func digestHash(alg string) (func() hash.Hash, bool, error) {
+	if alg == "" {
+		alg = DIGEST_ALG_MD5
+	}
+	alg = strings.ToLower(alg)
+	sess := strings.HasSuffix(alg, "-sess")
+	h, ok := digestHashes[strings.TrimSuffix(alg, "-sess")]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrDigestAlgorithm, alg)
+	}
+	return h, sess, nil
+}
+
+// digestHex returns the lower case hex hash of the parts joined by ":"
+func digestHex(h func() hash.Hash, parts ...string) string {
+	d := h()
+	for i := range parts {
+		if i != 0 {
+			d.Write([]byte{':'})
+		}
+		d.Write([]byte(parts[i]))
+	}
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// DigestHA1 returns the HA1 (H(username:realm:password)) for the
+// algorithm.  It is what a DigestStore can keep instead of the
+// password.  For a "-sess" algorithm it is the HA1 before the nonce
+// and cnonce are hashed in.
+func DigestHA1(alg string, username string, realm string, password string) (string, error) {
+	h, _, err := digestHash(alg)
+	if err != nil {
+		return "", err
+	}
+	return digestHex(h, username, realm, password), nil
+}
+
+// DigestParams are the values that go into a digest response
+// The fields are as follows:
+// -- Algorithm is the algorithm (MD5 if blank)
+// -- Nonce and CNonce are the server and client nonces
+// -- NC is the nonce count as 8 hex digits (i.e. "00000001")
+// -- QOP is the qop (blank for an RFC 2069 style response)
+// -- Method and URI are the method and Request-URI of the request
+// -- Body is the body of the request (only used for auth-int)
+type DigestParams struct {
+	Algorithm string
+	Nonce     string
+	CNonce    string
+	NC        string
+	QOP       string
+	Method    string
+	URI       string
+	Body      string
+}
+
+// DigestResponse returns the response param for the HA1 and params
+// (RFC 2617 3.2.2.1 with the hash of the algorithm)
+func DigestResponse(ha1 string, p *DigestParams) (string, error) {
+	h, sess, err := digestHash(p.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if sess {
+		ha1 = digestHex(h, ha1, p.Nonce, p.CNonce)
+	}
+	var ha2 string
+	switch strings.ToLower(p.QOP) {
+	case DIGEST_QOP_AUTH_INT:
+		ha2 = digestHex(h, p.Method, p.URI, digestHex(h, p.Body))
+	case "", DIGEST_QOP_AUTH:
+		ha2 = digestHex(h, p.Method, p.URI)
+	default:
+		return "", fmt.Errorf("%w: DigestResponse err: unsupported qop: %s", ErrBadAuthorization, p.QOP)
+	}
+	if p.QOP == "" {
+		return digestHex(h, ha1, p.Nonce, ha2), nil
+	}
+	return digestHex(h, ha1, p.Nonce, p.NC, p.CNonce, strings.ToLower(p.QOP), ha2), nil
+}
+
+// qop returns the qop of credentials or "" if there isn't one
+func (a *Authorization) qop() string {
+	if len(a.Qop) == 0 {
+		return ""
+	}
+	return a.Qop[0]
+}
+
+// isDigest returns true if the credentials or challenge are for the
+// Digest scheme
+func (a *Authorization) isDigest() bool {
+	return a != nil && strings.EqualFold(a.Credentials, DIGEST_SCHEME)
+}
+
+// DigestClient answers the 401 and 407 challenges for a user.  It
+// counts how many times it has used each nonce so that the nc param
+// goes up with each request.  It is safe for concurrent use.
+type DigestClient struct {
+	Username string
+	Password string
+	mu       sync.Mutex
+	nc       map[string]uint32
+}
+
+// NewDigestClient returns a *DigestClient for the username and password
+func NewDigestClient(username string, password string) *DigestClient {
+	return &DigestClient{Username: username, Password: password, nc: make(map[string]uint32)}
+}
+
+// nextNC returns the next nonce count for the nonce
+func (c *DigestClient) nextNC(nonce string) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nc == nil {
+		c.nc = make(map[string]uint32)
+	}
+	c.nc[nonce]++
+	return c.nc[nonce]
+}
+
+// chooseQop picks the qop to answer a challenge with.  auth is used
+// if it is offered and auth-int if it is the only one.  "" is
+// returned for a challenge without a qop (RFC 2069).
+func chooseQop(qop []string) (string, error) {
+	if len(qop) == 0 {
+		return "", nil
+	}
+	authInt := false
+	for _, q := range qop {
+		switch strings.ToLower(q) {
+		case DIGEST_QOP_AUTH:
+			return DIGEST_QOP_AUTH, nil
+		case DIGEST_QOP_AUTH_INT:
+			authInt = true
+		}
+	}
+	if authInt {
+		return DIGEST_QOP_AUTH_INT, nil
+	}
+	return "", fmt.Errorf("%w: chooseQop err: no supported qop in: %s", ErrBadAuthorization, strings.Join(qop, ","))
+}
+
+// Answer returns the credentials (for an Authorization or
+// Proxy-Authorization hdr) that answer the challenge (a
+// WWW-Authenticate or Proxy-Authenticate hdr) for the request
+func (c *DigestClient) Answer(chal *Authorization, req *SipMsg) (*Authorization, error) {
+	if !chal.isDigest() {
+		return nil, fmt.Errorf("%w: Answer err: not a digest challenge", ErrBadAuthorization)
+	}
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST || req.StartLine.URI == nil {
+		return nil, fmt.Errorf("%w: Answer err: msg is not a request", ErrBadStartLine)
+	}
+	if chal.Nonce == "" {
+		return nil, fmt.Errorf("%w: Answer err: no nonce in challenge", ErrBadAuthorization)
+	}
+	qop, err := chooseQop(chal.Qop)
+	if err != nil {
+		return nil, err
+	}
+	ha1, err := DigestHA1(chal.Algorithm, c.Username, chal.Realm, c.Password)
+	if err != nil {
+		return nil, err
+	}
+	p := &DigestParams{
+		Algorithm: chal.Algorithm,
+		Nonce:     chal.Nonce,
+		QOP:       qop,
+		Method:    req.StartLine.Method,
+		URI:       req.StartLine.URI.String(),
+		Body:      req.Body,
+	}
+	if qop != "" {
+		p.CNonce = randHex(8)
+		p.NC = fmt.Sprintf("%08x", c.nextNC(chal.Nonce))
+	}
+	resp, err := DigestResponse(ha1, p)
+	if err != nil {
+		return nil, err
+	}
+	a := &Authorization{Credentials: DIGEST_SCHEME}
+	a.Params = []*Param{
+		{Param: "username", Val: c.Username},
+		{Param: "realm", Val: chal.Realm},
+		{Param: "nonce", Val: chal.Nonce},
+		{Param: "uri", Val: p.URI},
+		{Param: "response", Val: resp},
+	}
+	if p.Algorithm != "" {
+		a.Params = append(a.Params, &Param{Param: "algorithm", Val: p.Algorithm})
+	}
+	if opaque := chal.GetParam("opaque"); opaque != nil {
+		a.Params = append(a.Params, &Param{Param: "opaque", Val: opaque.Val})
+	}
+	if qop != "" {
+		a.Params = append(a.Params, &Param{Param: "qop", Val: qop}, &Param{Param: "nc", Val: p.NC}, &Param{Param: "cnonce", Val: p.CNonce})
+	}
+	a.setFields()
+	a.Val = a.String()
+	return a, nil
+}
+
+// answerAll answers the first challenge that c supports for each
+// realm.  The challenges are in the order the server prefers them
+// (RFC 8760 2.4) and a request has to have credentials for each
+// realm that challenged it (RFC 3261 22.3).
+func (c *DigestClient) answerAll(chals []*Authorization, req *SipMsg) ([]*Authorization, error) {
+	creds := make([]*Authorization, 0, 1)
+	done := make(map[string]bool)
+	err := fmt.Errorf("%w: answerAll err: no challenge", ErrBadAuthorization)
+	for _, chal := range chals {
+		if done[chal.Realm] {
+			continue
+		}
+		a, e := c.Answer(chal, req)
+		if e != nil {
+			err = e
+			continue
+		}
+		done[chal.Realm] = true
+		creds = append(creds, a)
+	}
+	if len(creds) == 0 {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// Authorize answers the challenges in a 401 (WWW-Authenticate) or
+// 407 (Proxy-Authenticate) response and sets the credentials of the
+// request (the Authorization or Proxy-Authorization hdrs) to them.
+// As RFC 3261 22.2 asks the CSeq of the request is incremented and
+// the top Via gets a new branch so that it can be sent again as is.
+func (c *DigestClient) Authorize(req *SipMsg, resp *SipMsg) error {
+	if resp.StartLine == nil || resp.StartLine.Type != SIP_RESPONSE {
+		return fmt.Errorf("%w: Authorize err: msg is not a response", ErrBadStartLine)
+	}
+	switch resp.StartLine.Resp {
+	case "401":
+		creds, err := c.answerAll(resp.GetWWWAuthenticates(), req)
+		if err != nil {
+			return err
+		}
+		req.Authorization, req.Authorizations = creds[len(creds)-1], creds
+	case "407":
+		creds, err := c.answerAll(resp.GetProxyAuthenticates(), req)
+		if err != nil {
+			return err
+		}
+		req.ProxyAuthorization, req.ProxyAuthorizations = creds[len(creds)-1], creds
+	default:
+		return fmt.Errorf("%w: Authorize err: response is not a 401 or 407: %s", ErrBadAuthorization, resp.StartLine.Resp)
+	}
+	if cseq := req.GetCseq(); cseq != nil {
+		if n, err := strconv.Atoi(cseq.Digit); err == nil {
+			cseq.Digit = strconv.Itoa(n + 1)
+			cseq.Val = cseq.String()
+		}
+	}
+	if via := req.GetVia(); len(via) != 0 {
+		via[0].Branch = NewBranch()
+		via[0].Via = via[0].String()
+	}
+	return nil
+}
+
+// DigestStore looks up the HA1 of a user so that a DigestVerifier
+// never needs the password itself
+type DigestStore interface {
+	// HA1 returns the HA1 (see DigestHA1) of the user in the realm for
+	// the algorithm and false if the user is not known
+	HA1(username string, realm string, alg string) (string, bool)
+}
+
+// PasswordStore is a DigestStore of passwords by username
+type PasswordStore map[string]string
+
+// HA1 computes the HA1 from the password of the user
+func (p PasswordStore) HA1(username string, realm string, alg string) (string, bool) {
+	pw, ok := p[username]
+	if !ok {
+		return "", false
+	}
+	ha1, err := DigestHA1(alg, username, realm, pw)
+	return ha1, err == nil
+}
+
+// HA1Store is a DigestStore of HA1s by username.  The HA1s have to
+// be for the realm and algorithm that are challenged with.
+type HA1Store map[string]string
+
+// HA1 returns the HA1 of the user
+func (h HA1Store) HA1(username string, realm string, alg string) (string, bool) {
+	ha1, ok := h[username]
+	return ha1, ok
+}
+
+// DigestVerifier checks the digest credentials of requests for a
+// realm.  It remembers the highest nonce count seen for each nonce
+// and rejects one that is not higher (a replayed request).  Without
+// .Nonces the nonces are remembered for DIGEST_NONCE_TTL from the
+// first time they are seen and then have to be challenged again
+// (stale) so that a client can not fill memory with made up
+// nonces.  It is safe for concurrent use.
+// The fields are as follows:
+// -- Realm is the realm that is challenged for
+// -- Store looks up the users
+// -- Nonces hands out the nonces for Challenge.  If it is set only
+// its nonces are accepted (and only until they expire).  If it is
+// nil the first call to Challenge sets it.
+type DigestVerifier struct {
+	Realm  string
+	Store  DigestStore
+	Nonces *NonceManager
+	mu     sync.Mutex
+	seen   *NonceManager
+}
+
+// NewDigestVerifier returns a *DigestVerifier for the realm that
+// looks users up in the store
+func NewDigestVerifier(realm string, store DigestStore) *DigestVerifier {
+	return &DigestVerifier{Realm: realm, Store: store}
+}
+
+// seenNonces returns the *NonceManager that keeps track of the
+// nonces the verifier has seen when .Nonces is nil
+func (v *DigestVerifier) seenNonces() *NonceManager {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = NewNonceManager(0)
+	}
+	return v.seen
+}
+
+// Verify checks the credentials of a request with the method and
+// body.  It returns nil if they are good or an error that wraps
+// ErrBadAuthorization (the credentials are missing something),
+// ErrDigestAlgorithm, ErrDigestResponse (an unknown user or the
+// wrong password), ErrDigestNonceCount (a replayed nonce count) or
+// ErrDigestStale (the right response but the nonce has expired or
+// is not from .Nonces).  Without .Nonces it does not check whether
+// the nonce is one that was handed out: a nonce is good from the
+// first time it is seen until DIGEST_NONCE_TTL later.
+func (v *DigestVerifier) Verify(auth *Authorization, method string, body string) error {
+	if !auth.isDigest() {
+		return fmt.Errorf("%w: Verify err: not digest credentials", ErrBadAuthorization)
+	}
+	user, realm := auth.Username, auth.Realm
+	p := &DigestParams{
+		Algorithm: auth.Algorithm,
+		Nonce:     auth.Nonce,
+		CNonce:    auth.CNonce,
+		NC:        auth.NC,
+		QOP:       auth.qop(),
+		Method:    method,
+		URI:       auth.URI,
+		Body:      body,
+	}
+	response := auth.Response
+	switch {
+	case user == "" || p.Nonce == "" || p.URI == "" || response == "":
+		return fmt.Errorf("%w: Verify err: missing username, nonce, uri or response", ErrBadAuthorization)
+	case realm != v.Realm:
+		return fmt.Errorf("%w: Verify err: wrong realm: %s", ErrBadAuthorization, realm)
+	case p.QOP != "" && (p.CNonce == "" || len(p.NC) != 8):
+		return fmt.Errorf("%w: Verify err: missing cnonce or nc", ErrBadAuthorization)
+	}
+	if _, _, err := digestHash(p.Algorithm); err != nil {
+		return err
+	}
+	ha1, ok := v.Store.HA1(user, realm, p.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: Verify err: unknown user: %s", ErrDigestResponse, user)
+	}
+	expected, err := DigestResponse(ha1, p)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(response))) != 1 {
+		return fmt.Errorf("%w: Verify err: for user: %s", ErrDigestResponse, user)
+	}
+	var nc uint64
+	if p.QOP != "" {
+		if nc, err = strconv.ParseUint(p.NC, 16, 32); err != nil {
+			return fmt.Errorf("%w: Verify err: invalid nc: %s", ErrBadAuthorization, p.NC)
+		}
+	}
+	if nonces := v.nonceManager(false); nonces != nil {
+		return nonces.Use(p.Nonce, uint32(nc))
+	}
+	return v.seenNonces().track(p.Nonce, uint32(nc))
+}
+
+// VerifyRequest checks the Authorization hdr of the request (or the
+// Proxy-Authorization hdr if proxy is true) for .Realm with Verify.
+// The uri in the credentials has to be equal to the Request-URI (RFC
+// 2617 3.2.2.5) so that they can not be replayed against another uri.
+func (v *DigestVerifier) VerifyRequest(req *SipMsg, proxy bool) error {
+	creds := req.GetAuthorizations()
+	if proxy {
+		creds = req.GetProxyAuthorizations()
+	}
+	if len(creds) == 0 {
+		return fmt.Errorf("%w: VerifyRequest err: no credentials", ErrBadAuthorization)
+	}
+	auth := creds[0]
+	for i := range creds {
+		if creds[i].Realm == v.Realm {
+			auth = creds[i]
+			break
+		}
+	}
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return fmt.Errorf("%w: VerifyRequest err: msg is not a request", ErrBadStartLine)
+	}
+	if u := ParseURI(auth.URI); u.Error != nil || !u.Equal(req.StartLine.URI) {
+		return fmt.Errorf("%w: VerifyRequest err: uri %s does not match the Request-URI", ErrBadAuthorization, auth.URI)
+	}
+	return v.Verify(auth, req.StartLine.Method, req.Body)
+}
+
+// nonceManager returns .Nonces.  If it is nil and create is true a
+// NonceManager with the default ttl is set first.
+func (v *DigestVerifier) nonceManager(create bool) *NonceManager {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.Nonces == nil && create {
+		v.Nonces = NewNonceManager(0)
+	}
+	return v.Nonces
+}
+
+// Challenge returns a new digest challenge (for a WWW-Authenticate
+// or Proxy-Authenticate hdr) with a nonce from .Nonces.  alg is the
+// algorithm to ask for (left out if it is blank, which means MD5).
+// stale should be true when the credentials were rejected with
+// ErrDigestStale so that the client retries without asking the user
+// for the password again (RFC 2617 3.2.1).
+func (v *DigestVerifier) Challenge(alg string, stale bool) *Authorization {
+	a := &Authorization{Credentials: DIGEST_SCHEME}
+	a.Params = []*Param{
+		{Param: "realm", Val: v.Realm},
+		{Param: "nonce", Val: v.nonceManager(true).New()},
+	}
+	if alg != "" {
+		a.Params = append(a.Params, &Param{Param: "algorithm", Val: alg})
+	}
+	a.Params = append(a.Params, &Param{Param: "qop", Val: DIGEST_QOP_AUTH, Quoted: true})
+	if stale {
+		a.Params = append(a.Params, &Param{Param: "stale", Val: "true"})
+	}
+	a.setFields()
+	a.Val = a.String()
+	return a
+}
+
+// ChallengeResponse returns the 401 (or 407 if proxy is true)
+// response to the request with a Challenge for alg in the
+// WWW-Authenticate (or Proxy-Authenticate) hdr
+func (v *DigestVerifier) ChallengeResponse(req *SipMsg, proxy bool, alg string, stale bool) *SipMsg {
+	if proxy {
+		resp := NewResponse(req, 407, "")
+		resp.ProxyAuthenticate = v.Challenge(alg, stale)
+		return resp
+	}
+	resp := NewResponse(req, 401, "")
+	resp.WWWAuthenticate = v.Challenge(alg, stale)
+	return resp
+}
+
+// AuthenticationInfo returns the Authentication-Info hdr for
+// credentials that Verify accepted.  It has a nextnonce if there is a
+// .Nonces and the rspauth (RFC 2617 3.2.3) for credentials with a
+// qop.  body is the body of the response (only used for auth-int).
+func (v *DigestVerifier) AuthenticationInfo(auth *Authorization, body string) (*AuthenticationInfo, error) {
+	info := &AuthenticationInfo{}
+	if nonces := v.nonceManager(false); nonces != nil {
+		info.NextNonce = nonces.New()
+	}
+	if qop := auth.qop(); qop != "" {
+		p := &DigestParams{
+			Algorithm: auth.Algorithm,
+			Nonce:     auth.Nonce,
+			CNonce:    auth.CNonce,
+			NC:        auth.NC,
+			QOP:       qop,
+			URI:       auth.URI,
+			Body:      body,
+		}
+		ha1, ok := v.Store.HA1(auth.Username, auth.Realm, p.Algorithm)
+		if !ok {
+			return nil, fmt.Errorf("%w: AuthenticationInfo err: unknown user: %s", ErrDigestResponse, auth.Username)
+		}
+		rspauth, err := DigestResponse(ha1, p)
+		if err != nil {
+			return nil, err
+		}
+		info.Qop, info.RspAuth, info.CNonce, info.NC = p.QOP, rspauth, p.CNonce, p.NC
+	}
+	info.Val = info.String()
+	return info, nil
+}
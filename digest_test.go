@@ -0,0 +1,123 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+)
+
+func TestDigestResponse(t *testing.T) {
+	// RFC 2617 3.5 and RFC 7616 3.9.1
+	tests := []struct {
+		alg      string
+		realm    string
+		password string
+		nonce    string
+		cnonce   string
+		response string
+	}{
+		{DIGEST_ALG_MD5, "testrealm@host.com", "Circle Of Life", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "0a4f113b", "6629fae49393a05397450978507c4ef1"},
+		{DIGEST_ALG_MD5, "http-auth@example.org", "Circle of Life", "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "8ca523f5e9506fed4657c9700eebdbec"},
+		{DIGEST_ALG_SHA256, "http-auth@example.org", "Circle of Life", "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		ha1, err := DigestHA1(tt.alg, "Mufasa", tt.realm, tt.password)
+		if err != nil {
+			t.Fatalf("[TestDigestResponse] Error getting HA1.  Received: %s", err.Error())
+		}
+		resp, err := DigestResponse(ha1, &DigestParams{Algorithm: tt.alg, Nonce: tt.nonce, CNonce: tt.cnonce, NC: "00000001", QOP: DIGEST_QOP_AUTH, Method: "GET", URI: "/dir/index.html"})
+		if err != nil || resp != tt.response {
+			t.Errorf("[TestDigestResponse] %s response should be %q but received: %q", tt.alg, tt.response, resp)
+		}
+	}
+	if _, err := DigestHA1("SHA-1", "a", "b", "c"); !errors.Is(err, ErrDigestAlgorithm) {
+		t.Errorf("[TestDigestResponse] An unknown algorithm should be an ErrDigestAlgorithm.")
+	}
+}
+
+func digestChallenge(code string, hdr string, chal string) *SipMsg {
+	return ParseMsg("SIP/2.0 " + code + " Unauthorized\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bKnashds7\r\n" +
+		"From: <sip:bob@atlanta.com>;tag=456248\r\n" +
+		"To: <sip:bob@atlanta.com>;tag=2493k59kd\r\n" +
+		"Call-ID: 843817637684230@998sdasdh09\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		hdr + ": " + chal + "\r\n" +
+		"Content-Length: 0\r\n\r\n")
+}
+
+func TestDigestClientVerifier(t *testing.T) {
+	store := PasswordStore{"bob": "zanzibar"}
+	v := NewDigestVerifier("atlanta.com", store)
+	c := NewDigestClient("bob", "zanzibar")
+	algs := []string{DIGEST_ALG_MD5, DIGEST_ALG_MD5_SESS, DIGEST_ALG_SHA256, DIGEST_ALG_SHA256_SESS, DIGEST_ALG_SHA512_256, DIGEST_ALG_SHA512_256_SESS}
+	for _, alg := range algs {
+		for _, qop := range []string{`"auth,auth-int"`, `"auth-int"`} {
+			resp := digestChallenge("401", "WWW-Authenticate", `Digest realm="atlanta.com", nonce="84a4cc6f3082121f32b42a2187831a9e-`+alg+`", qop=`+qop+`, algorithm=`+alg+`, opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+			req := NewRequest(SIP_METHOD_REGISTER, ParseURI("sip:registrar.atlanta.com"))
+			req.Body = "v=0\r\n"
+			branch := req.Via[0].Branch
+			if err := c.Authorize(req, resp); err != nil {
+				t.Fatalf("[TestDigestClientVerifier] Error answering %s %s challenge.  Received: %s", alg, qop, err.Error())
+			}
+			if req.Cseq.Digit != "2" || req.Via[0].Branch == branch {
+				t.Errorf("[TestDigestClientVerifier] The CSeq and branch should change for the new request.")
+			}
+			if req.Authorization.Opaque != "5ccc069c403ebaf9f0171e9517f40e41" || req.Authorization.Algorithm != alg {
+				t.Errorf("[TestDigestClientVerifier] The opaque and algorithm should be copied from the challenge.")
+			}
+			if qop == `"auth-int"` && req.Authorization.qop() != DIGEST_QOP_AUTH_INT {
+				t.Errorf("[TestDigestClientVerifier] auth-int should be used when it is the only qop.")
+			}
+			rcvd := ParseMsg(req.String())
+			if err := v.VerifyRequest(rcvd, false); err != nil {
+				t.Errorf("[TestDigestClientVerifier] Error verifying %s %s credentials.  Received: %s", alg, qop, err.Error())
+			}
+			if err := v.VerifyRequest(rcvd, false); !errors.Is(err, ErrDigestNonceCount) {
+				t.Errorf("[TestDigestClientVerifier] A replayed request should be an ErrDigestNonceCount.")
+			}
+		}
+	}
+	// the nonce count goes up each time the nonce is used
+	resp := digestChallenge("407", "Proxy-Authenticate", `Digest realm="atlanta.com", nonce="abc", qop="auth"`)
+	req := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:alice@atlanta.com"))
+	for _, nc := range []string{"00000001", "00000002"} {
+		if err := c.Authorize(req, resp); err != nil || req.ProxyAuthorization == nil || req.ProxyAuthorization.NC != nc {
+			t.Fatalf("[TestDigestClientVerifier] Proxy-Authorization should have nc %s.", nc)
+		}
+		if err := v.VerifyRequest(ParseMsg(req.String()), true); err != nil {
+			t.Errorf("[TestDigestClientVerifier] Error verifying proxy credentials.  Received: %s", err.Error())
+		}
+	}
+	req.Body = "changed"
+	ha1, _ := DigestHA1(DIGEST_ALG_MD5, "bob", "atlanta.com", "zanzibar")
+	if err := NewDigestVerifier("atlanta.com", HA1Store{"bob": ha1}).VerifyRequest(req, true); err != nil {
+		t.Errorf("[TestDigestClientVerifier] The body should not matter for qop=auth.  Received: %s", err.Error())
+	}
+	bad := NewDigestClient("bob", "wrong")
+	if err := bad.Authorize(req, resp); err != nil {
+		t.Fatalf("[TestDigestClientVerifier] Error answering challenge.  Received: %s", err.Error())
+	}
+	if err := v.VerifyRequest(req, true); !errors.Is(err, ErrDigestResponse) {
+		t.Errorf("[TestDigestClientVerifier] A wrong password should be an ErrDigestResponse.")
+	}
+	if err := NewDigestVerifier("biloxi.com", store).VerifyRequest(req, true); !errors.Is(err, ErrBadAuthorization) {
+		t.Errorf("[TestDigestClientVerifier] A different realm should be an ErrBadAuthorization.")
+	}
+	// the credentials only cover the Request-URI they were made for
+	if err := c.Authorize(req, resp); err != nil {
+		t.Fatalf("[TestDigestClientVerifier] Error answering challenge.  Received: %s", err.Error())
+	}
+	moved := ParseMsg(req.String())
+	moved.StartLine.URI = ParseURI("sip:carol@atlanta.com")
+	if err := v.VerifyRequest(moved, true); !errors.Is(err, ErrBadAuthorization) {
+		t.Errorf("[TestDigestClientVerifier] A uri that is not the Request-URI should be an ErrBadAuthorization.")
+	}
+	if err := c.Authorize(req, digestChallenge("403", "Warning", `399 a "b"`)); err == nil {
+		t.Errorf("[TestDigestClientVerifier] A 403 should not be answered.")
+	}
+}
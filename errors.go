@@ -0,0 +1,149 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"strconv"
+)
+
+// The errors below are wrapped (with the details) by the errors that
+// come out of parsing so that the kind of problem can be checked with
+// errors.Is (i.e. errors.Is(s.Error, ErrBadVia)) instead of matching
+// on the error string.
+var (
+	// ErrNoHeaderTerminator is a msg without the blank line (CRLFCRLF)
+	// that ends the hdrs
+	ErrNoHeaderTerminator = errors.New("no hdr terminator")
+	// ErrBadStartLine is a request or status line that can not be parsed
+	ErrBadStartLine = errors.New("bad start line")
+	// ErrBadHeader is a hdr line that is not "name: value"
+	ErrBadHeader = errors.New("bad hdr")
+	// ErrBadURI is a uri that can not be parsed
+	ErrBadURI = errors.New("bad uri")
+	// ErrBadVia is a Via hdr that can not be parsed
+	ErrBadVia = errors.New("bad via")
+	// ErrBadFrom is a From, To or Contact hdr that can not be parsed
+	ErrBadFrom = errors.New("bad from")
+	// ErrBadContact is a Contact hdr value that can not be parsed or a
+	// wildcard contact that is not allowed
+	ErrBadContact = errors.New("bad contact")
+	// ErrBadCSeq is a CSeq hdr that can not be parsed
+	ErrBadCSeq = errors.New("bad cseq")
+	// ErrBadRAck is a RAck hdr that can not be parsed
+	ErrBadRAck = errors.New("bad rack")
+	// ErrBadWarning is a Warning hdr that can not be parsed
+	ErrBadWarning = errors.New("bad warning")
+	// ErrBadAuthorization is an Authorization, Proxy-Authenticate or
+	// WWW-Authenticate hdr that can not be parsed
+	ErrBadAuthorization = errors.New("bad authorization")
+	// ErrDigestAlgorithm is a digest algorithm that is not supported
+	ErrDigestAlgorithm = errors.New("unsupported digest algorithm")
+	// ErrDigestResponse is digest credentials for an unknown user or
+	// with a response that does not match
+	ErrDigestResponse = errors.New("digest response does not match")
+	// ErrDigestNonceCount is digest credentials with a nonce count
+	// that has already been used for the nonce (a replay)
+	ErrDigestNonceCount = errors.New("digest nonce count reused")
+	// ErrDigestStale is digest credentials with the right response
+	// for a nonce that has expired or was not handed out (the client
+	// should be challenged again with stale=true)
+	ErrDigestStale = errors.New("digest nonce stale")
+	// ErrBadAuthenticationInfo is an Authentication-Info hdr that can
+	// not be parsed
+	ErrBadAuthenticationInfo = errors.New("bad authentication-info")
+	// ErrBadContentLength is a Content-Length that is not a number
+	ErrBadContentLength = errors.New("bad content-length")
+	// ErrNoContentLength is a msg on a stream without a Content-Length
+	ErrNoContentLength = errors.New("no content-length")
+	// ErrMsgTooLarge is a msg on a stream that is larger than the max
+	ErrMsgTooLarge = errors.New("msg too large")
+	// ErrTransaction is a msg that a transaction can not be created
+	// for or handle (i.e. a response without a Via branch) or a
+	// response that a transaction can not send in its state
+	ErrTransaction = errors.New("transaction error")
+	// ErrDialog is a msg that can not create a dialog or that is out
+	// of order (or too late) for the dialog it belongs to
+	ErrDialog = errors.New("dialog error")
+	// ErrGrammar is a value that does not match the RFC 3261 grammar
+	// (only checked with ParseOptions{Strict: true})
+	ErrGrammar = errors.New("grammar violation")
+)
+
+// ParseErrorKind is the kind of problem that a ParseError describes
+type ParseErrorKind int
+
+const (
+	// PARSE_ERR_MSG is a problem with the msg as a whole (i.e. there
+	// is no blank line at the end of the hdrs)
+	PARSE_ERR_MSG ParseErrorKind = iota
+	// PARSE_ERR_START_LINE is a start line that could not be parsed
+	PARSE_ERR_START_LINE
+	// PARSE_ERR_HDR is a hdr line that is not "name: value"
+	PARSE_ERR_HDR
+	// PARSE_ERR_HDR_VAL is the value of a hdr that could not be
+	// parsed into its typed field
+	PARSE_ERR_HDR_VAL
+)
+
+// parseErrorKinds holds the names of the ParseErrorKind's
+var parseErrorKinds = [...]string{
+	PARSE_ERR_MSG:        "msg",
+	PARSE_ERR_START_LINE: "start line",
+	PARSE_ERR_HDR:        "hdr",
+	PARSE_ERR_HDR_VAL:    "hdr value",
+}
+
+func (k ParseErrorKind) String() string {
+	if k < 0 || int(k) >= len(parseErrorKinds) {
+		return "unknown"
+	}
+	return parseErrorKinds[k]
+}
+
+// ParseError is one problem found while parsing a msg.  Every
+// ParseError for a msg is in SipMsg.Errors (in the order they were
+// found) so that the caller can decide which ones matter (i.e. a bad
+// Warning hdr can usually be ignored but a bad Via can not).
+// The fields are as follows:
+// -- Header is the long form lower case name of the hdr (i.e. "via")
+// or "" if the error is not for a hdr
+// -- Line is the line number (starting at 1 for the start line)
+// -- Offset is the offset of the start of the line in .Msg
+// -- Value is the value (or whole line) that could not be parsed
+// -- Kind is the kind of error (see the PARSE_ERR_* consts)
+// -- Rule is the name of the rule from the RFC 3261 grammar that
+// the value does not match (only set in strict mode)
+// -- Err is the underlying error
+type ParseError struct {
+	Header string
+	Line   int
+	Offset int
+	Value  string
+	Kind   ParseErrorKind
+	Rule   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	where := e.Kind.String()
+	if e.Header != "" {
+		where = displayHdr(e.Header) + " " + where
+	}
+	if e.Line > 0 {
+		where += " on line " + strconv.Itoa(e.Line)
+	}
+	if e.Err == nil {
+		return "ParseError: bad " + where + "."
+	}
+	return "ParseError: bad " + where + ": " + e.Err.Error()
+}
+
+// Unwrap returns .Err so that errors.Is and errors.As can see the
+// underlying error (i.e. errors.Is(e, ErrBadCSeq))
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
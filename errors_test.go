@@ -0,0 +1,97 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	m := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\nFrom: <sip:alice@atlanta.com>;tag=1928301774\r\nCSeq: \r\nWarning: bogus\r\nno colon here\r\nTo: <sip:bob@biloxi.com>\r\nCall-ID: a84b4c76e66710\r\nContent-Length: 0\r\n\r\n"
+	s := ParseMsg(m)
+	if len(s.Errors) != 3 {
+		t.Fatalf("[TestParseErrors] Expected 3 errors.  Received: %d", len(s.Errors))
+	}
+	if s.Error != s.Errors[0] {
+		t.Errorf("[TestParseErrors] s.Error should be the first error.")
+	}
+	e := s.Errors[0]
+	if e.Header != SIP_HDR_CSEQ || e.Kind != PARSE_ERR_HDR_VAL || e.Line != 4 || e.Err == nil {
+		t.Errorf("[TestParseErrors] The first error should be for the CSeq hdr on line 4.  Received: %s", e.Error())
+	}
+	if s.Msg[e.Offset:e.Offset+5] != "CSeq:" {
+		t.Errorf("[TestParseErrors] Offset of the CSeq err is wrong.  Received: %d", e.Offset)
+	}
+	e = s.Errors[1]
+	if e.Header != SIP_HDR_WARNING || e.Value != "bogus" || e.Line != 5 {
+		t.Errorf("[TestParseErrors] The second error should be for the Warning hdr.  Received: %s", e.Error())
+	}
+	e = s.Errors[2]
+	if e.Header != "" || e.Kind != PARSE_ERR_HDR || e.Value != "no colon here" || e.Line != 6 {
+		t.Errorf("[TestParseErrors] The third error should be for the line with no colon.  Received: %s", e.Error())
+	}
+	if s.To == nil || s.To.URI.User != "bob" || s.CallId != "a84b4c76e66710" {
+		t.Errorf("[TestParseErrors] Hdrs after an error should still be parsed.")
+	}
+	if s.Errors[1].Error() != "ParseError: bad Warning hdr value on line 5: bad warning: Warning.parse err: split on LWS was not correct." {
+		t.Errorf("[TestParseErrors] Unexpected error string.  Received: %q", s.Errors[1].Error())
+	}
+	s = ParseMsg("INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com\r\n")
+	if len(s.Errors) != 1 || s.Errors[0].Kind != PARSE_ERR_MSG {
+		t.Errorf("[TestParseErrors] A msg with no end of hdrs should have one PARSE_ERR_MSG.")
+	}
+	s = ParseMsg("bogus\r\n\r\n")
+	if len(s.Errors) != 1 || s.Errors[0].Kind != PARSE_ERR_START_LINE || s.Errors[0].Line != 1 {
+		t.Errorf("[TestParseErrors] A bad start line should have one PARSE_ERR_START_LINE.")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	m := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: bogus\r\nFrom: <sip:alice@>;tag=1\r\nCSeq: 1\r\nRAck: 1\r\nWarning: bogus\r\nAuthorization: Digest\r\nbogus\r\nRoute: <sip:bob@>\r\n\r\n"
+	s := ParseMsg(m)
+	tests := []struct {
+		hdr  string
+		errs []error
+	}{
+		{SIP_HDR_VIA, []error{ErrBadVia}},
+		{SIP_HDR_FROM, []error{ErrBadFrom, ErrBadURI}},
+		{SIP_HDR_CSEQ, []error{ErrBadCSeq}},
+		{SIP_HDR_RACK, []error{ErrBadRAck}},
+		{SIP_HDR_WARNING, []error{ErrBadWarning}},
+		{SIP_HDR_AUTHORIZATION, []error{ErrBadAuthorization}},
+		{"", []error{ErrBadHeader}},
+		{SIP_HDR_ROUTE, []error{ErrBadURI}},
+	}
+	if len(s.Errors) != len(tests) {
+		t.Fatalf("[TestSentinelErrors] Expected %d errors.  Received: %d", len(tests), len(s.Errors))
+	}
+	for i := range tests {
+		if s.Errors[i].Header != tests[i].hdr {
+			t.Errorf("[TestSentinelErrors] Errors[%d] should be for %q.  Received: %s", i, tests[i].hdr, s.Errors[i])
+		}
+		for _, err := range tests[i].errs {
+			if !errors.Is(s.Errors[i], err) {
+				t.Errorf("[TestSentinelErrors] Errors[%d] should wrap %q.  Received: %s", i, err, s.Errors[i])
+			}
+		}
+	}
+	if !errors.Is(s.Error, ErrBadVia) {
+		t.Errorf("[TestSentinelErrors] s.Error should wrap ErrBadVia.")
+	}
+	var pe *ParseError
+	if !errors.As(s.Error, &pe) || pe.Header != SIP_HDR_VIA {
+		t.Errorf("[TestSentinelErrors] s.Error should be a *ParseError.")
+	}
+	s = ParseMsg("INVITE sip:bob@biloxi.com SIP/2.0\r\n")
+	if !errors.Is(s.Error, ErrNoHeaderTerminator) {
+		t.Errorf("[TestSentinelErrors] A msg with no end of hdrs should wrap ErrNoHeaderTerminator.")
+	}
+	s = ParseMsg("INVITE sip:bob@ SIP/2.0\r\n\r\n")
+	if !errors.Is(s.Error, ErrBadStartLine) || !errors.Is(s.Error, ErrBadURI) {
+		t.Errorf("[TestSentinelErrors] A bad request uri should wrap ErrBadStartLine and ErrBadURI.  Received: %s", s.Error)
+	}
+}
@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -35,6 +35,7 @@ type From struct {
 	rightBrack int
 	leftBrack  int
 	brackChk   bool
+	spareURI   *URI
 }
 
 func (f *From) parse() {
@@ -44,6 +45,9 @@ func (f *From) parse() {
 }
 
 func (f *From) addParam(s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
 	p := getParam(s)
 	switch {
 	case p.Param == "tag":
@@ -67,24 +71,27 @@ func parseFromState(f *From) parseFromStateFn {
 func parseFromGetURI(f *From) parseFromStateFn {
 	f.leftBrack, f.rightBrack, f.brackChk = getBracks(f.Val)
 	if f.brackChk == false {
-		f.URI = ParseURI(f.Val)
+		f.URI = reuseURI(f.spareURI, f.Val)
+		f.spareURI = f.URI
 		if f.URI.Error != nil {
-			f.Error = errors.New("parseFromGetURI err: rcvd err parsing uri: " + f.URI.Error.Error())
+			f.Error = fmt.Errorf("%w: parseFromGetURI err: rcvd err parsing uri: %w", ErrBadFrom, f.URI.Error)
 			return nil
 		}
-		if f.URI.UriParams != nil {
-			for i := range f.URI.UriParams {
-				if f.URI.UriParams[i].Param == "tag" {
-					f.Tag = f.URI.UriParams[i].Val
-				}
-			}
+		// without bracks any params belong to the hdr and not the uri
+		for i := range f.URI.UriParams {
+			f.addParam(f.URI.UriParams[i].String())
+		}
+		f.URI.UriParams = nil
+		if f.URI.Tel != nil {
+			f.URI.Tel = &TelURI{Number: f.URI.Tel.Number, Global: f.URI.Tel.Global}
 		}
 		return nil
 	}
 	if f.brackChk == true {
-		f.URI = ParseURI(f.Val[f.leftBrack+1 : f.rightBrack])
+		f.URI = reuseURI(f.spareURI, f.Val[f.leftBrack+1:f.rightBrack])
+		f.spareURI = f.URI
 		if f.URI.Error != nil {
-			f.Error = errors.New("parseFromGetURI err: rcvd err parsing uri: " + f.URI.Error.Error())
+			f.Error = fmt.Errorf("%w: parseFromGetURI err: rcvd err parsing uri: %w", ErrBadFrom, f.URI.Error)
 			return nil
 		}
 		return parseFromGetParams
@@ -94,7 +101,7 @@ func parseFromGetURI(f *From) parseFromStateFn {
 
 func parseFromGetParams(f *From) parseFromStateFn {
 	if f.brackChk == true && len(f.Val) > f.rightBrack+1 {
-		pms := strings.Split(f.Val[f.rightBrack+1:], ";")
+		pms := splitQuoted(f.Val[f.rightBrack+1:], ';')
 		for i := range pms {
 			f.addParam(pms[i])
 		}
@@ -103,8 +110,46 @@ func parseFromGetParams(f *From) parseFromStateFn {
 	return nil
 }
 
+// String returns the hdr rendered from its parsed fields.  The
+// uri is always enclosed in bracks.
+func (f *From) String() string {
+	str := nameAddr(f.Name, f.URI)
+	for i := range f.Params {
+		str += ";" + f.Params[i].String()
+	}
+	if f.Tag != "" {
+		str += ";tag=" + f.Tag
+	}
+	return str
+}
+
 func getFrom(s string) *From {
 	f := &From{Val: s}
 	f.parse()
 	return f
 }
+
+// reuseFrom parses s into f (after resetting it) or into a new
+// *From if f is nil.  The uri that f parsed before (not one that was
+// put in .URI by hand) and the params are reused.
+func reuseFrom(f *From, s string) *From {
+	if f == nil {
+		return getFrom(s)
+	}
+	p := f.Params[0:0]
+	*f = From{Val: s, Params: p, spareURI: f.spareURI}
+	f.parse()
+	return f
+}
+
+// clone returns a deep copy of the hdr
+func (f *From) clone() *From {
+	if f == nil {
+		return nil
+	}
+	n := *f
+	n.URI = f.URI.clone()
+	n.Params = cloneParams(f.Params)
+	n.spareURI = nil
+	return &n
+}
@@ -46,3 +46,14 @@ func TestFrom(t *testing.T) {
 	}
 	sm.parseFrom("<sip:19786977569@208.72.120.217>;isup-oli=00;tag=931226247")
 }
+
+func TestFromString(t *testing.T) {
+	f := getFrom("\"Unknown\" <sip:5554441000@0.0.0.0;user=phone>;isup-oli=00;tag=dd737a8")
+	if f.String() != "\"Unknown\" <sip:5554441000@0.0.0.0;user=phone>;isup-oli=00;tag=dd737a8" {
+		t.Errorf("[TestFromString] Error rendering from hdr.  Received: %q", f.String())
+	}
+	f = getFrom("sip:+12125551212@phone2net.com;tag=887s")
+	if f.String() != "<sip:+12125551212@phone2net.com>;tag=887s" {
+		t.Errorf("[TestFromString] Params without bracks should be rendered as hdr params.  Received: %q", f.String())
+	}
+}
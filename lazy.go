@@ -0,0 +1,244 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// lazyHdrBits holds the hdrs that are only indexed when a msg is
+// parsed with ParseOptions{Lazy: true}.  Each one has a bit in
+// SipMsg.lazyParsed that is set once the hdr has been parsed.  Hdrs
+// that are just stored as a string (i.e. Call-ID) are not in here
+// since there is nothing to be saved by deferring them.
+var lazyHdrBits = map[string]uint64{
+	SIP_HDR_ACCEPT:              1 << 0,
+	SIP_HDR_ALLOW:               1 << 1,
+	SIP_HDR_ALLOW_EVENTS:        1 << 2,
+	SIP_HDR_AUTHORIZATION:       1 << 3,
+	SIP_HDR_CONTENT_DISPOSITION: 1 << 4,
+	SIP_HDR_CSEQ:                1 << 5,
+	SIP_HDR_FROM:                1 << 6,
+	SIP_HDR_PROXY_AUTHENTICATE:  1 << 7,
+	SIP_HDR_RACK:                1 << 8,
+	SIP_HDR_REASON:              1 << 9,
+	SIP_HDR_RECORD_ROUTE:        1 << 10,
+	SIP_HDR_ROUTE:               1 << 11,
+	SIP_HDR_SUPPORTED:           1 << 12,
+	SIP_HDR_TO:                  1 << 13,
+	SIP_HDR_UNSUPPORTED:         1 << 14,
+	SIP_HDR_VIA:                 1 << 15,
+	SIP_HDR_WARNING:             1 << 16,
+	SIP_HDR_WWW_AUTHENTICATE:    1 << 17,
+	SIP_HDR_PROXY_AutHORIZATION: 1 << 18,
+	SIP_HDR_AUTHENTICATION_INFO: 1 << 19,
+}
+
+// parseLazyHdr parses every instance of a hdr that was only indexed
+// (in the order they were received).  It does nothing if the msg was
+// not parsed lazily or the hdr has already been parsed.
+func (s *SipMsg) parseLazyHdr(hdr string) {
+	if !s.lazy {
+		return
+	}
+	bit := lazyHdrBits[hdr]
+	if bit == 0 || s.lazyParsed&bit != 0 {
+		return
+	}
+	s.lazyParsed |= bit
+	for i := range s.hdrOrder {
+		ref := &s.hdrOrder[i]
+		if ref.lazy && ref.hdr == hdr {
+			s.hdr = ref.hdr
+			s.hdrv = cleanWs(ref.raw.Val)
+			s.parseHdr(ref)
+			ref.lazy = false
+		}
+	}
+}
+
+// parseLazyHdrs parses every hdr that was only indexed
+func (s *SipMsg) parseLazyHdrs() {
+	if !s.lazy {
+		return
+	}
+	for i := range s.hdrOrder {
+		if s.hdrOrder[i].lazy {
+			s.parseLazyHdr(s.hdrOrder[i].hdr)
+		}
+	}
+}
+
+// GetAccept returns the parsed Accept hdr
+func (s *SipMsg) GetAccept() *Accept {
+	s.parseLazyHdr(SIP_HDR_ACCEPT)
+	return s.Accept
+}
+
+// GetAllow returns the methods from the Allow hdr
+func (s *SipMsg) GetAllow() []string {
+	s.parseLazyHdr(SIP_HDR_ALLOW)
+	return s.Allow
+}
+
+// GetAllowEvents returns the event types from the Allow-Events hdr
+func (s *SipMsg) GetAllowEvents() []string {
+	s.parseLazyHdr(SIP_HDR_ALLOW_EVENTS)
+	return s.AllowEvents
+}
+
+// GetAuthenticationInfo returns the parsed Authentication-Info hdr
+func (s *SipMsg) GetAuthenticationInfo() *AuthenticationInfo {
+	s.parseLazyHdr(SIP_HDR_AUTHENTICATION_INFO)
+	return s.AuthenticationInfo
+}
+
+// GetAuthorization returns the parsed Authorization hdr
+func (s *SipMsg) GetAuthorization() *Authorization {
+	s.parseLazyHdr(SIP_HDR_AUTHORIZATION)
+	return s.Authorization
+}
+
+// GetAuthorizations returns every value of every Authorization hdr in the
+// order they were received
+func (s *SipMsg) GetAuthorizations() []*Authorization {
+	s.parseLazyHdr(SIP_HDR_AUTHORIZATION)
+	return s.authList(SIP_HDR_AUTHORIZATION)
+}
+
+// GetContact returns the parsed Contact hdr.  Unlike the other Get
+// methods this parses the Contact hdr in every mode (just like
+// calling ParseContact with .ContactVal).
+func (s *SipMsg) GetContact() *From {
+	if s.Contact == nil && s.ContactVal != "" {
+		s.parseContact(s.ContactVal)
+	}
+	return s.Contact
+}
+
+// GetContentDisposition returns the parsed Content-Disposition hdr
+func (s *SipMsg) GetContentDisposition() *ContentDisposition {
+	s.parseLazyHdr(SIP_HDR_CONTENT_DISPOSITION)
+	return s.ContentDisposition
+}
+
+// GetCseq returns the parsed CSeq hdr
+func (s *SipMsg) GetCseq() *Cseq {
+	s.parseLazyHdr(SIP_HDR_CSEQ)
+	return s.Cseq
+}
+
+// GetFrom returns the parsed From hdr
+func (s *SipMsg) GetFrom() *From {
+	s.parseLazyHdr(SIP_HDR_FROM)
+	return s.From
+}
+
+// GetPAssertedId returns the parsed P-Asserted-Identity hdr.  Like
+// GetContact it parses the hdr in every mode.
+func (s *SipMsg) GetPAssertedId() *PAssertedId {
+	if s.PAssertedId == nil && s.PAssertedIdVal != "" {
+		s.parsePAssertedId(s.PAssertedIdVal)
+	}
+	return s.PAssertedId
+}
+
+// GetProxyAuthenticate returns the parsed Proxy-Authenticate hdr
+func (s *SipMsg) GetProxyAuthenticate() *Authorization {
+	s.parseLazyHdr(SIP_HDR_PROXY_AUTHENTICATE)
+	return s.ProxyAuthenticate
+}
+
+// GetProxyAuthenticates returns every value of every Proxy-Authenticate hdr in the
+// order they were received
+func (s *SipMsg) GetProxyAuthenticates() []*Authorization {
+	s.parseLazyHdr(SIP_HDR_PROXY_AUTHENTICATE)
+	return s.authList(SIP_HDR_PROXY_AUTHENTICATE)
+}
+
+// GetProxyAuthorization returns the parsed Proxy-Authorization hdr
+func (s *SipMsg) GetProxyAuthorization() *Authorization {
+	s.parseLazyHdr(SIP_HDR_PROXY_AutHORIZATION)
+	return s.ProxyAuthorization
+}
+
+// GetProxyAuthorizations returns every value of every Proxy-Authorization hdr in the
+// order they were received
+func (s *SipMsg) GetProxyAuthorizations() []*Authorization {
+	s.parseLazyHdr(SIP_HDR_PROXY_AutHORIZATION)
+	return s.authList(SIP_HDR_PROXY_AutHORIZATION)
+}
+
+// GetRack returns the parsed RAck hdr
+func (s *SipMsg) GetRack() *Rack {
+	s.parseLazyHdr(SIP_HDR_RACK)
+	return s.Rack
+}
+
+// GetReason returns the parsed Reason hdr
+func (s *SipMsg) GetReason() *Reason {
+	s.parseLazyHdr(SIP_HDR_REASON)
+	return s.Reason
+}
+
+// GetRecordRoute returns the uris from the Record-Route hdrs
+func (s *SipMsg) GetRecordRoute() []*URI {
+	s.parseLazyHdr(SIP_HDR_RECORD_ROUTE)
+	return s.RecordRoute
+}
+
+// GetRemotePartyId returns the parsed Remote-Party-Id hdr.  Like
+// GetContact it parses the hdr in every mode.
+func (s *SipMsg) GetRemotePartyId() *RemotePartyId {
+	if s.RemotePartyId == nil && s.RemotePartyIdVal != "" {
+		s.parseRemotePartyId(s.RemotePartyIdVal)
+	}
+	return s.RemotePartyId
+}
+
+// GetRoute returns the uris from the Route hdrs
+func (s *SipMsg) GetRoute() []*URI {
+	s.parseLazyHdr(SIP_HDR_ROUTE)
+	return s.Route
+}
+
+// GetSupported returns the extensions from the Supported hdr
+func (s *SipMsg) GetSupported() []string {
+	s.parseLazyHdr(SIP_HDR_SUPPORTED)
+	return s.Supported
+}
+
+// GetTo returns the parsed To hdr
+func (s *SipMsg) GetTo() *From {
+	s.parseLazyHdr(SIP_HDR_TO)
+	return s.To
+}
+
+// GetUnsupported returns the extensions from the Unsupported hdr
+func (s *SipMsg) GetUnsupported() []string {
+	s.parseLazyHdr(SIP_HDR_UNSUPPORTED)
+	return s.Unsupported
+}
+
+// GetVia returns the parsed Via hdrs
+func (s *SipMsg) GetVia() []*Via {
+	s.parseLazyHdr(SIP_HDR_VIA)
+	return s.Via
+}
+
+// GetWarning returns the parsed Warning hdr
+func (s *SipMsg) GetWarning() *Warning {
+	s.parseLazyHdr(SIP_HDR_WARNING)
+	return s.Warning
+}
+
+// GetWWWAuthenticate returns the parsed WWW-Authenticate hdr
+func (s *SipMsg) GetWWWAuthenticate() *Authorization {
+	s.parseLazyHdr(SIP_HDR_WWW_AUTHENTICATE)
+	return s.WWWAuthenticate
+}
+
+// GetWWWAuthenticates returns every value of every WWW-Authenticate hdr in the
+// order they were received
+func (s *SipMsg) GetWWWAuthenticates() []*Authorization {
+	s.parseLazyHdr(SIP_HDR_WWW_AUTHENTICATE)
+	return s.authList(SIP_HDR_WWW_AUTHENTICATE)
+}
@@ -0,0 +1,89 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestLazyParse(t *testing.T) {
+	s := ParseMsgWithOptions(testInviteMsg, ParseOptions{Lazy: true})
+	if s.Error != nil {
+		t.Fatalf("[TestLazyParse] Error parsing msg.  Received: %s", s.Error.Error())
+	}
+	if s.Via != nil || s.From != nil || s.To != nil || s.Cseq != nil || s.RecordRoute != nil {
+		t.Errorf("[TestLazyParse] Lazy hdrs should not be parsed until they are asked for.")
+	}
+	if s.CallId != "a84b4c76e66710@pc33.atlanta.com" || s.ContactVal == "" {
+		t.Errorf("[TestLazyParse] String hdrs should be set in lazy mode.")
+	}
+	if len(s.RawHeaders) != 13 {
+		t.Errorf("[TestLazyParse] Expected 13 RawHeaders.  Received: %d", len(s.RawHeaders))
+	}
+	if v := s.GetVia(); len(v) != 1 || v[0].Branch != "z9hG4bK776asdhds" {
+		t.Errorf("[TestLazyParse] GetVia did not return the Via hdr.")
+	}
+	if f := s.GetFrom(); f == nil || f.Tag != "1928301774" || f.URI.User != "alice" {
+		t.Errorf("[TestLazyParse] GetFrom did not return the From hdr.")
+	}
+	if s.To != nil {
+		t.Errorf("[TestLazyParse] Getting one hdr should not parse the others.")
+	}
+	if c := s.GetCseq(); c == nil || c.Digit != "314159" || c.Method != SIP_METHOD_INVITE {
+		t.Errorf("[TestLazyParse] GetCseq did not return the CSeq hdr.")
+	}
+	if rr := s.GetRecordRoute(); len(rr) != 1 || rr[0].Host != "p1.atlanta.com" {
+		t.Errorf("[TestLazyParse] GetRecordRoute did not return the Record-Route hdr.")
+	}
+	if a := s.GetAllow(); len(a) != 5 {
+		t.Errorf("[TestLazyParse] GetAllow did not return the Allow hdr.")
+	}
+	if v := s.GetVia(); len(v) != 1 {
+		t.Errorf("[TestLazyParse] Calling a Get method twice should not parse the hdr twice.")
+	}
+	if s.String() != ParseMsg(testInviteMsg).String() {
+		t.Errorf("[TestLazyParse] A lazy msg should render the same as a parsed one.  Received: %q", s.String())
+	}
+}
+
+func TestLazyGettersNotLazy(t *testing.T) {
+	s := ParseMsg(testInviteMsg)
+	if s.GetTo() != s.To || s.GetCseq() != s.Cseq || len(s.GetVia()) != 1 {
+		t.Errorf("[TestLazyGettersNotLazy] The Get methods should return the parsed fields.")
+	}
+	if c := s.GetContact(); c == nil || c.URI.Host != "pc33.atlanta.com" {
+		t.Errorf("[TestLazyGettersNotLazy] GetContact did not parse the Contact hdr.")
+	}
+}
+
+func TestLazyParser(t *testing.T) {
+	p := NewParserWithOptions(ParseOptions{Lazy: true})
+	for i := 0; i < 3; i++ {
+		s := p.ParseMsg(testInviteMsg)
+		if s.Error != nil {
+			t.Fatalf("[TestLazyParser] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		if s.Via != nil {
+			t.Errorf("[TestLazyParser] Msg %d should be parsed lazily.", i)
+		}
+		if f := s.GetFrom(); f == nil || f.Name != "Alice" {
+			t.Errorf("[TestLazyParser] Msg %d From was not parsed correctly.", i)
+		}
+		p.Release(s)
+	}
+	r := NewResponse(ParseMsgWithOptions(testInviteMsg, ParseOptions{Lazy: true}), 200, "")
+	if len(r.Via) != 1 || r.From == nil || r.Cseq == nil || len(r.RecordRoute) != 1 {
+		t.Errorf("[TestLazyParser] NewResponse should work with a lazy request.")
+	}
+}
+
+func BenchmarkParseMsgLazyInvite(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(testInviteMsg)))
+	for i := 0; i < b.N; i++ {
+		ParseMsgWithOptions(testInviteMsg, ParseOptions{Lazy: true})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DIGEST_NONCE_TTL is how long a nonce is good for when a
+// NonceManager is created with a ttl of 0
+const DIGEST_NONCE_TTL = 5 * time.Minute
+
+// nonceState is what a NonceManager knows about a nonce that it
+// handed out
+type nonceState struct {
+	issued time.Time
+	nc     uint32
+	used   bool
+}
+
+// NonceManager hands out the nonces for digest challenges and keeps
+// track of them until they expire.  A nonce is only accepted while
+// it is not expired and only with a nonce count that is higher than
+// the last one it was used with (so a captured request can not be
+// replayed).  A nonce used without a nonce count (credentials
+// without a qop) is only accepted once.  It is safe for concurrent use.
+// The fields are as follows:
+// -- TTL is how long a nonce is good for
+// -- Now returns the current time (time.Now if nil) so that tests can
+// move the clock
+type NonceManager struct {
+	TTL    time.Duration
+	Now    func() time.Time
+	mu     sync.Mutex
+	nonces map[string]*nonceState
+	purged time.Time
+}
+
+// NewNonceManager returns a *NonceManager whose nonces are good for
+// the ttl (DIGEST_NONCE_TTL if it is 0)
+func NewNonceManager(ttl time.Duration) *NonceManager {
+	if ttl <= 0 {
+		ttl = DIGEST_NONCE_TTL
+	}
+	return &NonceManager{TTL: ttl, nonces: make(map[string]*nonceState)}
+}
+
+// now returns the current time from .Now
+func (m *NonceManager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// purge removes the expired nonces (at most once per TTL).  m.mu
+// must be held.
+func (m *NonceManager) purge(now time.Time) {
+	if now.Sub(m.purged) < m.TTL {
+		return
+	}
+	m.purged = now
+	for nonce, st := range m.nonces {
+		if now.Sub(st.issued) >= m.TTL {
+			delete(m.nonces, nonce)
+		}
+	}
+}
+
+// New returns a new nonce
+func (m *NonceManager) New() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if m.nonces == nil {
+		m.nonces = make(map[string]*nonceState)
+	}
+	m.purge(now)
+	nonce := randHex(16)
+	m.nonces[nonce] = &nonceState{issued: now}
+	return nonce
+}
+
+// Valid returns true if the nonce was handed out by m and has not
+// expired
+func (m *NonceManager) Valid(nonce string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.nonces[nonce]
+	return ok && m.now().Sub(st.issued) < m.TTL
+}
+
+// Use records that the nonce was used with the nonce count (0 for
+// credentials without a qop).  It returns an error that wraps
+// ErrDigestStale if the nonce has expired or was not handed out by m
+// and ErrDigestNonceCount if the nonce count is not higher than the
+// last one.  A nonce count of 0 can not be told apart from a replay
+// so it is only accepted for a nonce that has not been used yet, and
+// the nonce can not be used again after it.
+func (m *NonceManager) Use(nonce string, nc uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.use(nonce, nc)
+}
+
+// track is Use for a nonce that m did not hand out (see
+// DigestVerifier): a nonce that m does not know yet is added first so
+// that it expires after the TTL just like one from New.
+func (m *NonceManager) track(nonce string, nc uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if m.nonces == nil {
+		m.nonces = make(map[string]*nonceState)
+	}
+	m.purge(now)
+	if _, ok := m.nonces[nonce]; !ok {
+		m.nonces[nonce] = &nonceState{issued: now}
+	}
+	return m.use(nonce, nc)
+}
+
+// use is Use with m.mu held
+func (m *NonceManager) use(nonce string, nc uint32) error {
+	st, ok := m.nonces[nonce]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: Use err: unknown nonce: %s", ErrDigestStale, nonce)
+	case m.now().Sub(st.issued) >= m.TTL:
+		delete(m.nonces, nonce)
+		return fmt.Errorf("%w: Use err: expired nonce: %s", ErrDigestStale, nonce)
+	case nc == 0 && st.used:
+		return fmt.Errorf("%w: Use err: nonce without an nc was already used: %s", ErrDigestNonceCount, nonce)
+	case st.used && st.nc == 0:
+		return fmt.Errorf("%w: Use err: nonce was used without an nc: %s", ErrDigestNonceCount, nonce)
+	case nc != 0 && nc <= st.nc:
+		return fmt.Errorf("%w: Use err: nc %08x for nonce: %s", ErrDigestNonceCount, nc, nonce)
+	}
+	st.used = true
+	st.nc = nc
+	return nil
+}
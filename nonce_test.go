@@ -0,0 +1,151 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNonceManager(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := NewNonceManager(time.Minute)
+	m.Now = func() time.Time { return now }
+	n := m.New()
+	if len(n) != 32 || !m.Valid(n) || m.Valid("abc") {
+		t.Errorf("[TestNonceManager] Nonce %q should be valid and unknown nonces should not be.", n)
+	}
+	if err := m.Use(n, 1); err != nil {
+		t.Errorf("[TestNonceManager] Error using nonce.  Received: %s", err.Error())
+	}
+	if err := m.Use(n, 1); !errors.Is(err, ErrDigestNonceCount) {
+		t.Errorf("[TestNonceManager] A reused nc should be an ErrDigestNonceCount.")
+	}
+	if err := m.Use(n, 0); !errors.Is(err, ErrDigestNonceCount) {
+		t.Errorf("[TestNonceManager] A used nonce should not be accepted without an nc.")
+	}
+	// without a qop a nonce is good for one request
+	once := m.New()
+	if err := m.Use(once, 0); err != nil {
+		t.Errorf("[TestNonceManager] Error using nonce without an nc.  Received: %s", err.Error())
+	}
+	for _, nc := range []uint32{0, 1} {
+		if err := m.Use(once, nc); !errors.Is(err, ErrDigestNonceCount) {
+			t.Errorf("[TestNonceManager] A nonce used without an nc should not be accepted again with nc %d.", nc)
+		}
+	}
+	if err := m.Use("abc", 1); !errors.Is(err, ErrDigestStale) {
+		t.Errorf("[TestNonceManager] An unknown nonce should be an ErrDigestStale.")
+	}
+	now = now.Add(time.Minute)
+	if m.Valid(n) {
+		t.Errorf("[TestNonceManager] Nonce should have expired.")
+	}
+	if err := m.Use(n, 2); !errors.Is(err, ErrDigestStale) {
+		t.Errorf("[TestNonceManager] An expired nonce should be an ErrDigestStale.")
+	}
+	m.New()
+	if len(m.nonces) != 1 {
+		t.Errorf("[TestNonceManager] Expired nonces should be purged.  Received: %d nonces", len(m.nonces))
+	}
+	if NewNonceManager(0).TTL != DIGEST_NONCE_TTL {
+		t.Errorf("[TestNonceManager] A ttl of 0 should be DIGEST_NONCE_TTL.")
+	}
+}
+
+func TestDigestChallenge(t *testing.T) {
+	now := time.Unix(1000, 0)
+	v := NewDigestVerifier("atlanta.com", PasswordStore{"bob": "zanzibar"})
+	v.Nonces = NewNonceManager(time.Minute)
+	v.Nonces.Now = func() time.Time { return now }
+	c := NewDigestClient("bob", "zanzibar")
+	req := NewRequest(SIP_METHOD_REGISTER, ParseURI("sip:registrar.atlanta.com"))
+	chal := v.ChallengeResponse(req, false, DIGEST_ALG_SHA256, false)
+	str := chal.String()
+	if !strings.Contains(str, "SIP/2.0 401 Unauthorized\r\n") || !strings.Contains(str, `WWW-Authenticate: Digest realm="atlanta.com", nonce="`) || !strings.Contains(str, `, algorithm=SHA-256, qop="auth"`+"\r\n") {
+		t.Errorf("[TestDigestChallenge] Challenge was not rendered correctly.  Received: %s", str)
+	}
+	resp := ParseMsg(str)
+	if err := c.Authorize(req, resp); err != nil {
+		t.Fatalf("[TestDigestChallenge] Error answering challenge.  Received: %s", err.Error())
+	}
+	if strings.Contains(req.String(), `qop="auth"`) {
+		t.Errorf("[TestDigestChallenge] The qop of credentials should not be quoted.")
+	}
+	rcvd := ParseMsg(req.String())
+	if err := v.VerifyRequest(rcvd, false); err != nil {
+		t.Fatalf("[TestDigestChallenge] Error verifying credentials.  Received: %s", err.Error())
+	}
+	info, err := v.AuthenticationInfo(rcvd.GetAuthorization(), "")
+	if err != nil {
+		t.Fatalf("[TestDigestChallenge] Error getting Authentication-Info.  Received: %s", err.Error())
+	}
+	auth := rcvd.GetAuthorization()
+	ha1, _ := DigestHA1(DIGEST_ALG_SHA256, "bob", "atlanta.com", "zanzibar")
+	rspauth, _ := DigestResponse(ha1, &DigestParams{Algorithm: DIGEST_ALG_SHA256, Nonce: auth.Nonce, CNonce: auth.CNonce, NC: "00000001", QOP: DIGEST_QOP_AUTH, URI: auth.URI})
+	if !v.Nonces.Valid(info.NextNonce) || info.RspAuth != rspauth || info.CNonce != auth.CNonce || info.NC != "00000001" || info.Qop != DIGEST_QOP_AUTH {
+		t.Errorf("[TestDigestChallenge] Authentication-Info is wrong.  Received: %s", info.String())
+	}
+	// the nonce expires so the right password gets a stale challenge
+	now = now.Add(time.Minute)
+	if err := c.Authorize(req, resp); err != nil {
+		t.Fatalf("[TestDigestChallenge] Error answering challenge.  Received: %s", err.Error())
+	}
+	err = v.VerifyRequest(ParseMsg(req.String()), false)
+	if !errors.Is(err, ErrDigestStale) {
+		t.Fatalf("[TestDigestChallenge] An expired nonce should be an ErrDigestStale.")
+	}
+	stale := ParseMsg(v.ChallengeResponse(req, true, "", true).String())
+	if stale.StartLine.Resp != "407" || !stale.GetProxyAuthenticate().Stale || stale.GetProxyAuthenticate().GetParam("algorithm") != nil {
+		t.Errorf("[TestDigestChallenge] Stale challenge is wrong.  Received: %s", stale.Msg)
+	}
+	if err := c.Authorize(req, stale); err != nil {
+		t.Fatalf("[TestDigestChallenge] Error answering challenge.  Received: %s", err.Error())
+	}
+	if err := v.VerifyRequest(ParseMsg(req.String()), true); err != nil {
+		t.Errorf("[TestDigestChallenge] Error verifying credentials for the new nonce.  Received: %s", err.Error())
+	}
+	// a wrong password is never stale
+	if err := NewDigestClient("bob", "wrong").Authorize(req, resp); err != nil {
+		t.Fatalf("[TestDigestChallenge] Error answering challenge.  Received: %s", err.Error())
+	}
+	if err := v.VerifyRequest(req, false); !errors.Is(err, ErrDigestResponse) {
+		t.Errorf("[TestDigestChallenge] A wrong password should be an ErrDigestResponse.")
+	}
+}
+
+func TestDigestVerifierSeenNonces(t *testing.T) {
+	// without .Nonces the nonces a client sends are only remembered
+	// for the ttl
+	now := time.Unix(1000, 0)
+	v := NewDigestVerifier("atlanta.com", PasswordStore{"bob": "zanzibar"})
+	v.seen = NewNonceManager(time.Minute)
+	v.seen.Now = func() time.Time { return now }
+	c := NewDigestClient("bob", "zanzibar")
+	req := NewRequest(SIP_METHOD_REGISTER, ParseURI("sip:registrar.atlanta.com"))
+	if err := c.Authorize(req, digestChallenge("401", "WWW-Authenticate", `Digest realm="atlanta.com", nonce="n1"`)); err != nil {
+		t.Fatalf("[TestDigestVerifierSeenNonces] Error answering challenge.  Received: %s", err.Error())
+	}
+	rcvd := ParseMsg(req.String())
+	if err := v.VerifyRequest(rcvd, false); err != nil {
+		t.Fatalf("[TestDigestVerifierSeenNonces] Error verifying credentials.  Received: %s", err.Error())
+	}
+	if err := v.VerifyRequest(rcvd, false); !errors.Is(err, ErrDigestNonceCount) {
+		t.Errorf("[TestDigestVerifierSeenNonces] Replayed credentials without a qop should be an ErrDigestNonceCount.")
+	}
+	now = now.Add(time.Minute)
+	if err := c.Authorize(req, digestChallenge("401", "WWW-Authenticate", `Digest realm="atlanta.com", nonce="n2", qop="auth"`)); err != nil {
+		t.Fatalf("[TestDigestVerifierSeenNonces] Error answering challenge.  Received: %s", err.Error())
+	}
+	if err := v.VerifyRequest(ParseMsg(req.String()), false); err != nil {
+		t.Errorf("[TestDigestVerifierSeenNonces] Error verifying credentials.  Received: %s", err.Error())
+	}
+	if len(v.seen.nonces) != 1 {
+		t.Errorf("[TestDigestVerifierSeenNonces] Nonces older than the ttl should be dropped.  Received: %d nonces", len(v.seen.nonces))
+	}
+}
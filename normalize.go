@@ -0,0 +1,135 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"sort"
+	"strings"
+)
+
+// uriLowerParams are the uri params whose values are not case
+// sensitive and are lower cased by Normalize.  The method param is
+// left alone as methods are case sensitive.
+var uriLowerParams = map[string]bool{
+	"transport": true,
+	"user":      true,
+	"maddr":     true,
+	"lr":        true,
+	"comp":      true,
+}
+
+// absDefaultPorts are the default ports of the absolute uri schemes
+// that have one
+var absDefaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// defaultPort returns the port that is used for the uri when it does
+// not have one (RFC 3263 4.2 and RFC 7118 for ws and wss) or "" if
+// there is no default
+func (u *URI) defaultPort() string {
+	switch u.Scheme {
+	case SIP_SCHEME, SIPS_SCHEME:
+		switch strings.ToLower(u.Transport()) {
+		case "ws":
+			if u.Scheme == SIPS_SCHEME {
+				return "443"
+			}
+			return "80"
+		case "wss":
+			return "443"
+		case "tls":
+			return "5061"
+		}
+		if u.Scheme == SIPS_SCHEME {
+			return "5061"
+		}
+		return "5060"
+	}
+	return absDefaultPorts[u.Scheme]
+}
+
+// sortParams sorts p by the param name (which is not case sensitive)
+// keeping params with the same name in the order they were in
+func sortParams(p []*Param) {
+	sort.SliceStable(p, func(i, j int) bool {
+		return strings.ToLower(p[i].Param) < strings.ToLower(p[j].Param)
+	})
+}
+
+// Normalize rewrites the uri into a canonical form so that uris
+// for the same target render the same (i.e. sip:Alice@EXAMPLE.com:5060
+// and sip:Alice@example.com).  It:
+// -- lower cases the scheme, host and the names of the params and
+// headers (and the values of the transport, user, maddr, lr and comp
+// params)
+// -- drops the port if it is the default for the scheme and transport
+// -- sorts the params and headers by name
+// -- for a tel uri drops the visual separators from the number
+// The user, password, params and headers are already stored with any
+// escaped chars decoded and String only escapes what it has to so
+// unreserved chars that were escaped are rendered unescaped.  The
+// user and user params are case sensitive and are left alone.  .Raw,
+// .UserInfo and .HostInfo are not changed.
+func (u *URI) Normalize() {
+	if u == nil || u.Error != nil {
+		return
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	switch {
+	case u.Tel != nil:
+		u.Tel.normalize()
+		u.User = u.Tel.Number
+		u.UriParams = append(u.UriParams[0:0], u.Tel.params()...)
+		return
+	case u.URN != nil:
+		if u.URN.NID == URN_NID_SERVICE {
+			u.URN.NSS = strings.ToLower(u.URN.NSS)
+		}
+		return
+	}
+	u.Host = strings.ToLower(u.Host)
+	for i := range u.UriParams {
+		u.UriParams[i].Param = strings.ToLower(u.UriParams[i].Param)
+		if uriLowerParams[u.UriParams[i].Param] {
+			u.UriParams[i].Val = strings.ToLower(u.UriParams[i].Val)
+		}
+	}
+	for i := range u.Headers {
+		u.Headers[i].Param = strings.ToLower(u.Headers[i].Param)
+	}
+	sortParams(u.UriParams)
+	sortParams(u.Headers)
+	if u.Port != "" && u.Port == u.defaultPort() {
+		u.Port = ""
+	}
+}
+
+// Canonical returns the normalized uri (see Normalize) rendered as a
+// string without changing u.  It is meant to be used as a key (i.e.
+// in a routing table) and can also be put back on the wire.
+func (u *URI) Canonical() string {
+	if u == nil {
+		return ""
+	}
+	n := u.clone()
+	n.Normalize()
+	return n.String()
+}
+
+// normalize lower cases the param names and phone-context and drops
+// the visual separators from the number
+func (t *TelURI) normalize() {
+	t.Number = t.Digits()
+	t.PhoneContext = strings.ToLower(t.PhoneContext)
+	for i := range t.Params {
+		t.Params[i].Param = strings.ToLower(t.Params[i].Param)
+	}
+	sortParams(t.Params)
+}
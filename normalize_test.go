@@ -0,0 +1,53 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		uri       string
+		canonical string
+	}{
+		{"SIP:Alice@EXAMPLE.com:5060;Transport=UDP", "sip:Alice@example.com;transport=udp"},
+		{"sip:Alice@example.com;transport=udp", "sip:Alice@example.com;transport=udp"},
+		{"sip:alice@example.com:5061;transport=TLS", "sip:alice@example.com;transport=tls"},
+		{"sips:alice@example.com:5061", "sips:alice@example.com"},
+		{"sips:alice@example.com:5060", "sips:alice@example.com:5060"},
+		{"sip:alice@example.com:5061", "sip:alice@example.com:5061"},
+		{"sip:alice@example.com:80;transport=ws", "sip:alice@example.com;transport=ws"},
+		{"sip:%61lice@example.com;lr;maddr=10.0.0.1;Foo=Bar", "sip:alice@example.com;foo=Bar;lr;maddr=10.0.0.1"},
+		{"sip:bob@[2001:DB8::1]?Subject=hi&Priority=urgent", "sip:bob@[2001:db8::1]?priority=urgent&subject=hi"},
+		{"sip:+1-212-555-0100;NPDI@gw.com;user=phone", "sip:+1-212-555-0100;NPDI@gw.com;user=phone"},
+		{"tel:+1-212-555-0100;Foo=1;ext=12", "tel:+12125550100;ext=12;foo=1"},
+		{"urn:service:SOS", "urn:service:sos"},
+		{"HTTP://Example.COM:80/Path", "http://example.com/Path"},
+	}
+	for _, tt := range tests {
+		u := ParseURI(tt.uri)
+		if u.Error != nil {
+			t.Errorf("[TestNormalize] Error parsing %q.  Received: %s", tt.uri, u.Error.Error())
+			continue
+		}
+		if c := u.Canonical(); c != tt.canonical {
+			t.Errorf("[TestNormalize] Canonical of %q should be %q.  Received: %q", tt.uri, tt.canonical, c)
+		}
+		if u.String() != ParseURI(tt.uri).String() {
+			t.Errorf("[TestNormalize] Canonical should not change the uri %q.", tt.uri)
+		}
+		// the canonical form has to parse back to itself
+		if c := ParseURI(tt.canonical); c.Error != nil || c.Canonical() != tt.canonical {
+			t.Errorf("[TestNormalize] Canonical %q does not parse back to itself.", tt.canonical)
+		}
+	}
+	u := ParseURI("sip:Alice@EXAMPLE.com:5060;transport=UDP")
+	u.Normalize()
+	if u.Host != "example.com" || u.Port != "" || u.Transport() != "udp" || u.Raw != "sip:Alice@EXAMPLE.com:5060;transport=UDP" {
+		t.Errorf("[TestNormalize] Normalize did not update the uri correctly.")
+	}
+}
@@ -11,9 +11,13 @@ import (
 
 // Param is just a struct that holds a parameter and a value
 // As an example of this would be something like user=phone
+// Quoted is only set by the parsers of the auth hdrs (which keep the
+// value of a quoted-string in Val without the quotes) so that the
+// param is rendered the way it was received.
 type Param struct {
-	Param string "param"
-	Val   string "val"
+	Param  string "param"
+	Val    string "val"
+	Quoted bool
 }
 
 // getParam is just a convenience function to pass a string
@@ -33,3 +37,25 @@ func getParam(s string) *Param {
 	p.Param = strings.TrimSpace(s)
 	return p
 }
+
+// String returns the param as param=val (or just param if there
+// is no val)
+func (p *Param) String() string {
+	if p.Val == "" {
+		return p.Param
+	}
+	return p.Param + "=" + p.Val
+}
+
+// cloneParams returns a copy of the params
+func cloneParams(p []*Param) []*Param {
+	if p == nil {
+		return nil
+	}
+	n := make([]*Param, len(p))
+	for i := range p {
+		c := *p[i]
+		n[i] = &c
+	}
+	return n
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"unsafe"
 )
 
 const (
@@ -36,63 +37,110 @@ func (h *Header) String() string {
 	return fmt.Sprintf("%s: %s", h.Header, h.Val)
 }
 
+// RawHeader holds a hdr exactly as it was received.  Every hdr in a
+// msg gets a RawHeader (in order) whether or not it is also parsed
+// into one of the typed fields of the *SipMsg.
+// -- Name is the hdr name as received (i.e. "v" or "VIA")
+// -- Canonical is the long form lower case name (i.e. "via")
+// -- Val is the value with any folded lines joined
+// -- Line is the line number of the hdr (starting at 1 for the start
+// line) or of its first line if it was folded
+// -- Start is the offset of the first byte of the hdr in .Msg
+// -- End is the offset just past the last byte of the hdr in .Msg
+// (so .Msg[Start:End] is the hdr exactly as it appeared on the wire)
+type RawHeader struct {
+	Name      string
+	Canonical string
+	Val       string
+	Line      int
+	Start     int
+	End       int
+}
+
+func (h *RawHeader) String() string {
+	return h.Name + ": " + h.Val
+}
+
 type sipParserStateFn func(s *SipMsg) sipParserStateFn
 
 type SipMsg struct {
-	State              string
-	Error              error
-	Msg                string
-	CallingParty       *CallingPartyInfo
-	Body               string
-	StartLine          *StartLine
-	Headers            []*Header
-	Accept             *Accept
-	AlertInfo          string
-	Allow              []string
-	AllowEvents        []string
-	Authorization      *Authorization
-	ContentDisposition *ContentDisposition
-	ContentLength      string
-	ContentLengthInt   int
-	ContentType        string
-	From               *From
-	MaxForwards        string
-	MaxForwardsInt     int
-	Organization       string
-	To                 *From
-	Contact            *From
-	ContactVal         string
-	CallId             string
-	Cseq               *Cseq
-	Rack               *Rack
-	Reason             *Reason
-	Rseq               string
-	RseqInt            int
-	RecordRoute        []*URI
-	Route              []*URI
-	Via                []*Via
-	Require            []string
-	Supported          []string
-	Privacy            string
-	ProxyAuthenticate  *Authorization
-	ProxyRequire       []string
-	RemotePartyIdVal   string
-	RemotePartyId      *RemotePartyId
-	PAssertedIdVal     string
-	PAssertedId        *PAssertedId
-	Unsupported        []string
-	UserAgent          string
-	Server             string
-	Subject            string
-	Warning            *Warning
-	WWWAuthenticate    *Authorization
-	eof                int
-	hdr                string
-	hdrv               string
+	State               string
+	Error               error
+	Errors              []*ParseError
+	Msg                 string
+	CallingParty        *CallingPartyInfo
+	Body                string
+	StartLine           *StartLine
+	Headers             []*Header
+	RawHeaders          []*RawHeader
+	Accept              *Accept
+	AlertInfo           string
+	Allow               []string
+	AllowEvents         []string
+	AuthenticationInfo  *AuthenticationInfo
+	Authorization       *Authorization
+	Authorizations      []*Authorization
+	ContentDisposition  *ContentDisposition
+	ContentLength       string
+	ContentLengthInt    int
+	ContentType         string
+	From                *From
+	MaxForwards         string
+	MaxForwardsInt      int
+	Organization        string
+	To                  *From
+	Contact             *From
+	ContactVal          string
+	Contacts            []*Contact
+	CallId              string
+	Cseq                *Cseq
+	Rack                *Rack
+	Reason              *Reason
+	Rseq                string
+	RseqInt             int
+	RecordRoute         []*URI
+	Route               []*URI
+	Via                 []*Via
+	Require             []string
+	Supported           []string
+	Privacy             string
+	ProxyAuthenticate   *Authorization
+	ProxyAuthenticates  []*Authorization
+	ProxyAuthorization  *Authorization
+	ProxyAuthorizations []*Authorization
+	ProxyRequire        []string
+	RemotePartyIdVal    string
+	RemotePartyId       *RemotePartyId
+	PAssertedIdVal      string
+	PAssertedId         *PAssertedId
+	Unsupported         []string
+	UserAgent           string
+	Server              string
+	Subject             string
+	Warning             *Warning
+	WWWAuthenticate     *Authorization
+	WWWAuthenticates    []*Authorization
+	eof                 int
+	hdr                 string
+	hdrv                string
+	hdrOrder            []hdrRef
+	rawHdrs             []RawHeader
+	hdrStart            int
+	hdrEnd              int
+	hdrLine             int
+	curHdr              *RawHeader
+	spare               msgSpares
+	lazy                bool
+	strict              bool
+	contactsParsed      bool
+	strictRouted        bool
+	lazyParsed          uint64
 }
 
 func (s *SipMsg) run() {
-	s.Headers = make([]*Header, 0)
+	if s.Headers == nil {
+		s.Headers = make([]*Header, 0)
+	}
 	for state := parseSip; state != nil; {
 		state = state(s)
 	}
@@ -107,42 +155,101 @@ func (s *SipMsg) addErrorNoReturn(err string) {
 	s.Error = errors.New(err)
 }
 
+// addParseError records e in .Errors.  .Error is only set for the
+// first one so that it still says whether or not the msg was clean.
+func (s *SipMsg) addParseError(e *ParseError) {
+	s.Errors = append(s.Errors, e)
+	if s.Error == nil {
+		s.Error = e
+	}
+}
+
+// hdrErr records err (if it is not nil) as a ParseError for the hdr
+// that is being parsed.  If the hdr is being parsed on demand (i.e.
+// by ParseContact) the error is for the first hdr with the name.
+func (s *SipMsg) hdrErr(hdr string, err error) {
+	if err == nil {
+		return
+	}
+	raw := s.curHdr
+	if raw == nil || raw.Canonical != hdr {
+		raw = s.GetHeader(hdr)
+	}
+	e := &ParseError{Header: hdr, Kind: PARSE_ERR_HDR_VAL, Err: err}
+	if raw != nil {
+		e.Line, e.Offset, e.Value = raw.Line, raw.Start, raw.Val
+	}
+	s.addParseError(e)
+}
+
 func (s *SipMsg) addHdr(str string) {
 	if str == "" {
 		return
 	}
 	sp := strings.IndexRune(str, ':')
 	if sp == -1 {
-		s.Error = errors.New("addHdr err: no semi found in: " + str)
+		s.addParseError(&ParseError{Line: s.hdrLine, Offset: s.hdrStart, Value: str, Kind: PARSE_ERR_HDR, Err: fmt.Errorf("%w: addHdr err: no semi found in: %s", ErrBadHeader, str)})
 		return
 	}
-	s.hdr = strings.ToLower(strings.TrimSpace(str[0:sp]))
+	name := strings.TrimSpace(str[0:sp])
+	s.hdr = canonicalHdr(name)
 	switch {
 	case len(str)-1 > sp+1:
 		s.hdrv = cleanWs(str[sp+1:])
 	default:
 		s.hdrv = ""
 	}
+	s.rawHdrs = append(s.rawHdrs, RawHeader{Name: name, Canonical: s.hdr, Val: strings.TrimSpace(str[sp+1:]), Line: s.hdrLine, Start: s.hdrStart, End: s.hdrEnd})
+	raw := &s.rawHdrs[len(s.rawHdrs)-1]
+	s.RawHeaders = append(s.RawHeaders, raw)
+	s.spare.rawHeaders = s.RawHeaders
+	if s.strict {
+		if rule := checkHdr(name, s.hdr, raw.Val); rule != "" {
+			kind := PARSE_ERR_HDR_VAL
+			if rule == "header-name" {
+				kind = PARSE_ERR_HDR
+			}
+			s.grammarErr(kind, s.hdr, rule, raw.Val)
+		}
+	}
+	ref := hdrRef{hdr: s.hdr, raw: raw}
+	if s.lazy && lazyHdrBits[s.hdr] != 0 {
+		// only indexed for now ... see lazy.go
+		ref.lazy = true
+		s.hdrOrder = append(s.hdrOrder, ref)
+		return
+	}
+	s.parseHdr(&ref)
+	s.hdrOrder = append(s.hdrOrder, ref)
+}
+
+// parseHdr parses the value in .hdrv into the typed field for the
+// hdr in .hdr and records where it went in ref
+func (s *SipMsg) parseHdr(ref *hdrRef) {
+	ref.pos = s.hdrListLen(ref.hdr)
+	s.curHdr = ref.raw
 	switch {
 	case s.hdr == SIP_HDR_ACCEPT:
 		s.parseAccept(s.hdrv)
 	case s.hdr == SIP_HDR_ALLOW:
 		s.parseAllow(s.hdrv)
-	case s.hdr == SIP_HDR_ALLOW_EVENTS || s.hdr == SIP_HDR_ALLOW_EVENTS_CMP:
+	case s.hdr == SIP_HDR_ALLOW_EVENTS:
 		s.parseAllowEvents(s.hdrv)
+	case s.hdr == SIP_HDR_AUTHENTICATION_INFO:
+		s.parseAuthenticationInfo(s.hdrv)
 	case s.hdr == SIP_HDR_AUTHORIZATION:
 		s.parseAuthorization(s.hdrv)
-	case s.hdr == SIP_HDR_CALL_ID || s.hdr == SIP_HDR_CALL_ID_CMP:
+	case s.hdr == SIP_HDR_CALL_ID:
 		s.CallId = s.hdrv
-	case s.hdr == SIP_HDR_CONTACT || s.hdr == SIP_HDR_CONTACT_CMP:
+	case s.hdr == SIP_HDR_CONTACT:
 		s.ContactVal = s.hdrv
 	case s.hdr == SIP_HDR_CONTENT_DISPOSITION:
 		s.parseContentDisposition(s.hdrv)
-	case s.hdr == SIP_HDR_CONTENT_LENGTH || s.hdr == SIP_HDR_CONTENT_LENGTH_CMP:
+	case s.hdr == SIP_HDR_CONTENT_LENGTH:
 		s.ContentLength = s.hdrv
 	case s.hdr == SIP_HDR_CSEQ:
 		s.parseCseq(s.hdrv)
-	case s.hdr == SIP_HDR_FROM || s.hdr == SIP_HDR_FROM_CMP:
+	case s.hdr == SIP_HDR_FROM:
 		s.parseFrom(s.hdrv)
 	case s.hdr == SIP_HDR_MAX_FORWARDS:
 		s.MaxForwards = s.hdrv
@@ -156,6 +263,8 @@ func (s *SipMsg) addHdr(str string) {
 		s.Privacy = s.hdrv
 	case s.hdr == SIP_HDR_PROXY_AUTHENTICATE:
 		s.parseProxyAuthenticate(s.hdrv)
+	case s.hdr == SIP_HDR_PROXY_AutHORIZATION:
+		s.parseProxyAuthorization(s.hdrv)
 	case s.hdr == SIP_HDR_RACK:
 		s.parseRack(s.hdrv)
 	case s.hdr == SIP_HDR_REASON:
@@ -170,44 +279,80 @@ func (s *SipMsg) addHdr(str string) {
 		s.Server = s.hdrv
 	case s.hdr == SIP_HDR_SUPPORTED:
 		s.parseSupported(s.hdrv)
-	case s.hdr == SIP_HDR_TO || s.hdr == SIP_HDR_TO_CMP:
+	case s.hdr == SIP_HDR_TO:
 		s.parseTo(s.hdrv)
 	case s.hdr == SIP_HDR_UNSUPPORTED:
 		s.parseUnsupported(s.hdrv)
 	case s.hdr == SIP_HDR_USER_AGENT:
 		s.UserAgent = s.hdrv
-	case s.hdr == SIP_HDR_VIA || s.hdr == SIP_HDR_VIA_CMP:
+	case s.hdr == SIP_HDR_VIA:
 		s.parseVia(s.hdrv)
 	case s.hdr == SIP_HDR_WARNING:
 		s.parseWarning(s.hdrv)
 	case s.hdr == SIP_HDR_WWW_AUTHENTICATE:
 		s.parseWWWAuthenticate(s.hdrv)
 	default:
-		s.Headers = append(s.Headers, &Header{s.hdr, s.hdrv})
+		s.Headers = append(s.Headers, s.newHeader(s.hdr, s.hdrv))
+		s.spare.headers = s.Headers
 	}
+	ref.n = s.hdrListLen(ref.hdr) - ref.pos
+	s.curHdr = nil
 }
 
-func (s *SipMsg) GetRURIParamBool(str string) bool {
-	if s.StartLine == nil || s.StartLine.URI == nil {
-		return false
+// GetHeader returns the first *RawHeader with the name (or nil if
+// there isn't one).  The compact and long forms of a hdr name are
+// treated as the same hdr (i.e. "v" and "via").
+func (s *SipMsg) GetHeader(name string) *RawHeader {
+	name = canonicalHdr(name)
+	for i := range s.RawHeaders {
+		if s.RawHeaders[i].Canonical == name {
+			return s.RawHeaders[i]
+		}
 	}
-	for i := range s.StartLine.URI.UriParams {
-		if s.StartLine.URI.UriParams[i].Param == str {
-			return true
+	return nil
+}
+
+// GetHeaders returns every *RawHeader with the name in the order
+// they were received.  Just like GetHeader the compact and long
+// forms of the name are treated as the same hdr.
+func (s *SipMsg) GetHeaders(name string) []*RawHeader {
+	var hdrs []*RawHeader
+	name = canonicalHdr(name)
+	for i := range s.RawHeaders {
+		if s.RawHeaders[i].Canonical == name {
+			hdrs = append(hdrs, s.RawHeaders[i])
 		}
 	}
-	return false
+	return hdrs
 }
 
-func (s *SipMsg) GetRURIParamVal(str string) string {
+// getRURIParam returns the param from the uri params (or the user
+// params) of the request uri
+func (s *SipMsg) getRURIParam(str string) *Param {
 	if s.StartLine == nil || s.StartLine.URI == nil {
-		return ""
+		return nil
 	}
 	for i := range s.StartLine.URI.UriParams {
 		if s.StartLine.URI.UriParams[i].Param == str {
-			return s.StartLine.URI.UriParams[i].Val
+			return s.StartLine.URI.UriParams[i]
 		}
 	}
+	for i := range s.StartLine.URI.UserParams {
+		if s.StartLine.URI.UserParams[i].Param == str {
+			return s.StartLine.URI.UserParams[i]
+		}
+	}
+	return nil
+}
+
+func (s *SipMsg) GetRURIParamBool(str string) bool {
+	return s.getRURIParam(str) != nil
+}
+
+func (s *SipMsg) GetRURIParamVal(str string) string {
+	if p := s.getRURIParam(str); p != nil {
+		return p.Val
+	}
 	return ""
 }
 
@@ -224,7 +369,7 @@ func (s *SipMsg) GetCallingParty(str string) error {
 }
 
 func (s *SipMsg) getCallingPartyDefault() error {
-	if s.From == nil {
+	if s.GetFrom() == nil {
 		return errors.New("getCallingPartyDefault err: no from header found.")
 	}
 	if s.From.URI == nil {
@@ -240,8 +385,8 @@ func (s *SipMsg) getCallingPartyPaid() error {
 			return s.getCallingPartyDefault()
 		}
 		s.parsePAssertedId(s.PAssertedIdVal)
-		if s.Error != nil {
-			return s.Error
+		if s.PAssertedId.Error != nil {
+			return s.PAssertedId.Error
 		}
 		if s.PAssertedId.URI == nil {
 			return errors.New("getCallingPartyPaid err: p-asserted-id uri is nil.")
@@ -262,8 +407,8 @@ func (s *SipMsg) getCallingPartyRpid() error {
 			return s.getCallingPartyDefault()
 		}
 		s.parseRemotePartyId(s.RemotePartyIdVal)
-		if s.Error != nil {
-			return s.Error
+		if s.RemotePartyId.Error != nil {
+			return s.RemotePartyId.Error
 		}
 		if s.RemotePartyId.URI == nil {
 			return errors.New("getCallingPartyRpid err: remote party id uri is nil.")
@@ -284,29 +429,27 @@ func (s *SipMsg) parseAccept(str string) {
 }
 
 func (s *SipMsg) parseAllow(str string) {
-	s.Allow = getCommaSeperated(str)
-	if s.Allow == nil {
-		s.Allow = []string{str}
-	}
+	s.Allow = appendList(s.Allow, str)
 }
 
 func (s *SipMsg) parseAllowEvents(str string) {
-	s.AllowEvents = getCommaSeperated(str)
-	if s.AllowEvents == nil {
-		s.Allow = []string{str}
-	}
+	s.AllowEvents = appendList(s.AllowEvents, str)
+}
+
+func (s *SipMsg) parseAuthenticationInfo(str string) {
+	s.AuthenticationInfo = &AuthenticationInfo{Val: str}
+	s.hdrErr(SIP_HDR_AUTHENTICATION_INFO, s.AuthenticationInfo.parse())
 }
 
 func (s *SipMsg) parseAuthorization(str string) {
-	s.Authorization = &Authorization{Val: str}
-	s.Error = s.Authorization.parse()
+	l := s.parseAuths(SIP_HDR_AUTHORIZATION, str)
+	s.Authorizations = append(s.Authorizations, l...)
+	s.Authorization = s.Authorizations[len(s.Authorizations)-1]
 }
 
 func (s *SipMsg) parseContact(str string) {
 	s.Contact = getFrom(str)
-	if s.Contact.Error != nil {
-		s.Error = s.Contact.Error
-	}
+	s.hdrErr(SIP_HDR_CONTACT, s.Contact.Error)
 }
 
 func (s *SipMsg) ParseContact(str string) {
@@ -319,23 +462,27 @@ func (s *SipMsg) parseContentDisposition(str string) {
 }
 
 func (s *SipMsg) parseCseq(str string) {
-	s.Cseq = &Cseq{Val: str}
-	s.Error = s.Cseq.parse()
+	switch {
+	case s.spare.cseq != nil:
+		s.Cseq = s.spare.cseq
+		*s.Cseq = Cseq{Val: str}
+	default:
+		s.Cseq = &Cseq{Val: str}
+		s.spare.cseq = s.Cseq
+	}
+	s.hdrErr(SIP_HDR_CSEQ, s.Cseq.parse())
 }
 
 func (s *SipMsg) parseFrom(str string) {
-	s.From = getFrom(str)
-	if s.From.Error != nil {
-		s.Error = s.From.Error
-	}
+	s.From = reuseFrom(s.spare.from, str)
+	s.spare.from = s.From
+	s.hdrErr(SIP_HDR_FROM, s.From.Error)
 }
 
 func (s *SipMsg) parsePAssertedId(str string) {
 	s.PAssertedId = &PAssertedId{Val: str}
 	s.PAssertedId.parse()
-	if s.PAssertedId.Error != nil {
-		s.Error = s.PAssertedId.Error
-	}
+	s.hdrErr(SIP_HDR_P_ASSERTED_IDENTITY, s.PAssertedId.Error)
 }
 
 func (s *SipMsg) ParsePAssertedId(str string) {
@@ -343,13 +490,20 @@ func (s *SipMsg) ParsePAssertedId(str string) {
 }
 
 func (s *SipMsg) parseProxyAuthenticate(str string) {
-	s.ProxyAuthenticate = &Authorization{Val: str}
-	s.Error = s.ProxyAuthenticate.parse()
+	l := s.parseAuths(SIP_HDR_PROXY_AUTHENTICATE, str)
+	s.ProxyAuthenticates = append(s.ProxyAuthenticates, l...)
+	s.ProxyAuthenticate = s.ProxyAuthenticates[len(s.ProxyAuthenticates)-1]
+}
+
+func (s *SipMsg) parseProxyAuthorization(str string) {
+	l := s.parseAuths(SIP_HDR_PROXY_AutHORIZATION, str)
+	s.ProxyAuthorizations = append(s.ProxyAuthorizations, l...)
+	s.ProxyAuthorization = s.ProxyAuthorizations[len(s.ProxyAuthorizations)-1]
 }
 
 func (s *SipMsg) parseRack(str string) {
 	s.Rack = &Rack{Val: str}
-	s.Error = s.Rack.parse()
+	s.hdrErr(SIP_HDR_RACK, s.Rack.parse())
 }
 
 func (s *SipMsg) parseReason(str string) {
@@ -358,28 +512,15 @@ func (s *SipMsg) parseReason(str string) {
 }
 
 func (s *SipMsg) parseRecordRoute(str string) {
-	cs := getCommaSeperated(str)
-	for rt := range cs {
-		left := 0
-		right := 0
-		for i := range cs[rt] {
-			if cs[rt][i] == '<' && left == 0 {
-				left = i
-			}
-			if cs[rt][i] == '>' && right == 0 {
-				right = i
-			}
-		}
-		if left < right {
-			u := ParseURI(cs[rt][left+1 : right])
+	for _, rt := range splitList(str, ',') {
+		if left, right, ok := getBracks(rt); ok {
+			u := s.newURI(rt[left+1 : right])
 			if u.Error != nil {
-				s.Error = errors.New("parseRecordRoute err: received err parsing uri: " + u.Error.Error())
-				return
-			}
-			if s.RecordRoute == nil {
-				s.RecordRoute = []*URI{u}
+				s.hdrErr(SIP_HDR_RECORD_ROUTE, fmt.Errorf("parseRecordRoute err: received err parsing uri: %w", u.Error))
+				continue
 			}
 			s.RecordRoute = append(s.RecordRoute, u)
+			s.spare.recordRoute = s.RecordRoute
 		}
 	}
 	return
@@ -388,9 +529,7 @@ func (s *SipMsg) parseRecordRoute(str string) {
 func (s *SipMsg) parseRemotePartyId(str string) {
 	s.RemotePartyId = &RemotePartyId{Val: str}
 	s.RemotePartyId.parse()
-	if s.RemotePartyId.Error != nil {
-		s.Error = s.RemotePartyId.Error
-	}
+	s.hdrErr(SIP_HDR_REMOTE_PARTY_ID, s.RemotePartyId.Error)
 }
 
 func (s *SipMsg) ParseRemotePartyId(str string) {
@@ -398,90 +537,73 @@ func (s *SipMsg) ParseRemotePartyId(str string) {
 }
 
 func (s *SipMsg) parseRequire(str string) {
-	s.Require = getCommaSeperated(str)
-	if s.Require == nil {
-		s.Require = []string{str}
-	}
+	s.Require = splitList(str, ',')
 }
 
 func (s *SipMsg) parseRoute(str string) {
-	cs := getCommaSeperated(str)
-	for rt := range cs {
-		left := 0
-		right := 0
-		for i := range cs[rt] {
-			if cs[rt][i] == '<' && left == 0 {
-				left = i
-			}
-			if cs[rt][i] == '>' && right == 0 {
-				right = i
-			}
-		}
-		if left < right {
-			u := ParseURI(cs[rt][left+1 : right])
+	for _, rt := range splitList(str, ',') {
+		if left, right, ok := getBracks(rt); ok {
+			u := s.newURI(rt[left+1 : right])
 			if u.Error != nil {
-				s.Error = errors.New("parseRoute err: received err parsing uri: " + u.Error.Error())
-				return
-			}
-			if s.Route == nil {
-				s.Route = []*URI{u}
+				s.hdrErr(SIP_HDR_ROUTE, fmt.Errorf("parseRoute err: received err parsing uri: %w", u.Error))
+				continue
 			}
 			s.Route = append(s.Route, u)
+			s.spare.route = s.Route
 		}
 	}
 }
 
 func (s *SipMsg) parseStartLine(str string) {
 	s.State = sipParseStateStartLine
-	s.StartLine = ParseStartLine(str)
+	s.StartLine = reuseStartLine(s.spare.startLine, str)
+	s.spare.startLine = s.StartLine
 	if s.StartLine.Error != nil {
-		s.Error = errors.New("parseStartLine err: received err while parsing start line: " + s.StartLine.Error.Error())
+		s.addParseError(&ParseError{Line: 1, Value: str, Kind: PARSE_ERR_START_LINE, Err: fmt.Errorf("parseStartLine err: received err while parsing start line: %w", s.StartLine.Error)})
 	}
 }
 
 func (s *SipMsg) parseSupported(str string) {
-	s.Supported = getCommaSeperated(str)
-	if s.Supported == nil {
-		s.Supported = []string{str}
-	}
+	s.Supported = appendList(s.Supported, str)
 }
 
 func (s *SipMsg) parseTo(str string) {
-	s.To = getFrom(str)
-	if s.To.Error != nil {
-		s.Error = s.To.Error
-	}
+	s.To = reuseFrom(s.spare.to, str)
+	s.spare.to = s.To
+	s.hdrErr(SIP_HDR_TO, s.To.Error)
 }
 
 func (s *SipMsg) parseUnsupported(str string) {
-	s.Unsupported = getCommaSeperated(str)
-	if s.Unsupported == nil {
-		s.Unsupported = []string{str}
-	}
+	s.Unsupported = appendList(s.Unsupported, str)
 }
 
+// parseVia parses each of the comma separated via-parms in str into
+// its own *Via.  A via-parm that does not parse is still kept (with
+// .Error set) so that it is rendered back as it was received.
 func (s *SipMsg) parseVia(str string) {
-	v := &Via{Via: str}
-	v.parse()
-	if v.Error != nil {
-		s.Error = v.Error
+	vias := splitList(str, ',')
+	if len(vias) == 0 {
+		s.hdrErr(SIP_HDR_VIA, fmt.Errorf("%w: parseVia err: no via-parm in: %s", ErrBadVia, str))
 		return
 	}
-	if s.Via == nil {
-		s.Via = []*Via{v}
-		return
+	for _, val := range vias {
+		v := s.newVia(val)
+		v.parse()
+		s.hdrErr(SIP_HDR_VIA, v.Error)
+		s.Via = append(s.Via, v)
+		s.spare.via = s.Via
 	}
-	s.Via = append(s.Via, v)
 }
 
 func (s *SipMsg) parseWarning(str string) {
 	s.Warning = &Warning{Val: str}
-	s.Error = s.Warning.parse()
+	s.hdrErr(SIP_HDR_WARNING, s.Warning.parse())
 }
 
 func (s *SipMsg) parseWWWAuthenticate(str string) {
-	s.WWWAuthenticate = &Authorization{Val: str}
-	s.Error = s.WWWAuthenticate.parse()
+	l := s.parseAuths(SIP_HDR_WWW_AUTHENTICATE, str)
+	s.WWWAuthenticates = append(s.WWWAuthenticates, l...)
+	s.WWWAuthenticate = s.WWWAuthenticates[len(s.WWWAuthenticates)-1]
 }
 
 func getBody(s *SipMsg) sipParserStateFn {
@@ -495,49 +617,110 @@ func getBody(s *SipMsg) sipParserStateFn {
 func getHeaders(s *SipMsg) sipParserStateFn {
 	s.State = sipParseStateHeaders
 	var lasth string
-	hdrs := strings.Split(s.Msg[0:s.eof], "\r\n")
-	for i := range hdrs {
+	hdrs := s.Msg[0:s.eof]
+	// size the hdr lists up front so that they are allocated once
+	n := strings.Count(hdrs, "\r\n")
+	if cap(s.rawHdrs) < n {
+		s.RawHeaders = make([]*RawHeader, 0, n)
+		s.rawHdrs = make([]RawHeader, 0, n)
+		s.hdrOrder = make([]hdrRef, 0, n)
+	}
+	pos := 0
+	for i := 0; pos <= len(hdrs); i++ {
+		end := strings.Index(hdrs[pos:], "\r\n")
+		switch {
+		case end == -1:
+			end = len(hdrs)
+		default:
+			end = pos + end
+		}
+		line := hdrs[pos:end]
 		switch {
 		case i == 0:
-			s.parseStartLine(hdrs[0])
-			if s.Error != nil {
+			s.parseStartLine(line)
+			if s.StartLine.Error != nil {
 				return nil
 			}
-		case i == 1:
-			lasth = hdrs[i]
-		case i > 1:
-			if len(hdrs[i]) > 4 {
-				switch {
-				case hdrs[i][0] == '\t':
-					lasth = lasth + hdrs[i][1:]
-				case hdrs[i][0:4] == "    ":
-					lasth = lasth + hdrs[i][4:]
-				default:
-					s.addHdr(lasth)
-					if s.Error != nil {
-						return nil
-					}
-					lasth = hdrs[i]
+			if s.strict {
+				if rule := checkStartLine(s.StartLine, line); rule != "" {
+					s.grammarErr(PARSE_ERR_START_LINE, "", rule, line)
 				}
 			}
-			if len(hdrs[i]) < 4 {
-				s.addHdr(lasth)
-				lasth = hdrs[i]
-			}
+		case len(line) > 0 && (line[0] == ' ' || line[0] == '\t'):
+			// folded line so it is joined to the last hdr
+			lasth = lasth + " " + strings.TrimLeft(line, " \t")
+			s.hdrEnd = end
+		default:
+			s.addHdr(lasth)
+			lasth = line
+			s.hdrLine = i + 1
+			s.hdrStart = pos
+			s.hdrEnd = end
 		}
+		pos = end + 2
 	}
 	s.addHdr(lasth)
+	if !s.lazy {
+		// every Contact hdr has to be seen (and the Expires hdr for a
+		// wildcard) so .Contacts is filled once all of them are in
+		s.parseContacts()
+	}
 	return nil
 }
 
+// ParseBytes parses a msg without copying b.  Every string field of
+// the returned *SipMsg (i.e. .Msg, .Body, .CallId, hdr values)
+// points into b so b must not be modified or reused for as long as
+// the *SipMsg (or any string taken from it) is in use.  If the
+// buffer is going to be reused call ParseMsg(string(b)) instead.
+func ParseBytes(b []byte) *SipMsg {
+	return ParseMsg(unsafe.String(unsafe.SliceData(b), len(b)))
+}
+
+// ParseOptions changes how a msg is parsed:
+// -- Lazy only indexes the hdrs that need real parsing (i.e. Via,
+// From, To, CSeq, Route) and parses them the first time they are
+// asked for with one of the Get methods (i.e. GetVia, GetFrom).  See
+// lazy.go for the list of hdrs.
+// -- Strict checks the start line and hdrs against the RFC 3261
+// grammar (docs/rfc3261.grammar.txt) and adds a ParseError (with
+// the .Rule that failed) for anything that does not match.  Without
+// it the parser is tolerant so that captured traffic can still be
+// looked at.  See strict.go for what is checked.
+type ParseOptions struct {
+	Lazy   bool
+	Strict bool
+}
+
 func ParseMsg(str string) (s *SipMsg) {
-	s = &SipMsg{Msg: str, eof: strings.Index(str, "\r\n\r\n")}
+	s = &SipMsg{}
+	s.parse(str)
+	return s
+}
+
+// ParseMsgWithOptions is ParseMsg with the ParseOptions applied
+func ParseMsgWithOptions(str string, o ParseOptions) *SipMsg {
+	s := &SipMsg{}
+	s.setOptions(o)
+	s.parse(str)
+	return s
+}
+
+// setOptions applies the options to s before it is parsed
+func (s *SipMsg) setOptions(o ParseOptions) {
+	s.lazy = o.Lazy
+	s.strict = o.Strict
+}
+
+// parse parses str into s which must be new or have been Reset
+func (s *SipMsg) parse(str string) {
+	s.Msg = str
+	s.eof = strings.Index(str, "\r\n\r\n")
 	if s.eof == -1 {
-		s.Error = errors.New("ParseMsg: err parsing msg.  No SIP eof found.")
-		return s
+		s.addParseError(&ParseError{Kind: PARSE_ERR_MSG, Err: fmt.Errorf("%w: ParseMsg: err parsing msg.  No SIP eof found.", ErrNoHeaderTerminator)})
+		return
 	}
 	s.run()
-	return s
 }
 
 func parseSip(s *SipMsg) sipParserStateFn {
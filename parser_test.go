@@ -4,8 +4,15 @@ package sipparser
 import (
 	//"fmt"
 	"testing"
+	"unsafe"
 )
 
+// testOkMsg and testInviteMsg are the sample msgs used by the tests
+// and benchmarks
+var testOkMsg = "SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK24477ab511325213INV52e94be64e6687e3;received=0.0.0.0\r\nContact: <sip:10003053258853@0.0.0.0:6060>\r\nTo: <sip:10003053258853@0.0.0.0;user=phone;noa=national>;tag=a94c095b773be1dd6e8d668a785a9c843f6f2cc0\r\nFrom: <sip:8173383772@0.0.0.0;user=phone;noa=national>;tag=52e94be6-co2998-INS002\r\nCall-ID: 111118149-3524331107-398662@barinfo.fooinfous.com\r\nCSeq: 299801 INVITE\r\nAccept: application/sdp, application/dtmf-relay, text/plain\r\nX-Nonsense-Hdr: nonsense\r\nAllow: PRACK, INVITE, BYE, REGISTER, ACK, OPTIONS, CANCEL, SUBSCRIBE, NOTIFY, INFO, REFER, UPDATE\r\nContent-Type: application/sdp\r\nServer: Dialogic-SIP/10.5.3.231 IMGDAL0001 0\r\nSupported: 100rel, path, replaces, timer, tdialog\r\nContent-Length: 239\r\n\r\nv=0\r\no=Dialogic_SDP 1452654 0 IN IP4 0.0.0.0\r\ns=Dialogic-SIP\r\nc=IN IP4 4.71.122.135\r\nt=0 0\r\nm=audio 11676 RTP/AVP 0 101\r\na=rtpmap:0 PCMU/8000\r\na=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-15\r\na=silenceSupp:off - - - -\r\na=ptime:20\r\n"
+
+var testInviteMsg = "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds;rport\r\nMax-Forwards: 70\r\nTo: Bob <sip:bob@biloxi.com>\r\nFrom: Alice <sip:alice@atlanta.com>;tag=1928301774\r\nCall-ID: a84b4c76e66710@pc33.atlanta.com\r\nCSeq: 314159 INVITE\r\nContact: <sip:alice@pc33.atlanta.com>\r\nRecord-Route: <sip:p1.atlanta.com;lr>\r\nAllow: INVITE, ACK, CANCEL, OPTIONS, BYE\r\nSupported: 100rel, timer\r\nUser-Agent: SoftPhone/1.0\r\nContent-Type: application/sdp\r\nContent-Length: 142\r\n\r\nv=0\r\no=alice 2890844526 2890844526 IN IP4 pc33.atlanta.com\r\ns=-\r\nc=IN IP4 pc33.atlanta.com\r\nt=0 0\r\nm=audio 49172 RTP/AVP 0\r\na=rtpmap:0 PCMU/8000\r\n"
+
 func TestHeader(t *testing.T) {
 	h := Header{"t", "v"}
 	if h.String() != "t: v" {
@@ -23,7 +30,7 @@ func TestBody(t *testing.T) {
 
 // actual msg testing 
 func TestParseMsg(t *testing.T) {
-	m := "SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK24477ab511325213INV52e94be64e6687e3;received=0.0.0.0\r\nContact: <sip:10003053258853@0.0.0.0:6060>\r\nTo: <sip:10003053258853@0.0.0.0;user=phone;noa=national>;tag=a94c095b773be1dd6e8d668a785a9c843f6f2cc0\r\nFrom: <sip:8173383772@0.0.0.0;user=phone;noa=national>;tag=52e94be6-co2998-INS002\r\nCall-ID: 111118149-3524331107-398662@barinfo.fooinfous.com\r\nCSeq: 299801 INVITE\r\nAccept: application/sdp, application/dtmf-relay, text/plain\r\nX-Nonsense-Hdr: nonsense\r\nAllow: PRACK, INVITE, BYE, REGISTER, ACK, OPTIONS, CANCEL, SUBSCRIBE, NOTIFY, INFO, REFER, UPDATE\r\nContent-Type: application/sdp\r\nServer: Dialogic-SIP/10.5.3.231 IMGDAL0001 0\r\nSupported: 100rel, path, replaces, timer, tdialog\r\nContent-Length: 239\r\n\r\nv=0\r\no=Dialogic_SDP 1452654 0 IN IP4 0.0.0.0\r\ns=Dialogic-SIP\r\nc=IN IP4 4.71.122.135\r\nt=0 0\r\nm=audio 11676 RTP/AVP 0 101\r\na=rtpmap:0 PCMU/8000\r\na=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-15\r\na=silenceSupp:off - - - -\r\na=ptime:20\r\n"
+	m := testOkMsg
 	s := ParseMsg(m)
 	if s.Error != nil {
 		t.Errorf("[TestParseMsg] Error parsing msg. Recevied: " + s.Error.Error())
@@ -97,3 +104,92 @@ func TestGetCallingParty(t *testing.T) {
 		t.Errorf("[TestGetCallingParty] Err calling GetCallingParty on default. Number should be \"5556661000\".")
 	}
 }
+
+// testing the lossless RawHeaders list and the GetHeader(s) lookups
+func TestRawHeaders(t *testing.T) {
+	m := "INVITE sip:bob@biloxi.com SIP/2.0\r\nv: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\nVIA: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bKnashds8\r\nX-Custom: one,\r\n\ttwo\r\nm: <sip:alice@pc33.atlanta.com>\r\nX-Custom: three\r\nContent-Length: 0\r\n\r\n"
+	s := ParseMsg(m)
+	if s.Error != nil {
+		t.Fatalf("[TestRawHeaders] Error parsing msg.  Received: %s", s.Error.Error())
+	}
+	if len(s.RawHeaders) != 6 {
+		t.Fatalf("[TestRawHeaders] Should have 6 raw hdrs but received: %d", len(s.RawHeaders))
+	}
+	names := []string{"v", "VIA", "X-Custom", "m", "X-Custom", "Content-Length"}
+	for i := range names {
+		if s.RawHeaders[i].Name != names[i] {
+			t.Errorf("[TestRawHeaders] RawHeaders[%d].Name should be %q but received: %q", i, names[i], s.RawHeaders[i].Name)
+		}
+	}
+	if s.RawHeaders[0].Canonical != SIP_HDR_VIA || s.RawHeaders[3].Canonical != SIP_HDR_CONTACT {
+		t.Errorf("[TestRawHeaders] Compact hdr names should have the long form as the canonical name.")
+	}
+	if s.RawHeaders[0].Line != 2 || s.RawHeaders[3].Line != 6 {
+		t.Errorf("[TestRawHeaders] Line numbers are wrong.  Received: %d and %d", s.RawHeaders[0].Line, s.RawHeaders[3].Line)
+	}
+	if s.RawHeaders[2].Val != "one, two" {
+		t.Errorf("[TestRawHeaders] Folded hdr value should be \"one, two\" but received: %q", s.RawHeaders[2].Val)
+	}
+	if s.Msg[s.RawHeaders[2].Start:s.RawHeaders[2].End] != "X-Custom: one,\r\n\ttwo" {
+		t.Errorf("[TestRawHeaders] Offsets of the folded hdr are wrong.  Received: %q", s.Msg[s.RawHeaders[2].Start:s.RawHeaders[2].End])
+	}
+	if s.Msg[s.RawHeaders[0].Start:s.RawHeaders[0].End] != "v: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds" {
+		t.Errorf("[TestRawHeaders] Offsets of the first hdr are wrong.")
+	}
+	if len(s.GetHeaders("via")) != 2 || len(s.GetHeaders("V")) != 2 {
+		t.Errorf("[TestRawHeaders] GetHeaders should find both vias by long or compact name.")
+	}
+	if h := s.GetHeader("contact"); h == nil || h.Val != "<sip:alice@pc33.atlanta.com>" {
+		t.Errorf("[TestRawHeaders] GetHeader(\"contact\") should find the \"m\" hdr.")
+	}
+	if hdrs := s.GetHeaders("x-custom"); len(hdrs) != 2 || hdrs[1].Val != "three" {
+		t.Errorf("[TestRawHeaders] GetHeaders(\"x-custom\") should return both instances in order.")
+	}
+	if s.GetHeader("subject") != nil {
+		t.Errorf("[TestRawHeaders] GetHeader should return nil for a missing hdr.")
+	}
+	if len(s.Via) != 2 {
+		t.Errorf("[TestRawHeaders] Both vias should still be parsed into s.Via.")
+	}
+}
+
+// ParseBytes should give the same result as ParseMsg with the
+// string fields pointing into the passed in buffer
+func TestParseBytes(t *testing.T) {
+	b := []byte(testInviteMsg)
+	s := ParseBytes(b)
+	if s.Error != nil {
+		t.Fatalf("[TestParseBytes] Error parsing msg.  Received: %s", s.Error.Error())
+	}
+	if s.String() != ParseMsg(testInviteMsg).String() {
+		t.Errorf("[TestParseBytes] ParseBytes and ParseMsg should parse the same msg.")
+	}
+	start := uintptr(unsafe.Pointer(&b[0]))
+	for _, str := range []string{s.Msg, s.CallId, s.Body, s.Via[0].Branch, s.From.Tag} {
+		p := uintptr(unsafe.Pointer(unsafe.StringData(str)))
+		if p < start || p >= start+uintptr(len(b)) {
+			t.Errorf("[TestParseBytes] %q should point into the passed in buffer.", str)
+		}
+	}
+}
+
+func benchmarkParseMsg(b *testing.B, m []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(m)))
+	for i := 0; i < b.N; i++ {
+		ParseMsg(string(m))
+	}
+}
+
+func benchmarkParseBytes(b *testing.B, m []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(m)))
+	for i := 0; i < b.N; i++ {
+		ParseBytes(m)
+	}
+}
+
+func BenchmarkParseMsgInvite(b *testing.B)  { benchmarkParseMsg(b, []byte(testInviteMsg)) }
+func BenchmarkParseBytesInvite(b *testing.B) { benchmarkParseBytes(b, []byte(testInviteMsg)) }
+func BenchmarkParseMsgOk(b *testing.B)      { benchmarkParseMsg(b, []byte(testOkMsg)) }
+func BenchmarkParseBytesOk(b *testing.B)     { benchmarkParseBytes(b, []byte(testOkMsg)) }
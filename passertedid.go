@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 )
 
 // pAssertedIdStateFn is just a fn type 
@@ -53,56 +53,36 @@ func parsePAssertedId(p *PAssertedId) pAssertedIdStateFn {
 }
 
 func parsePAssertedIdGetUri(p *PAssertedId) pAssertedIdStateFn {
-	left := 0
-	right := 0
-	for i := range p.Val {
-		if p.Val[i] == '<' && left == 0 {
-			left = i
-		}
-		if p.Val[i] == '>' && right == 0 {
-			right = i
-		}
-	}
-	if left < right {
+	left, right, ok := getBracks(p.Val)
+	if ok {
 		p.URI = ParseURI(p.Val[left+1 : right])
 		if p.URI.Error != nil {
-			p.Error = errors.New("parseRpidGetUri err: received err getting uri: " + p.URI.Error.Error())
+			p.Error = fmt.Errorf("parseRpidGetUri err: received err getting uri: %w", p.URI.Error)
 			return nil
 		}
 		return parsePAssertedIdGetParams
 	}
-	p.Error = errors.New("parseRpidGetUri err: could not locate bracks.  no uri found.")
+	p.Error = fmt.Errorf("%w: parseRpidGetUri err: could not locate bracks.  no uri found.", ErrBadURI)
 	return nil
 }
 
 func parsePAssertedIdGetParams(p *PAssertedId) pAssertedIdStateFn {
-	var pos []int
-	right := 0
-	for i := range p.Val {
-		if p.Val[i] == '>' && right == 0 {
-			right = i
-		}
-	}
-	if len(p.Val) > right+1 {
-		pos = make([]int, 0)
-		for i := range p.Val[right+1:] {
-			if p.Val[right+1:][i] == ';' {
-				pos = append(pos, i)
-			}
-		}
-	}
-	if pos == nil {
+	_, right, ok := getBracks(p.Val)
+	if !ok {
 		return nil
 	}
-	for i := range pos {
-		if len(pos)-1 == i {
-			if len(p.Val[right+1:])-1 > pos[i]+1 {
-				p.addParam(p.Val[right+1:][pos[i]+1:])
-			}
-		}
-		if len(pos)-1 > i {
-			p.addParam(p.Val[right+1:][pos[i]+1 : pos[i+1]])
-		}
+	params := splitList(p.Val[right+1:], ';')
+	for i := range params {
+		p.addParam(params[i])
 	}
 	return nil
 }
+
+// String returns the p-asserted-id rendered from its parsed fields
+func (p *PAssertedId) String() string {
+	str := nameAddr(p.Name, p.URI)
+	for i := range p.Params {
+		str += ";" + p.Params[i].String()
+	}
+	return str
+}
@@ -0,0 +1,174 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"sync"
+	"unsafe"
+)
+
+// msgPool holds the *SipMsg's that have been released by a Parser
+var msgPool = sync.Pool{
+	New: func() interface{} {
+		return new(SipMsg)
+	},
+}
+
+// Parser parses msgs into *SipMsg's that are reused once they are
+// passed back to Release.  This takes most of the allocations out of
+// parsing a msg when the msgs are handled one at a time (i.e. parse,
+// route, release).  The released msgs go into a sync.Pool that is
+// shared by every Parser but a Parser itself is meant to be used by
+// one goroutine so use one Parser per goroutine.
+type Parser struct {
+	Options ParseOptions
+}
+
+// NewParser returns a new *Parser
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// NewParserWithOptions returns a new *Parser that parses every msg
+// with the ParseOptions
+func NewParserWithOptions(o ParseOptions) *Parser {
+	return &Parser{Options: o}
+}
+
+// ParseMsg is the same as the package level ParseMsg (with the
+// .Options of the Parser) but the *SipMsg comes from the pool
+func (p *Parser) ParseMsg(str string) *SipMsg {
+	s := msgPool.Get().(*SipMsg)
+	s.setOptions(p.Options)
+	s.parse(str)
+	return s
+}
+
+// ParseBytes is the same as the package level ParseBytes but the
+// *SipMsg comes from the pool
+func (p *Parser) ParseBytes(b []byte) *SipMsg {
+	return p.ParseMsg(unsafe.String(unsafe.SliceData(b), len(b)))
+}
+
+// Release resets s and puts it back in the pool.  After Release
+// the only things from s that stay valid are strings that were
+// copied out of it (i.e. id := s.CallId) since strings are never
+// modified ... and even those are only valid as long as the []byte
+// passed to ParseBytes is.  Every struct and slice that the parser
+// allocated for s (StartLine, Via, From, To, Cseq, Route,
+// RecordRoute, Headers, RawHeaders and anything they point to) is
+// reused by the next msg that gets parsed so none of them can be held
+// onto.  Structs and slices that were put into s by hand are not
+// reused (see msgSpares).  The caller owns
+// that rule: Release does not know what is still referenced so a
+// *URI or *Via that has to outlive the msg must be copied first (with
+// URI.Clone or Via.Clone).  The values that RouteSet, NewResponse,
+// NewCancel, NewAckForNon2xx and the Dialog constructors return are
+// already copies so they stay valid.
+func (p *Parser) Release(s *SipMsg) {
+	if s == nil {
+		return
+	}
+	s.Reset()
+	msgPool.Put(s)
+}
+
+// msgSpares are the structs and slices that the parser allocated
+// for a msg.  Reset keeps them for the next msg and they are the only
+// things that get reused: a struct or slice that was put into the msg
+// by hand (i.e. a Via added by a proxy) is never written to by the
+// next parse.
+// -- startLine, from, to and cseq are the structs of those fields
+// -- vias, uris and hdrs are every *Via, Route or Record-Route *URI
+// and *Header the parser allocated and nVia, nURI and nHdr are how
+// many of them the current msg uses
+// -- via, route, recordRoute, headers and rawHeaders are the slices
+// the parser appended to
+type msgSpares struct {
+	startLine   *StartLine
+	from        *From
+	to          *From
+	cseq        *Cseq
+	vias        []*Via
+	uris        []*URI
+	hdrs        []*Header
+	nVia        int
+	nURI        int
+	nHdr        int
+	via         []*Via
+	route       []*URI
+	recordRoute []*URI
+	headers     []*Header
+	rawHeaders  []*RawHeader
+}
+
+// Reset clears s so it can be used to parse another msg.  The structs
+// and slices that the parser allocated for the StartLine, Via, From,
+// To, Cseq, Route, RecordRoute, Headers and RawHeaders fields are
+// kept so that the next parse can reuse their memory (see msgSpares).
+func (s *SipMsg) Reset() {
+	sp := s.spare
+	sp.nVia, sp.nURI, sp.nHdr = 0, 0, 0
+	rawHdrs := s.rawHdrs[0:0]
+	hdrOrder := s.hdrOrder[0:0]
+	*s = SipMsg{
+		Via:         sp.via[0:0],
+		Route:       sp.route[0:0],
+		RecordRoute: sp.recordRoute[0:0],
+		Headers:     sp.headers[0:0],
+		RawHeaders:  sp.rawHeaders[0:0],
+		rawHdrs:     rawHdrs,
+		hdrOrder:    hdrOrder,
+		spare:       sp,
+	}
+}
+
+// newVia returns a *Via for val that is either one the parser
+// allocated for an earlier msg or a new one
+func (s *SipMsg) newVia(val string) *Via {
+	sp := &s.spare
+	if sp.nVia < len(sp.vias) {
+		v := sp.vias[sp.nVia]
+		v.reset(val)
+		sp.nVia++
+		return v
+	}
+	v := &Via{Via: val}
+	sp.vias = append(sp.vias, v)
+	sp.nVia++
+	return v
+}
+
+// newURI parses str into a *URI that is either one the parser
+// allocated for an earlier msg or a new one
+func (s *SipMsg) newURI(str string) *URI {
+	sp := &s.spare
+	if sp.nURI < len(sp.uris) {
+		u := reuseURI(sp.uris[sp.nURI], str)
+		sp.nURI++
+		return u
+	}
+	u := ParseURI(str)
+	sp.uris = append(sp.uris, u)
+	sp.nURI++
+	return u
+}
+
+// newHeader returns a *Header for the hdr and val that is either one
+// the parser allocated for an earlier msg or a new one
+func (s *SipMsg) newHeader(hdr string, val string) *Header {
+	sp := &s.spare
+	if sp.nHdr < len(sp.hdrs) {
+		h := sp.hdrs[sp.nHdr]
+		h.Header, h.Val = hdr, val
+		sp.nHdr++
+		return h
+	}
+	h := &Header{hdr, val}
+	sp.hdrs = append(sp.hdrs, h)
+	sp.nHdr++
+	return h
+}
@@ -0,0 +1,101 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestSipMsgReset(t *testing.T) {
+	s := ParseMsg(testInviteMsg)
+	via := s.Via[0]
+	from := s.From
+	uri := s.StartLine.URI
+	s.Reset()
+	s.parse(testOkMsg)
+	if s.Error != nil {
+		t.Fatalf("[TestSipMsgReset] Error parsing msg after Reset.  Received: %s", s.Error.Error())
+	}
+	if s.String() != ParseMsg(testOkMsg).String() {
+		t.Errorf("[TestSipMsgReset] A reused msg should parse the same as a new one.  Received: %q", s.String())
+	}
+	if s.Via[0] != via || s.From != from {
+		t.Errorf("[TestSipMsgReset] The Via and From structs should be reused.")
+	}
+	if s.From.Name != "" || s.StartLine.URI != nil || s.CallingParty != nil {
+		t.Errorf("[TestSipMsgReset] Nothing from the last msg should be left over.")
+	}
+	s.Reset()
+	s.parse(testInviteMsg)
+	if s.StartLine.URI != uri {
+		t.Errorf("[TestSipMsgReset] The request uri should be reused.")
+	}
+	if s.String() != ParseMsg(testInviteMsg).String() {
+		t.Errorf("[TestSipMsgReset] A reused msg should parse the same as a new one.  Received: %q", s.String())
+	}
+	kept, keptVia := s.StartLine.URI.Clone(), s.Via[0].Clone()
+	want, wantVia := kept.String(), keptVia.String()
+	s.Reset()
+	s.parse(testOkMsg)
+	if kept == s.StartLine.URI || kept.String() != want || keptVia == s.Via[0] || keptVia.String() != wantVia {
+		t.Errorf("[TestSipMsgReset] A cloned uri or via should not be reused.")
+	}
+	// what a proxy puts into the msg is never written to by the next
+	// parse
+	s.Reset()
+	s.parse(testInviteMsg)
+	mine, ruri, route := NewVia("UDP", "p1.example.com"), ParseURI("sip:bob@192.0.2.4"), ParseURI("sip:p2.example.com;lr")
+	s.Via = append([]*Via{mine}, s.Via...)
+	s.Via = append(s.Via, mine)
+	s.StartLine.URI = ruri
+	s.From.URI = ruri
+	s.Route = []*URI{route}
+	s.Headers = append(s.Headers, &Header{"x-mine", "1"})
+	s.Reset()
+	s.parse(testOkMsg)
+	s.Reset()
+	s.parse(testInviteMsg)
+	if mine.SentBy != "p1.example.com" || ruri.String() != "sip:bob@192.0.2.4" || route.String() != "sip:p2.example.com;lr" {
+		t.Errorf("[TestSipMsgReset] Structs put into the msg by hand should not be reused.  Received: %q, %q and %q", mine.String(), ruri.String(), route.String())
+	}
+	if s.String() != ParseMsg(testInviteMsg).String() {
+		t.Errorf("[TestSipMsgReset] A reused msg should parse the same as a new one.  Received: %q", s.String())
+	}
+}
+
+func TestParser(t *testing.T) {
+	p := NewParser()
+	for i := 0; i < 3; i++ {
+		s := p.ParseBytes([]byte(testInviteMsg))
+		if s.Error != nil {
+			t.Fatalf("[TestParser] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		if s.CallId != "a84b4c76e66710@pc33.atlanta.com" || len(s.Via) != 1 || len(s.RawHeaders) != 13 {
+			t.Errorf("[TestParser] Msg %d was not parsed correctly.", i)
+		}
+		p.Release(s)
+	}
+}
+
+func BenchmarkParserInvite(b *testing.B) {
+	p := NewParser()
+	m := []byte(testInviteMsg)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(m)))
+	for i := 0; i < b.N; i++ {
+		p.Release(p.ParseBytes(m))
+	}
+}
+
+func BenchmarkParserOk(b *testing.B) {
+	p := NewParser()
+	m := []byte(testOkMsg)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(m)))
+	for i := 0; i < b.N; i++ {
+		p.Release(p.ParseBytes(m))
+	}
+}
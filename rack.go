@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 )
 
 // Rack is a struct that holds the parsed rack hdr
@@ -32,7 +32,7 @@ func (r *Rack) parse() error {
 		}
 	}
 	if len(pos) != 2 {
-		return errors.New("Rack.parse err: could not locate two LWS.")
+		return fmt.Errorf("%w: Rack.parse err: could not locate two LWS.", ErrBadRAck)
 	}
 	r.RseqVal = r.Val[0:pos[0]]
 	r.CseqVal = r.Val[pos[0]+1 : pos[1]]
@@ -40,5 +40,10 @@ func (r *Rack) parse() error {
 		r.CseqMethod = r.Val[pos[1]+1:]
 		return nil
 	}
-	return errors.New("Rack.parse err: value of RAck ends in LWS.")
+	return fmt.Errorf("%w: Rack.parse err: value of RAck ends in LWS.", ErrBadRAck)
+}
+
+// String returns the rack as "rseq cseq method"
+func (r *Rack) String() string {
+	return r.RseqVal + " " + r.CseqVal + " " + r.CseqMethod
 }
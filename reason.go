@@ -4,11 +4,6 @@
 
 package sipparser
 
-// Imports from the go standard library
-import (
-	"strings"
-)
-
 // Reason is a struct that holds a parsed reason hdr
 // Fields are as follows:
 // -- Val is the raw value
@@ -30,40 +25,30 @@ func (r *Reason) addParam(s string) {
 		r.Cause = np.Val
 	}
 	if np.Param == "text" {
-		r.Text = np.Val
+		r.Text = unquoteStr(np.Val)
 	}
 }
 
 // parse is the method that actual parses the .Val of the Reason type
 func (r *Reason) parse() {
-	pos := make([]int, 0)
-	for i := range r.Val {
-		if r.Val[i] == ';' {
-			pos = append(pos, i)
-		}
-	}
-	if len(pos) == 0 {
+	parts := splitList(r.Val, ';')
+	if len(parts) < 2 {
 		return
 	}
-	if len(pos) == 1 {
-		r.Proto = strings.TrimSpace(r.Val[0:pos[0]])
-		if len(r.Val)-1 > pos[0] {
-			r.addParam(strings.Replace(r.Val[pos[0]+1:], "\"", "", -1))
-		}
-		return
+	r.Proto = parts[0]
+	for i := 1; i < len(parts); i++ {
+		r.addParam(parts[i])
 	}
-	if len(pos) > 1 {
-		r.Proto = strings.TrimSpace(r.Val[0:pos[0]])
-		for i := range pos {
-			if len(pos)-1 == i {
-				if len(r.Val)-1 > pos[i] {
-					r.addParam(strings.Replace(r.Val[pos[i]+1:], "\"", "", -1))
-				}
-				return
-			}
-			r.addParam(strings.Replace(r.Val[pos[i]+1:pos[i+1]], "\"", "", -1))
-		}
-		return
+}
+
+// String returns the reason rendered from its parsed fields
+func (r *Reason) String() string {
+	str := r.Proto
+	if r.Cause != "" {
+		str += ";cause=" + r.Cause
+	}
+	if r.Text != "" {
+		str += ";text=" + quoteStr(r.Text)
 	}
-	return
+	return str
 }
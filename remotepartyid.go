@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 )
 
 type parseRpidStateFn func(r *RemotePartyId) parseRpidStateFn
@@ -30,7 +30,7 @@ func (r *RemotePartyId) addParam(s string) {
 	case p.Param == "party":
 		r.Party = p.Val
 	case p.Param == "privacy":
-		r.Party = p.Val
+		r.Privacy = p.Val
 	default:
 		switch {
 		case r.Params == nil:
@@ -56,56 +56,45 @@ func parseRpid(r *RemotePartyId) parseRpidStateFn {
 }
 
 func parseRpidGetUri(r *RemotePartyId) parseRpidStateFn {
-	left := 0
-	right := 0
-	for i := range r.Val {
-		if r.Val[i] == '<' && left == 0 {
-			left = i
-		}
-		if r.Val[i] == '>' && right == 0 {
-			right = i
-		}
-	}
-	if left < right {
+	left, right, ok := getBracks(r.Val)
+	if ok {
 		r.URI = ParseURI(r.Val[left+1 : right])
 		if r.URI.Error != nil {
-			r.Error = errors.New("parseRpidGetUri err: received err getting uri: " + r.URI.Error.Error())
+			r.Error = fmt.Errorf("parseRpidGetUri err: received err getting uri: %w", r.URI.Error)
 			return nil
 		}
 		return parseRpidGetParams
 	}
-	r.Error = errors.New("parseRpidGetUri err: could not locate bracks.  no uri found.")
+	r.Error = fmt.Errorf("%w: parseRpidGetUri err: could not locate bracks.  no uri found.", ErrBadURI)
 	return nil
 }
 
 func parseRpidGetParams(r *RemotePartyId) parseRpidStateFn {
-	var pos []int
-	right := 0
-	for i := range r.Val {
-		if r.Val[i] == '>' && right == 0 {
-			right = i
-		}
-	}
-	if len(r.Val) > right+1 {
-		pos = make([]int, 0)
-		for i := range r.Val[right+1:] {
-			if r.Val[right+1:][i] == ';' {
-				pos = append(pos, i)
-			}
-		}
-	}
-	if pos == nil {
+	_, right, ok := getBracks(r.Val)
+	if !ok {
 		return nil
 	}
-	for i := range pos {
-		if len(pos)-1 == i {
-			if len(r.Val[right+1:])-1 > pos[i]+1 {
-				r.addParam(r.Val[right+1:][pos[i]+1:])
-			}
-		}
-		if len(pos)-1 > i {
-			r.addParam(r.Val[right+1:][pos[i]+1 : pos[i+1]])
-		}
+	params := splitList(r.Val[right+1:], ';')
+	for i := range params {
+		r.addParam(params[i])
 	}
 	return nil
 }
+
+// String returns the remote-party-id rendered from its parsed fields
+func (r *RemotePartyId) String() string {
+	str := nameAddr(r.Name, r.URI)
+	if r.Party != "" {
+		str += ";party=" + r.Party
+	}
+	if r.Screen != "" {
+		str += ";screen=" + r.Screen
+	}
+	if r.Privacy != "" {
+		str += ";privacy=" + r.Privacy
+	}
+	for i := range r.Params {
+		str += ";" + r.Params[i].String()
+	}
+	return str
+}
@@ -23,3 +23,14 @@ func TestRpid(t *testing.T) {
 		t.Errorf("[TestRpid Error parsing rpid hdr: \"Unknown\" <sip:5558887777@0.0.0.0>;party=calling;screen=yes;privacy=off.  sm.RemotePartyId.URI is nil.")
 	}
 }
+
+func TestRpidString(t *testing.T) {
+	r := &RemotePartyId{Val: "\"Unknown\" <sip:5558887777@0.0.0.0>;party=calling;screen=yes;privacy=off"}
+	r.parse()
+	if r.Privacy != "off" {
+		t.Errorf("[TestRpidString] Privacy should be \"off\" but received: %q", r.Privacy)
+	}
+	if r.String() != r.Val {
+		t.Errorf("[TestRpidString] Error rendering rpid hdr.  Received: %q", r.String())
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// cloneURIs returns a deep copy of each of the uris
+func cloneURIs(l []*URI) []*URI {
+	if len(l) == 0 {
+		return nil
+	}
+	n := make([]*URI, len(l))
+	for i := range l {
+		n[i] = l[i].clone()
+	}
+	return n
+}
+
+// RouteSet returns the route set of a dialog from the Record-Route
+// hdrs of the msg (RFC 3261 12.1).  The UAC builds it from the
+// response in reverse order (uac is true) and the UAS from the
+// request in the order received.  The uris are copies so they can be
+// kept for the life of the dialog.
+func (s *SipMsg) RouteSet(uac bool) []*URI {
+	rs := cloneURIs(s.GetRecordRoute())
+	if uac {
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+	}
+	return rs
+}
+
+// IsStrictRouter returns true if the uri is for a strict router (an
+// RFC 2543 one that does not put the lr param in its uri)
+func IsStrictRouter(u *URI) bool {
+	return u != nil && !u.Lr()
+}
+
+// requestURI returns a copy of u without the params and headers that
+// are not allowed in a Request-URI (RFC 3261 19.1.1)
+func requestURI(u *URI) *URI {
+	if u == nil {
+		return nil
+	}
+	n := u.clone()
+	n.Headers = nil
+	if n.Param("method") != nil {
+		p := n.UriParams[0:0]
+		for i := range n.UriParams {
+			if n.UriParams[i].Param != "method" {
+				p = append(p, n.UriParams[i])
+			}
+		}
+		n.UriParams = p
+	}
+	return n
+}
+
+// setRequestURI sets the uri of the Request-Line
+func (s *SipMsg) setRequestURI(u *URI) {
+	if s.StartLine == nil {
+		s.StartLine = &StartLine{Type: SIP_REQUEST, Proto: SIP_PROTO, Version: SIP_VERSION}
+	}
+	s.StartLine.URI = u
+	s.StartLine.Val = s.StartLine.String()
+}
+
+// ApplyRouteSet sets the Request-URI and Route hdrs of a request
+// within a dialog from the route set and the remote target (the
+// Contact of the peer) as RFC 3261 12.2.1.1 describes:
+// -- with no route set the Request-URI is the remote target and there
+// is no Route hdr
+// -- if the first route has the lr param (a loose router) the
+// Request-URI is the remote target and the Route hdrs are the route
+// set
+// -- otherwise (a strict router) the Request-URI is the first route
+// and the Route hdrs are the rest of the route set followed by the
+// remote target (if it is not nil)
+// The next hop (where the request has to be sent) is returned.
+func (s *SipMsg) ApplyRouteSet(routes []*URI, target *URI) *URI {
+	s.parseLazyHdr(SIP_HDR_ROUTE)
+	s.strictRouted = false
+	switch {
+	case len(routes) == 0:
+		s.setRequestURI(requestURI(target))
+		s.Route = nil
+	case !IsStrictRouter(routes[0]):
+		s.setRequestURI(requestURI(target))
+		s.Route = cloneURIs(routes)
+	default:
+		s.setRequestURI(requestURI(routes[0]))
+		s.Route = cloneURIs(routes[1:])
+		if target != nil {
+			s.Route = append(s.Route, target.clone())
+		}
+		s.strictRouted = true
+	}
+	return s.NextHop()
+}
+
+// StrictRoute rewrites a request that a proxy is about to forward if
+// the first Route hdr is for a strict router (RFC 3261 16.6 step 6):
+// the Request-URI is added as the last Route hdr and the first Route
+// hdr becomes the Request-URI.  It returns true if the request was
+// rewritten.
+func (s *SipMsg) StrictRoute() bool {
+	routes := s.GetRoute()
+	if len(routes) == 0 || !IsStrictRouter(routes[0]) || s.StartLine == nil || s.StartLine.URI == nil {
+		return false
+	}
+	ruri := s.StartLine.URI
+	s.setRequestURI(requestURI(routes[0]))
+	s.Route = append(routes[1:len(routes):len(routes)], ruri)
+	s.strictRouted = true
+	return true
+}
+
+// LooseRoute does the Route processing of RFC 3261 16.4 for a
+// request that a proxy has received.  isLocal returns true for a uri
+// of this proxy (i.e. one it put in a Record-Route hdr).
+// -- if the Request-URI is local the request came from a strict
+// router so the last Route hdr is moved to the Request-URI (without
+// the params and headers that are not allowed there)
+// -- then if the first Route hdr is local it is removed
+// It returns true if the request was rewritten.
+func (s *SipMsg) LooseRoute(isLocal func(u *URI) bool) bool {
+	routes := s.GetRoute()
+	if len(routes) == 0 || s.StartLine == nil || s.StartLine.URI == nil {
+		return false
+	}
+	done := false
+	s.strictRouted = false
+	if isLocal(s.StartLine.URI) {
+		s.setRequestURI(requestURI(routes[len(routes)-1]))
+		routes = routes[0 : len(routes)-1]
+		done = true
+	}
+	if len(routes) != 0 && isLocal(routes[0]) {
+		routes = routes[1:]
+		done = true
+	}
+	s.Route = routes
+	return done
+}
+
+// NextHop returns the uri that a request has to be sent to (RFC 3261
+// 8.1.2 and 16.6 step 7): the first Route hdr if there is one and the
+// Request-URI if not.  A request that ApplyRouteSet or StrictRoute
+// set up for a strict router is sent to the Request-URI (the strict
+// router).  The maddr param of the uri (if any) overrides its host
+// when it is resolved.
+func (s *SipMsg) NextHop() *URI {
+	if routes := s.GetRoute(); len(routes) != 0 && !s.strictRouted {
+		return routes[0]
+	}
+	if s.StartLine == nil {
+		return nil
+	}
+	return s.StartLine.URI
+}
@@ -0,0 +1,110 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouteSet(t *testing.T) {
+	msg := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds\r\n" +
+		"Record-Route: <sip:p3.example.com;lr>, <sip:p2.example.com;lr>\r\n" +
+		"Record-Route: <sip:p1.example.com;lr>\r\n" +
+		"From: <sip:alice@atlanta.com>;tag=1928301774\r\n" +
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf\r\n" +
+		"Call-ID: a84b4c76e66710\r\n" +
+		"CSeq: 314159 INVITE\r\n" +
+		"Contact: <sip:bob@192.0.2.4>\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	s := ParseMsg(msg)
+	if len(s.RecordRoute) != 3 {
+		t.Fatalf("[TestRouteSet] Expected 3 record-route uris but received: %d", len(s.RecordRoute))
+	}
+	uac := s.RouteSet(true)
+	uas := s.RouteSet(false)
+	if len(uac) != 3 || uac[0].Host != "p1.example.com" || uac[2].Host != "p3.example.com" {
+		t.Errorf("[TestRouteSet] The uac route set should be the record-route in reverse order.")
+	}
+	if len(uas) != 3 || uas[0].Host != "p3.example.com" || uas[2].Host != "p1.example.com" {
+		t.Errorf("[TestRouteSet] The uas route set should be the record-route in order.")
+	}
+	uac[0].Host = "changed"
+	if s.RecordRoute[2].Host != "p1.example.com" {
+		t.Errorf("[TestRouteSet] The route set should be a copy of the record-route uris.")
+	}
+	lazy := ParseMsgWithOptions(msg, ParseOptions{Lazy: true})
+	if len(lazy.RouteSet(true)) != 3 {
+		t.Errorf("[TestRouteSet] The route set should be built from a lazily parsed msg.")
+	}
+}
+
+func TestApplyRouteSet(t *testing.T) {
+	target := ParseURI("sip:bob@192.0.2.4")
+	req := NewRequest(SIP_METHOD_BYE, ParseURI("sip:bob@biloxi.com"))
+	if hop := req.ApplyRouteSet(nil, target); hop.Host != "192.0.2.4" || req.StartLine.URI.Host != "192.0.2.4" || len(req.Route) != 0 {
+		t.Errorf("[TestApplyRouteSet] Without a route set the request should go to the remote target.")
+	}
+	loose := []*URI{ParseURI("sip:p1.example.com;lr"), ParseURI("sip:p2.example.com;lr")}
+	hop := req.ApplyRouteSet(loose, target)
+	if hop.Host != "p1.example.com" || req.StartLine.URI.Host != "192.0.2.4" || len(req.Route) != 2 {
+		t.Errorf("[TestApplyRouteSet] With a loose router the request uri should be the remote target.")
+	}
+	strict := []*URI{ParseURI("sip:p1.example.com;method=INVITE?foo=bar"), ParseURI("sip:p2.example.com;lr")}
+	hop = req.ApplyRouteSet(strict, target)
+	if hop.Host != "p1.example.com" || req.StartLine.URI.String() != "sip:p1.example.com" {
+		t.Errorf("[TestApplyRouteSet] With a strict router the request uri should be the first route.  Received: %q", req.StartLine.URI.String())
+	}
+	if len(req.Route) != 2 || req.Route[1].String() != "sip:bob@192.0.2.4" {
+		t.Errorf("[TestApplyRouteSet] With a strict router the remote target should be the last route.")
+	}
+	if hop := req.ApplyRouteSet(strict, nil); hop.Host != "p1.example.com" || len(req.Route) != 1 || !strings.Contains(req.String(), "Route: <sip:p2.example.com;lr>\r\n") {
+		t.Errorf("[TestApplyRouteSet] A nil remote target should not be added to the Route hdrs.")
+	}
+	req.ApplyRouteSet(strict, target)
+	out := ParseMsg(req.String())
+	if out.Error != nil || !strings.HasPrefix(req.String(), "BYE sip:p1.example.com SIP/2.0\r\n") || len(out.Route) != 2 {
+		t.Errorf("[TestApplyRouteSet] Request did not render correctly.  Received: %q", req.String())
+	}
+}
+
+func TestStrictLooseRoute(t *testing.T) {
+	msg := "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds\r\n" +
+		"Route: <sip:strict.example.com>, <sip:p2.example.com;lr>\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	s := ParseMsg(msg)
+	if !s.StrictRoute() {
+		t.Fatalf("[TestStrictLooseRoute] A strict first route should rewrite the request.")
+	}
+	if s.StartLine.URI.Host != "strict.example.com" || len(s.Route) != 2 || s.Route[1].Host != "biloxi.com" {
+		t.Errorf("[TestStrictLooseRoute] Strict route rewrite was not done correctly.")
+	}
+	if s.NextHop().Host != "strict.example.com" {
+		t.Errorf("[TestStrictLooseRoute] The next hop should be the strict router.  Received: %q", s.NextHop().String())
+	}
+	// the strict router (which is us) gets the request and undoes it
+	isLocal := func(u *URI) bool { return u.Host == "strict.example.com" || u.Host == "p2.example.com" }
+	if !s.LooseRoute(isLocal) {
+		t.Fatalf("[TestStrictLooseRoute] A local request uri should be replaced by the last route.")
+	}
+	if s.StartLine.URI.Host != "biloxi.com" || len(s.Route) != 0 {
+		t.Errorf("[TestStrictLooseRoute] Loose route rewrite was not done correctly.")
+	}
+	if s.NextHop().Host != "biloxi.com" {
+		t.Errorf("[TestStrictLooseRoute] Without a route the next hop should be the request uri.")
+	}
+	s = ParseMsg(strings.Replace(msg, "<sip:strict.example.com>", "<sip:p1.example.com;lr>", 1))
+	if s.StrictRoute() || s.NextHop().Host != "p1.example.com" {
+		t.Errorf("[TestStrictLooseRoute] A loose first route should not rewrite the request.")
+	}
+	s = ParseMsg(strings.Replace(msg, "INVITE sip:bob@biloxi.com", "INVITE sip:strict.example.com", 1))
+	s.Route = append(s.Route, ParseURI("sip:bob@biloxi.com;method=INVITE?subject=x"))
+	if !s.LooseRoute(isLocal) || s.StartLine.URI.String() != "sip:bob@biloxi.com" {
+		t.Errorf("[TestStrictLooseRoute] The request uri from the last route should not have params or headers that are not allowed there.  Received: %q", s.StartLine.URI.String())
+	}
+}
@@ -0,0 +1,537 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"strconv"
+	"strings"
+)
+
+// hdrRef records the position of a hdr in the original msg so that
+// the msg can be rendered with the hdrs in the order they arrived.
+// -- hdr is the canonical (long form, lower case) hdr name
+// -- pos is the index of the first value in the hdr's list (i.e. .Via)
+// -- n is the number of values the hdr added to that list
+// -- raw is the hdr as it was received
+// -- lazy is true if the hdr has been indexed but not parsed yet
+type hdrRef struct {
+	hdr  string
+	raw  *RawHeader
+	pos  int
+	n    int
+	lazy bool
+}
+
+// hdrDisplayNames maps a canonical hdr name to the name that is
+// written on the wire
+var hdrDisplayNames = map[string]string{
+	SIP_HDR_CALL_ID:             "Call-ID",
+	SIP_HDR_CSEQ:                "CSeq",
+	SIP_HDR_RACK:                "RAck",
+	SIP_HDR_RSEQ:                "RSeq",
+	SIP_HDR_WWW_AUTHENTICATE:    "WWW-Authenticate",
+	SIP_HDR_P_ASSERTED_IDENTITY: "P-Asserted-Identity",
+	SIP_HDR_SIP_ETAG:            "SIP-ETag",
+	SIP_HDR_SIP_IF_MATCH:        "SIP-If-Match",
+	SIP_HDR_MIME_VERSION:        "MIME-Version",
+}
+
+// sipHdrRenderOrder is the order in which typed hdrs that were not
+// part of the original msg (i.e. set by hand) get rendered
+var sipHdrRenderOrder = []string{
+	SIP_HDR_FROM,
+	SIP_HDR_TO,
+	SIP_HDR_CALL_ID,
+	SIP_HDR_CSEQ,
+	SIP_HDR_CONTACT,
+	SIP_HDR_MAX_FORWARDS,
+	SIP_HDR_AUTHORIZATION,
+	SIP_HDR_AUTHENTICATION_INFO,
+	SIP_HDR_PROXY_AUTHENTICATE,
+	SIP_HDR_PROXY_AutHORIZATION,
+	SIP_HDR_WWW_AUTHENTICATE,
+	SIP_HDR_RACK,
+	SIP_HDR_REASON,
+	SIP_HDR_WARNING,
+	SIP_HDR_P_ASSERTED_IDENTITY,
+	SIP_HDR_REMOTE_PARTY_ID,
+	SIP_HDR_PRIVACY,
+	SIP_HDR_ACCEPT,
+	SIP_HDR_ALLOW,
+	SIP_HDR_ALLOW_EVENTS,
+	SIP_HDR_SUPPORTED,
+	SIP_HDR_UNSUPPORTED,
+	SIP_HDR_ORGANIZATION,
+	SIP_HDR_USER_AGENT,
+	SIP_HDR_SERVER,
+	SIP_HDR_CONTENT_DISPOSITION,
+	SIP_HDR_CONTENT_TYPE,
+}
+
+// sipKnownHdrs are the long form names of the hdrs in constants.go
+var sipKnownHdrs = []string{
+	SIP_HDR_ACCEPT,
+	SIP_HDR_ACCEPT_CONTACT,
+	SIP_HDR_ACCEPT_ENCODING,
+	SIP_HDR_ACCEPT_LANGUAGE,
+	SIP_HDR_ACCEPT_RESOURCE_PRIORITY,
+	SIP_HDR_ALERT_INFO,
+	SIP_HDR_ALLOW,
+	SIP_HDR_ALLOW_EVENTS,
+	SIP_HDR_ANSWER_MODE,
+	SIP_HDR_AUTHENTICATION_INFO,
+	SIP_HDR_AUTHORIZATION,
+	SIP_HDR_CALL_ID,
+	SIP_HDR_CALL_INFO,
+	SIP_HDR_CONTACT,
+	SIP_HDR_CONTENT_DISPOSITION,
+	SIP_HDR_CONTENT_ENCODING,
+	SIP_HDR_CONTENT_LANGUAGE,
+	SIP_HDR_CONTENT_LENGTH,
+	SIP_HDR_CONTENT_TYPE,
+	SIP_HDR_CSEQ,
+	SIP_HDR_DATE,
+	SIP_HDR_ERROR_INFO,
+	SIP_HDR_EVENT,
+	SIP_HDR_EXPIRES,
+	SIP_HDR_FLOW_TIMER,
+	SIP_HDR_FROM,
+	SIP_HDR_HISTORY_INFO,
+	SIP_HDR_IDENTITY,
+	SIP_HDR_IDENTITY_INFO,
+	SIP_HDR_IN_REPLY_TO,
+	SIP_HDR_JOIN,
+	SIP_HDR_MAX_FORWARDS,
+	SIP_HDR_MIME_VERSION,
+	SIP_HDR_MIN_EXPIRES,
+	SIP_HDR_MIN_SE,
+	SIP_HDR_ORGANIZATION,
+	SIP_HDR_PATH,
+	SIP_HDR_PERMISSION_MISSING,
+	SIP_HDR_PRIORITY,
+	SIP_HDR_PRIVACY,
+	SIP_HDR_PRIV_ANSWER_MODE,
+	SIP_HDR_PROXY_AUTHENTICATE,
+	SIP_HDR_PROXY_AutHORIZATION,
+	SIP_HDR_PROXY_REQUIRE,
+	SIP_HDR_RACK,
+	SIP_HDR_REASON,
+	SIP_HDR_RECORD_ROUTE,
+	SIP_HDR_REFER_SUB,
+	SIP_HDR_REFER_TO,
+	SIP_HDR_REFERRED_BY,
+	SIP_HDR_REJECT_CONTACT,
+	SIP_HDR_REMOTE_PARTY_ID,
+	SIP_HDR_REPLACES,
+	SIP_HDR_REPLY_TO,
+	SIP_HDR_REQUEST_DISPOSITION,
+	SIP_HDR_REQUIRE,
+	SIP_HDR_RESOURCE_PRIORITY,
+	SIP_HDR_RETRY_AFTER,
+	SIP_HDR_ROUTE,
+	SIP_HDR_RSEQ,
+	SIP_HDR_SECUTIRY_CLIENT,
+	SIP_HDR_SECURITY_SERVER,
+	SIP_HDR_SECURITY_VERIFY,
+	SIP_HDR_SERVER,
+	SIP_HDR_SERVICE_ROUTE,
+	SIP_HDR_SESSION_EXPIRES,
+	SIP_HDR_SIP_ETAG,
+	SIP_HDR_SIP_IF_MATCH,
+	SIP_HDR_SUBJECT,
+	SIP_HDR_SUBSCRIPTION_STATE,
+	SIP_HDR_SUPPORTED,
+	SIP_HDR_SUPPRESS_IF_MATCH,
+	SIP_HDR_TARGET_DIALOG,
+	SIP_HDR_TIMESTAMP,
+	SIP_HDR_TO,
+	SIP_HDR_TRIGGER_CONSENT,
+	SIP_HDR_UNSUPPORTED,
+	SIP_HDR_USER_AGENT,
+	SIP_HDR_VIA,
+	SIP_HDR_WARNING,
+	SIP_HDR_WWW_AUTHENTICATE,
+	SIP_HDR_P_ACCESS_NETWORK_INFO,
+	SIP_HDR_P_ANSWER_STATE,
+	SIP_HDR_P_ASSERTED_IDENTITY,
+	SIP_HDR_P_ASSERTED_SERVICE,
+	SIP_HDR_P_ASSOCIATED_URI,
+	SIP_HDR_P_CALLED_PARTY_ID,
+	SIP_HDR_P_CHARGING_FUNCTION_ADDRESSES,
+	SIP_HDR_P_CHARGING_VECTOR,
+	SIP_HDR_P_DCS_BILLING_INFO,
+	SIP_HDR_P_DCS_LAES,
+	SIP_HDR_P_DCS_OSPS,
+	SIP_HDR_P_DCS_REDIRECT,
+	SIP_HDR_P_DCS_TRACE_PARTY_ID,
+	SIP_HDR_P_EARLY_MEDIA,
+	SIP_HDR_P_MEDIA_AUTHORIZATION,
+	SIP_HDR_P_PREFERRED_IDENTITY,
+	SIP_HDR_P_PREFERRED_SERVICE,
+	SIP_HDR_P_PROFILE_KEY,
+	SIP_HDR_P_USER_DATABASE,
+	SIP_HDR_P_VISITED_NETWORK_ID,
+}
+
+// sipHdrCanonical maps the lower case long and compact form of every
+// known hdr to its canonical name
+var sipHdrCanonical = make(map[string]string)
+
+func init() {
+	for _, h := range sipKnownHdrs {
+		sipHdrCanonical[h] = h
+	}
+	for c, h := range SIP_HDR_COMPACT_FORMS {
+		sipHdrCanonical[c] = h
+	}
+}
+
+// canonicalHdr returns the long form lower case name of a hdr.  Known
+// hdr names are lower cased on the stack and looked up so that they
+// do not allocate.
+func canonicalHdr(s string) string {
+	var b [64]byte
+	if len(s) <= len(b) {
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			b[i] = c
+		}
+		if h, ok := sipHdrCanonical[string(b[0:len(s)])]; ok {
+			return h
+		}
+	}
+	return strings.ToLower(s)
+}
+
+// displayHdr returns the name of a hdr as it is written on the wire
+// (i.e. "call-id" becomes "Call-ID" and "x-foo-bar" becomes "X-Foo-Bar")
+func displayHdr(s string) string {
+	s = canonicalHdr(s)
+	if d, ok := hdrDisplayNames[s]; ok {
+		return d
+	}
+	b := []byte(s)
+	up := true
+	for i := range b {
+		if up && b[i] >= 'a' && b[i] <= 'z' {
+			b[i] = b[i] - 'a' + 'A'
+		}
+		up = b[i] == '-'
+	}
+	return string(b)
+}
+
+// hdrListLen returns the length of the list that the values of the
+// canonical hdr name are stored in
+func (s *SipMsg) hdrListLen(hdr string) int {
+	switch hdr {
+	case SIP_HDR_VIA:
+		return len(s.Via)
+	case SIP_HDR_ROUTE:
+		return len(s.Route)
+	case SIP_HDR_RECORD_ROUTE:
+		return len(s.RecordRoute)
+	case SIP_HDR_AUTHORIZATION:
+		return len(s.Authorizations)
+	case SIP_HDR_PROXY_AUTHENTICATE:
+		return len(s.ProxyAuthenticates)
+	case SIP_HDR_PROXY_AutHORIZATION:
+		return len(s.ProxyAuthorizations)
+	case SIP_HDR_WWW_AUTHENTICATE:
+		return len(s.WWWAuthenticates)
+	case SIP_HDR_ALLOW, SIP_HDR_ALLOW_EVENTS, SIP_HDR_SUPPORTED, SIP_HDR_UNSUPPORTED:
+		return len(s.strList(hdr))
+	}
+	return len(s.Headers)
+}
+
+// strList returns the values of a list hdr (nil if hdr is not one)
+func (s *SipMsg) strList(hdr string) []string {
+	switch hdr {
+	case SIP_HDR_ALLOW:
+		return s.Allow
+	case SIP_HDR_ALLOW_EVENTS:
+		return s.AllowEvents
+	case SIP_HDR_SUPPORTED:
+		return s.Supported
+	case SIP_HDR_UNSUPPORTED:
+		return s.Unsupported
+	}
+	return nil
+}
+
+// mergedHdr returns true if every instance of the hdr is rendered
+// from its typed field in one go (the Contacts of every Contact hdr)
+func (s *SipMsg) mergedHdr(hdr string) bool {
+	return hdr == SIP_HDR_CONTACT && len(s.Contacts) != 0
+}
+
+// isListHdr returns true for the hdrs whose values are kept in a
+// []string (see strList)
+func isListHdr(hdr string) bool {
+	switch hdr {
+	case SIP_HDR_ALLOW, SIP_HDR_ALLOW_EVENTS, SIP_HDR_SUPPORTED, SIP_HDR_UNSUPPORTED:
+		return true
+	}
+	return false
+}
+
+// hdrValue returns the rendered value of a typed hdr and false if
+// the hdr is not set
+func (s *SipMsg) hdrValue(hdr string) (string, bool) {
+	switch hdr {
+	case SIP_HDR_ACCEPT:
+		if s.Accept != nil {
+			return s.Accept.String(), true
+		}
+	case SIP_HDR_ALLOW:
+		if s.Allow != nil {
+			return strings.Join(s.Allow, ", "), true
+		}
+	case SIP_HDR_ALLOW_EVENTS:
+		if s.AllowEvents != nil {
+			return strings.Join(s.AllowEvents, ", "), true
+		}
+	case SIP_HDR_AUTHENTICATION_INFO:
+		if s.AuthenticationInfo != nil {
+			return s.AuthenticationInfo.String(), true
+		}
+	case SIP_HDR_CALL_ID:
+		return s.CallId, s.CallId != ""
+	case SIP_HDR_CONTACT:
+		if len(s.Contacts) != 0 {
+			val := ""
+			for i := range s.Contacts {
+				if i != 0 {
+					val += ", "
+				}
+				val += s.Contacts[i].String()
+			}
+			return val, true
+		}
+		if s.Contact != nil {
+			return s.Contact.String(), true
+		}
+		return s.ContactVal, s.ContactVal != ""
+	case SIP_HDR_CONTENT_DISPOSITION:
+		if s.ContentDisposition != nil {
+			return s.ContentDisposition.String(), true
+		}
+	case SIP_HDR_CONTENT_TYPE:
+		return s.ContentType, s.ContentType != ""
+	case SIP_HDR_CSEQ:
+		if s.Cseq != nil {
+			return s.Cseq.String(), true
+		}
+	case SIP_HDR_FROM:
+		if s.From != nil {
+			return s.From.String(), true
+		}
+	case SIP_HDR_MAX_FORWARDS:
+		return s.MaxForwards, s.MaxForwards != ""
+	case SIP_HDR_ORGANIZATION:
+		return s.Organization, s.Organization != ""
+	case SIP_HDR_P_ASSERTED_IDENTITY:
+		if s.PAssertedId != nil {
+			return s.PAssertedId.String(), true
+		}
+		return s.PAssertedIdVal, s.PAssertedIdVal != ""
+	case SIP_HDR_PRIVACY:
+		return s.Privacy, s.Privacy != ""
+	case SIP_HDR_RACK:
+		if s.Rack != nil {
+			return s.Rack.String(), true
+		}
+	case SIP_HDR_REASON:
+		if s.Reason != nil {
+			return s.Reason.String(), true
+		}
+	case SIP_HDR_REMOTE_PARTY_ID:
+		if s.RemotePartyId != nil {
+			return s.RemotePartyId.String(), true
+		}
+		return s.RemotePartyIdVal, s.RemotePartyIdVal != ""
+	case SIP_HDR_SERVER:
+		return s.Server, s.Server != ""
+	case SIP_HDR_SUPPORTED:
+		if s.Supported != nil {
+			return strings.Join(s.Supported, ", "), true
+		}
+	case SIP_HDR_TO:
+		if s.To != nil {
+			return s.To.String(), true
+		}
+	case SIP_HDR_UNSUPPORTED:
+		if s.Unsupported != nil {
+			return strings.Join(s.Unsupported, ", "), true
+		}
+	case SIP_HDR_USER_AGENT:
+		return s.UserAgent, s.UserAgent != ""
+	case SIP_HDR_WARNING:
+		if s.Warning != nil {
+			return s.Warning.String(), true
+		}
+	}
+	return "", false
+}
+
+// writeHdr writes a single "Name: value" line using the display
+// name of the hdr
+func writeHdr(b *strings.Builder, hdr string, val string) {
+	writeHdrLine(b, displayHdr(hdr), val)
+}
+
+// writeHdrLine writes a single "Name: value" line with the name
+// exactly as it is passed in
+func writeHdrLine(b *strings.Builder, name string, val string) {
+	b.WriteString(name)
+	b.WriteString(": ")
+	b.WriteString(val)
+	b.WriteString("\r\n")
+}
+
+// writeRouteHdr writes a route or record-route hdr for the uris
+func writeRouteHdr(b *strings.Builder, hdr string, uris []*URI) {
+	if len(uris) == 0 {
+		return
+	}
+	val := ""
+	for i := range uris {
+		if i != 0 {
+			val += ", "
+		}
+		val += "<" + uris[i].String() + ">"
+	}
+	writeHdr(b, hdr, val)
+}
+
+// String renders the msg back to wire format.  Hdrs are written in
+// the order they were received followed by any typed hdrs that were
+// set by hand.  A hdr that is received more than once is written
+// more than once: the values of list hdrs (i.e. Allow) are split up
+// the way they arrived and for a hdr with a single typed field (i.e.
+// Warning), which holds the last instance, the earlier instances are
+// written as they were received.  The Content-Length hdr is always
+// recomputed from the .Body field.
+func (s *SipMsg) String() string {
+	s.parseLazyHdrs()
+	b := new(strings.Builder)
+	if s.StartLine != nil {
+		b.WriteString(s.StartLine.String())
+		b.WriteString("\r\n")
+	}
+	done := make(map[string]bool)
+	auths := make(map[string]int)
+	lists := make(map[string]int)
+	last := make(map[string]int)
+	for i := range s.hdrOrder {
+		last[s.hdrOrder[i].hdr] = i
+	}
+	via, route, rr, hdrs := 0, 0, 0, 0
+	for i, ref := range s.hdrOrder {
+		switch ref.hdr {
+		case SIP_HDR_VIA:
+			for i := ref.pos; i < ref.pos+ref.n && i < len(s.Via); i++ {
+				writeHdr(b, SIP_HDR_VIA, s.Via[i].String())
+				via = i + 1
+			}
+		case SIP_HDR_ROUTE:
+			if ref.pos < len(s.Route) && ref.pos+ref.n <= len(s.Route) {
+				writeRouteHdr(b, SIP_HDR_ROUTE, s.Route[ref.pos:ref.pos+ref.n])
+				route = ref.pos + ref.n
+			}
+		case SIP_HDR_RECORD_ROUTE:
+			if ref.pos < len(s.RecordRoute) && ref.pos+ref.n <= len(s.RecordRoute) {
+				writeRouteHdr(b, SIP_HDR_RECORD_ROUTE, s.RecordRoute[ref.pos:ref.pos+ref.n])
+				rr = ref.pos + ref.n
+			}
+		case SIP_HDR_AUTHORIZATION, SIP_HDR_PROXY_AUTHENTICATE, SIP_HDR_PROXY_AutHORIZATION, SIP_HDR_WWW_AUTHENTICATE:
+			l := s.authList(ref.hdr)
+			for i := ref.pos; i < ref.pos+ref.n && i < len(l); i++ {
+				writeHdr(b, ref.hdr, l[i].String())
+				auths[ref.hdr] = i + 1
+			}
+		case SIP_HDR_ALLOW, SIP_HDR_ALLOW_EVENTS, SIP_HDR_SUPPORTED, SIP_HDR_UNSUPPORTED:
+			l := s.strList(ref.hdr)
+			switch {
+			case ref.n == 0 && l != nil:
+				writeHdr(b, ref.hdr, "")
+			case ref.n != 0 && ref.pos+ref.n <= len(l):
+				writeHdr(b, ref.hdr, strings.Join(l[ref.pos:ref.pos+ref.n], ", "))
+				lists[ref.hdr] = ref.pos + ref.n
+			}
+		case SIP_HDR_CONTENT_LENGTH:
+		default:
+			if ref.n != 0 {
+				if ref.pos < len(s.Headers) {
+					writeHdrLine(b, ref.raw.Name, s.Headers[ref.pos].Val)
+					hdrs = ref.pos + 1
+				}
+				continue
+			}
+			if done[ref.hdr] {
+				continue
+			}
+			val, ok := s.hdrValue(ref.hdr)
+			switch {
+			case !ok:
+			case i != last[ref.hdr] && !s.mergedHdr(ref.hdr):
+				// the typed field only holds the last instance
+				writeHdr(b, ref.hdr, ref.raw.Val)
+				continue
+			default:
+				writeHdr(b, ref.hdr, val)
+			}
+			done[ref.hdr] = true
+		}
+	}
+	for ; via < len(s.Via); via++ {
+		writeHdr(b, SIP_HDR_VIA, s.Via[via].String())
+	}
+	if route < len(s.Route) {
+		writeRouteHdr(b, SIP_HDR_ROUTE, s.Route[route:])
+	}
+	if rr < len(s.RecordRoute) {
+		writeRouteHdr(b, SIP_HDR_RECORD_ROUTE, s.RecordRoute[rr:])
+	}
+	for _, hdr := range sipHdrRenderOrder {
+		if done[hdr] {
+			continue
+		}
+		if isAuthHdr(hdr) {
+			l := s.authList(hdr)
+			for i := auths[hdr]; i < len(l); i++ {
+				writeHdr(b, hdr, l[i].String())
+			}
+			continue
+		}
+		if isListHdr(hdr) {
+			_, received := last[hdr]
+			if l := s.strList(hdr); l != nil && (lists[hdr] < len(l) || !received) {
+				writeHdr(b, hdr, strings.Join(l[lists[hdr]:], ", "))
+			}
+			continue
+		}
+		if val, ok := s.hdrValue(hdr); ok {
+			writeHdr(b, hdr, val)
+		}
+	}
+	for ; hdrs < len(s.Headers); hdrs++ {
+		writeHdr(b, s.Headers[hdrs].Header, s.Headers[hdrs].Val)
+	}
+	writeHdr(b, SIP_HDR_CONTENT_LENGTH, strconv.Itoa(len(s.Body)))
+	b.WriteString("\r\n")
+	b.WriteString(s.Body)
+	return b.String()
+}
+
+// Bytes is the same as String but returns a []byte
+func (s *SipMsg) Bytes() []byte {
+	return []byte(s.String())
+}
@@ -0,0 +1,116 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"strings"
+	"testing"
+)
+
+var testSerializeMsg = "SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK24477ab511325213INV52e94be64e6687e3;received=0.0.0.0\r\nv: SIP/2.0/TCP 1.1.1.1:5060;branch=z9hG4bK776asdhds;rport\r\nContact: <sip:10003053258853@0.0.0.0:6060>\r\nTo: <sip:10003053258853@0.0.0.0;user=phone;noa=national>;tag=a94c095b773be1dd6e8d668a785a9c843f6f2cc0\r\nFrom: <sip:8173383772@0.0.0.0;user=phone;noa=national>;tag=52e94be6-co2998-INS002\r\nCall-ID: 111118149-3524331107-398662@barinfo.fooinfous.com\r\nCSeq: 299801 INVITE\r\nX-Nonsense-Hdr: nonsense\r\nRecord-Route: <sip:p1.example.com;lr>, <sip:p2.example.com;lr>\r\nContent-Type: application/sdp\r\nContent-Length: 239\r\n\r\nv=0\r\n"
+
+func TestSipMsgString(t *testing.T) {
+	s := ParseMsg(testSerializeMsg)
+	if s.Error != nil {
+		t.Fatalf("[TestSipMsgString] Error parsing msg.  Received: %s", s.Error.Error())
+	}
+	str := s.String()
+	want := "SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK24477ab511325213INV52e94be64e6687e3;received=0.0.0.0\r\nVia: SIP/2.0/TCP 1.1.1.1:5060;branch=z9hG4bK776asdhds;rport\r\nContact: <sip:10003053258853@0.0.0.0:6060>\r\nTo: <sip:10003053258853@0.0.0.0;user=phone;noa=national>;tag=a94c095b773be1dd6e8d668a785a9c843f6f2cc0\r\nFrom: <sip:8173383772@0.0.0.0;user=phone;noa=national>;tag=52e94be6-co2998-INS002\r\nCall-ID: 111118149-3524331107-398662@barinfo.fooinfous.com\r\nCSeq: 299801 INVITE\r\nX-Nonsense-Hdr: nonsense\r\nRecord-Route: <sip:p1.example.com;lr>, <sip:p2.example.com;lr>\r\nContent-Type: application/sdp\r\nContent-Length: 5\r\n\r\nv=0\r\n"
+	if str != want {
+		t.Errorf("[TestSipMsgString] Error rendering msg.  Received: %q", str)
+	}
+	r := ParseMsg(str)
+	if r.Error != nil {
+		t.Errorf("[TestSipMsgString] Error parsing rendered msg.  Received: %s", r.Error.Error())
+	}
+	if r.String() != str {
+		t.Errorf("[TestSipMsgString] Rendering a re-parsed msg should give the same result.")
+	}
+	if string(s.Bytes()) != str {
+		t.Errorf("[TestSipMsgString] s.Bytes() should match s.String().")
+	}
+}
+
+func TestSipMsgStringRewrite(t *testing.T) {
+	s := ParseMsg(testSerializeMsg)
+	s.Via = s.Via[1:]
+	s.From.URI.Host = "example.com"
+	s.Body = ""
+	s.MaxForwards = "70"
+	str := s.String()
+	if strings.Contains(str, "branch=z9hG4bK24477ab511325213INV52e94be64e6687e3") {
+		t.Errorf("[TestSipMsgStringRewrite] Removed via should not be rendered.")
+	}
+	if !strings.Contains(str, "\r\nFrom: <sip:8173383772@example.com;user=phone;noa=national>;tag=52e94be6-co2998-INS002\r\n") {
+		t.Errorf("[TestSipMsgStringRewrite] Changed from host should be rendered.  Received: %q", str)
+	}
+	if !strings.Contains(str, "\r\nMax-Forwards: 70\r\n") {
+		t.Errorf("[TestSipMsgStringRewrite] Max-Forwards set by hand should be rendered.")
+	}
+	if !strings.HasSuffix(str, "\r\nContent-Length: 0\r\n\r\n") {
+		t.Errorf("[TestSipMsgStringRewrite] Content-Length should be recomputed to 0.  Received: %q", str)
+	}
+}
+
+func TestDisplayHdr(t *testing.T) {
+	if displayHdr("call-id") != "Call-ID" {
+		t.Errorf("[TestDisplayHdr] \"call-id\" should be rendered as \"Call-ID\".")
+	}
+	if displayHdr("x-nonsense-hdr") != "X-Nonsense-Hdr" {
+		t.Errorf("[TestDisplayHdr] \"x-nonsense-hdr\" should be rendered as \"X-Nonsense-Hdr\".")
+	}
+	if displayHdr("m") != "Contact" {
+		t.Errorf("[TestDisplayHdr] compact form \"m\" should be rendered as \"Contact\".")
+	}
+}
+
+func TestSipMsgStringRepeatedHdrs(t *testing.T) {
+	msg := "SIP/2.0 488 Not Acceptable Here\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bKnashds7\r\n" +
+		"From: <sip:alice@atlanta.com>;tag=1928301774\r\n" +
+		"To: <sip:bob@biloxi.com>;tag=a6c85cf\r\n" +
+		"Call-ID: a84b4c76e66710\r\n" +
+		"CSeq: 314159 INVITE\r\n" +
+		"Allow: INVITE\r\n" +
+		"Supported: timer\r\n" +
+		"Allow: BYE, CANCEL\r\n" +
+		"Supported: 100rel\r\n" +
+		"Unsupported: foo\r\n" +
+		"Unsupported: bar\r\n" +
+		"Warning: 301 isi.edu \"Incompatible network address type 'E.164'\"\r\n" +
+		"Warning: 399 biloxi.com \"Other warning\"\r\n" +
+		"Reason: SIP;cause=580;text=\"Precondition Failure\"\r\n" +
+		"Reason: Q.850;cause=16;text=\"Terminated\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	for _, lazy := range []bool{false, true} {
+		s := ParseMsgWithOptions(msg, ParseOptions{Lazy: lazy})
+		if s.Error != nil {
+			t.Fatalf("[TestSipMsgStringRepeatedHdrs] Error parsing msg.  Received: %s", s.Error.Error())
+		}
+		if str := s.String(); str != msg {
+			t.Errorf("[TestSipMsgStringRepeatedHdrs] Repeated hdrs should round trip (lazy: %t).  Received: %q", lazy, str)
+		}
+		if strings.Join(s.GetAllow(), ",") != "INVITE,BYE,CANCEL" || strings.Join(s.GetSupported(), ",") != "timer,100rel" {
+			t.Errorf("[TestSipMsgStringRepeatedHdrs] Every instance of a list hdr should be kept.  Received: %v and %v", s.Allow, s.Supported)
+		}
+		if s.GetWarning() == nil || s.Warning.Code != "399" {
+			t.Errorf("[TestSipMsgStringRepeatedHdrs] Warning should be the last instance.  Received: %+v", s.Warning)
+		}
+	}
+	// values added by hand go in a hdr of their own and a cleared
+	// list drops every instance
+	s := ParseMsg(msg)
+	s.Allow = append(s.Allow, "ACK")
+	s.Supported = nil
+	s.Warning = nil
+	str := s.String()
+	if !strings.Contains(str, "Allow: INVITE\r\n") || !strings.Contains(str, "Allow: BYE, CANCEL\r\n") || !strings.Contains(str, "Allow: ACK\r\n") {
+		t.Errorf("[TestSipMsgStringRepeatedHdrs] An Allow value added by hand should be rendered.  Received: %q", str)
+	}
+	if strings.Contains(str, "Supported: ") || strings.Contains(str, "Warning: ") {
+		t.Errorf("[TestSipMsgStringRepeatedHdrs] Cleared hdrs should not be rendered.  Received: %q", str)
+	}
+}
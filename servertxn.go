@@ -0,0 +1,229 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ServerTransaction is an INVITE (RFC 3261 17.2.1) or non-INVITE
+// (17.2.2) server transaction.  The callbacks are called without the
+// transaction locked (and from the goroutine of the timer for the
+// ones that come from a timer).
+// The fields are as follows:
+// -- Request is the request that created the transaction
+// -- OnTimeout is called when Timer H fires (no ACK for a final
+// response to an INVITE)
+// -- OnTransportError is called when Send fails
+// -- OnTerminated is called once the transaction is terminated
+type ServerTransaction struct {
+	txn
+	Request          *SipMsg
+	OnTimeout        func()
+	OnTransportError func(err error)
+	OnTerminated     func()
+	invite           bool
+	rfc2543          bool
+	interval         time.Duration
+	last             *SipMsg
+}
+
+// NewServerTransaction returns a server transaction for a request
+// that did not match one (see TxnTable).  Start starts it.
+func NewServerTransaction(req *SipMsg, cfg *TxnConfig) (*ServerTransaction, error) {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return nil, fmt.Errorf("%w: NewServerTransaction err: msg is not a request", ErrTransaction)
+	}
+	if req.StartLine.Method == SIP_METHOD_ACK {
+		return nil, fmt.Errorf("%w: NewServerTransaction err: an ACK has no transaction", ErrTransaction)
+	}
+	key, err := ServerTxnKey(req)
+	if err != nil {
+		return nil, err
+	}
+	tx := &ServerTransaction{Request: req, invite: req.StartLine.Method == SIP_METHOD_INVITE}
+	tx.rfc2543 = !isRFC3261Branch(topVia(req).Branch)
+	tx.cfg = cfg.withDefaults()
+	tx.key = key
+	tx.timers = make(map[string]*txnTimer)
+	tx.state = TXN_STATE_TRYING
+	if tx.invite {
+		tx.state = TXN_STATE_PROCEEDING
+	}
+	return tx, nil
+}
+
+// Start starts the transaction.  An INVITE server transaction sends
+// a 100 Trying if the TU has not responded within SIP_TIMER_TRYING.
+func (t *ServerTransaction) Start() {
+	if !t.invite {
+		return
+	}
+	t.mu.Lock()
+	t.startTimer("Trying", SIP_TIMER_TRYING, t.trying)
+	t.mu.Unlock()
+}
+
+// trying sends the 100 Trying
+func (t *ServerTransaction) trying() []func() {
+	if t.state != TXN_STATE_PROCEEDING || t.last != nil {
+		return nil
+	}
+	t.last = NewResponse(t.Request, 100, "")
+	after, _ := t.send(t.last)
+	return after
+}
+
+// send sends the msg and terminates the transaction if it fails.
+// It returns the error (and the funcs to call) if it failed.  t.mu
+// must be held.
+func (t *ServerTransaction) send(msg *SipMsg) ([]func(), error) {
+	if t.cfg.Send == nil {
+		return nil, nil
+	}
+	if err := t.cfg.Send(msg); err != nil {
+		after := []func(){}
+		if t.OnTransportError != nil {
+			f := t.OnTransportError
+			after = append(after, func() { f(err) })
+		}
+		return append(after, t.terminate(t.OnTerminated)...), err
+	}
+	return nil, nil
+}
+
+// responseToTag returns the To tag of the last response that was
+// sent (the tag that the ACK of an RFC 2543 client has)
+func (t *ServerTransaction) responseToTag() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		return ""
+	}
+	return toTag(t.last)
+}
+
+// Respond sends a response from the TU.  It returns an error if the
+// transaction can not send a response in its state (i.e. it already
+// sent a final response) or if Send fails.
+func (t *ServerTransaction) Respond(resp *SipMsg) error {
+	if resp.StartLine == nil || resp.StartLine.Type != SIP_RESPONSE {
+		return fmt.Errorf("%w: Respond err: msg is not a response", ErrTransaction)
+	}
+	code, err := strconv.Atoi(resp.StartLine.Resp)
+	if err != nil || code < 100 || code > 699 {
+		return fmt.Errorf("%w: Respond err: invalid status code: %s", ErrTransaction, resp.StartLine.Resp)
+	}
+	t.mu.Lock()
+	after, err := t.respond(resp, code)
+	t.mu.Unlock()
+	runAll(after)
+	return err
+}
+
+// respond does the work of Respond with t.mu held
+func (t *ServerTransaction) respond(resp *SipMsg, code int) ([]func(), error) {
+	if t.state != TXN_STATE_TRYING && t.state != TXN_STATE_PROCEEDING {
+		return nil, fmt.Errorf("%w: Respond err: transaction is %s", ErrTransaction, t.state)
+	}
+	t.stopTimer("Trying")
+	t.last = resp
+	if after, err := t.send(resp); err != nil {
+		return after, err
+	}
+	switch {
+	case code < 200:
+		t.state = TXN_STATE_PROCEEDING
+		return nil, nil
+	case t.invite && code < 300:
+		// the TU takes care of the 2xx from here (RFC 3261 13.3.1.4)
+		return t.terminate(t.OnTerminated), nil
+	}
+	t.state = TXN_STATE_COMPLETED
+	if !t.invite {
+		return t.wait("J", t.cfg.unreliable(64*t.cfg.T1)), nil
+	}
+	if !t.cfg.Reliable {
+		t.interval = t.cfg.T1
+		t.startTimer("G", t.interval, t.retransmit)
+	}
+	t.startTimer("H", 64*t.cfg.T1, t.timeout)
+	return nil, nil
+}
+
+// wait starts the timer (I or J) after which the transaction is
+// terminated (or terminates it now if d is 0).  t.mu must be held.
+func (t *ServerTransaction) wait(name string, d time.Duration) []func() {
+	if d == 0 {
+		return t.terminate(t.OnTerminated)
+	}
+	t.startTimer(name, d, t.terminated)
+	return nil
+}
+
+// retransmit is Timer G.  It doubles up to T2.
+func (t *ServerTransaction) retransmit() []func() {
+	if t.state != TXN_STATE_COMPLETED {
+		return nil
+	}
+	if after, err := t.send(t.last); err != nil {
+		return after
+	}
+	t.interval *= 2
+	if t.interval > t.cfg.T2 {
+		t.interval = t.cfg.T2
+	}
+	t.startTimer("G", t.interval, t.retransmit)
+	return nil
+}
+
+// timeout is Timer H
+func (t *ServerTransaction) timeout() []func() {
+	if t.state != TXN_STATE_COMPLETED {
+		return nil
+	}
+	return append([]func(){t.OnTimeout}, t.terminate(t.OnTerminated)...)
+}
+
+// terminated is Timer I or J
+func (t *ServerTransaction) terminated() []func() {
+	return t.terminate(t.OnTerminated)
+}
+
+// Receive handles a request that matched the transaction: a
+// retransmission of the request (which gets the last response again)
+// or the ACK for a final response to an INVITE
+func (t *ServerTransaction) Receive(req *SipMsg) {
+	if req.StartLine == nil || req.StartLine.Type != SIP_REQUEST {
+		return
+	}
+	t.mu.Lock()
+	var after []func()
+	switch {
+	case req.StartLine.Method == SIP_METHOD_ACK:
+		if t.invite && t.state == TXN_STATE_COMPLETED {
+			t.state = TXN_STATE_CONFIRMED
+			t.stopTimer("G")
+			t.stopTimer("H")
+			after = t.wait("I", t.cfg.unreliable(t.cfg.T4))
+		}
+	case t.last != nil && (t.state == TXN_STATE_PROCEEDING || t.state == TXN_STATE_COMPLETED):
+		after, _ = t.send(t.last)
+	}
+	t.mu.Unlock()
+	runAll(after)
+}
+
+// Terminate terminates the transaction (i.e. when the TU gives up
+// on it)
+func (t *ServerTransaction) Terminate() {
+	t.mu.Lock()
+	after := t.terminate(t.OnTerminated)
+	t.mu.Unlock()
+	runAll(after)
+}
@@ -0,0 +1,134 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestServerTxn(t *testing.T, method string, cfg *TxnConfig) (*ServerTransaction, *clientTxnEvents) {
+	req := ParseMsg(NewRequest(method, ParseURI("sip:bob@biloxi.com")).String())
+	tx, err := NewServerTransaction(req, cfg)
+	if err != nil {
+		t.Fatalf("[newTestServerTxn] Error creating transaction.  Received: %s", err.Error())
+	}
+	ev := &clientTxnEvents{}
+	tx.OnTimeout = func() { ev.timeout++ }
+	tx.OnTerminated = func() { ev.terminated++ }
+	tx.OnTransportError = func(err error) { ev.err = err }
+	tx.Start()
+	return tx, ev
+}
+
+func TestServerInvite(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestServerTxn(t, SIP_METHOD_INVITE, testTxnConfig(c, tt))
+	if tx.State() != TXN_STATE_PROCEEDING {
+		t.Fatalf("[TestServerInvite] Should start in Proceeding.")
+	}
+	c.Advance(SIP_TIMER_TRYING)
+	if tt.count("100") != 1 {
+		t.Fatalf("[TestServerInvite] A 100 Trying should be sent after 200ms.")
+	}
+	tx.Receive(tx.Request)
+	if tt.count("100") != 2 {
+		t.Errorf("[TestServerInvite] A retransmitted INVITE should get the 100 again.")
+	}
+	if err := tx.Respond(NewResponse(tx.Request, 486, "")); err != nil || tx.State() != TXN_STATE_COMPLETED {
+		t.Fatalf("[TestServerInvite] A 486 should move the transaction to Completed.")
+	}
+	// Timer G fires at 0.5, 1.5, 3.5, 7.5 and then every T2
+	c.Advance(7500 * time.Millisecond)
+	if tt.count("486") != 5 {
+		t.Errorf("[TestServerInvite] Should have retransmitted the 486 4 times.  Received: %d", tt.count("486")-1)
+	}
+	c.Advance(4 * time.Second)
+	if tt.count("486") != 6 {
+		t.Errorf("[TestServerInvite] Timer G should be capped at T2.  Received: %d", tt.count("486")-1)
+	}
+	tx.Receive(tx.Request)
+	if tt.count("486") != 7 {
+		t.Errorf("[TestServerInvite] A retransmitted INVITE should get the 486 again.")
+	}
+	if err := tx.Respond(NewResponse(tx.Request, 200, "")); !errors.Is(err, ErrTransaction) {
+		t.Errorf("[TestServerInvite] A second final response should be an ErrTransaction.")
+	}
+	tx.Receive(ParseMsg(NewAckForNon2xx(tx.Request, tt.sent[len(tt.sent)-1]).String()))
+	if tx.State() != TXN_STATE_CONFIRMED {
+		t.Fatalf("[TestServerInvite] An ACK should move the transaction to Confirmed.")
+	}
+	c.Advance(SIP_T4 - time.Millisecond)
+	if tt.count("486") != 7 || tx.State() != TXN_STATE_CONFIRMED {
+		t.Errorf("[TestServerInvite] Nothing should be sent in Confirmed.")
+	}
+	c.Advance(time.Millisecond)
+	if tx.State() != TXN_STATE_TERMINATED || ev.timeout != 0 || ev.terminated != 1 {
+		t.Errorf("[TestServerInvite] Timer I should terminate the transaction.")
+	}
+}
+
+func TestServerInviteTimeout(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestServerTxn(t, SIP_METHOD_INVITE, testTxnConfig(c, tt))
+	tx.Respond(NewResponse(tx.Request, 180, ""))
+	c.Advance(time.Second)
+	if tt.count("100") != 0 || tt.count("180") != 1 {
+		t.Errorf("[TestServerInviteTimeout] No 100 Trying should be sent once the TU responded.")
+	}
+	tx.Respond(NewResponse(tx.Request, 404, ""))
+	c.Advance(64 * SIP_T1)
+	if tx.State() != TXN_STATE_TERMINATED || ev.timeout != 1 {
+		t.Errorf("[TestServerInviteTimeout] Timer H should time the transaction out.")
+	}
+
+	tx, ev = newTestServerTxn(t, SIP_METHOD_INVITE, testTxnConfig(c, tt))
+	if err := tx.Respond(NewResponse(tx.Request, 200, "")); err != nil || tx.State() != TXN_STATE_TERMINATED || ev.terminated != 1 {
+		t.Errorf("[TestServerInviteTimeout] A 2xx should terminate the transaction.")
+	}
+}
+
+func TestServerNonInvite(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	tx, ev := newTestServerTxn(t, SIP_METHOD_REGISTER, testTxnConfig(c, tt))
+	if tx.State() != TXN_STATE_TRYING {
+		t.Fatalf("[TestServerNonInvite] Should start in Trying.")
+	}
+	tx.Receive(tx.Request)
+	c.Advance(time.Second)
+	if len(tt.sent) != 0 {
+		t.Errorf("[TestServerNonInvite] Retransmissions should be absorbed in Trying and no 100 sent.")
+	}
+	tx.Respond(NewResponse(tx.Request, 100, ""))
+	tx.Receive(tx.Request)
+	if tx.State() != TXN_STATE_PROCEEDING || tt.count("100") != 2 {
+		t.Errorf("[TestServerNonInvite] A retransmission should get the 100 again in Proceeding.")
+	}
+	tx.Respond(NewResponse(tx.Request, 200, ""))
+	tx.Receive(tx.Request)
+	if tx.State() != TXN_STATE_COMPLETED || tt.count("200") != 2 {
+		t.Errorf("[TestServerNonInvite] A retransmission should get the 200 again in Completed.")
+	}
+	c.Advance(64 * SIP_T1)
+	if tx.State() != TXN_STATE_TERMINATED || ev.terminated != 1 {
+		t.Errorf("[TestServerNonInvite] Timer J should terminate the transaction.")
+	}
+
+	cfg := testTxnConfig(c, tt)
+	cfg.Reliable = true
+	tx, _ = newTestServerTxn(t, SIP_METHOD_OPTIONS, cfg)
+	tx.Respond(NewResponse(tx.Request, 200, ""))
+	if tx.State() != TXN_STATE_TERMINATED {
+		t.Errorf("[TestServerNonInvite] Timer J should be 0 on a reliable transport.")
+	}
+	tx, _ = newTestServerTxn(t, SIP_METHOD_INVITE, cfg)
+	tx.Respond(NewResponse(tx.Request, 500, ""))
+	tx.Receive(ParseMsg(NewAckForNon2xx(tx.Request, tt.sent[len(tt.sent)-1]).String()))
+	if tx.State() != TXN_STATE_TERMINATED {
+		t.Errorf("[TestServerNonInvite] Timer I should be 0 on a reliable transport.")
+	}
+}
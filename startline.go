@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -43,6 +43,7 @@ type StartLine struct {
 	RespText string "resptext"
 	Proto    string "proto"
 	Version  string "version"
+	spareURI *URI
 }
 
 func (s *StartLine) run() {
@@ -56,7 +57,7 @@ func parseStartLine(s *StartLine) parseStartLineStateFn {
 		return nil
 	}
 	if len(s.Val) < 3 {
-		s.Error = errors.New("parseStartLine err: length of s.Val is less than 3. Invalid start line.")
+		s.Error = fmt.Errorf("%w: parseStartLine err: length of s.Val is less than 3. Invalid start line.", ErrBadStartLine)
 		return nil
 	}
 	if s.Val[0:3] == "SIP" {
@@ -70,17 +71,17 @@ func parseStartLine(s *StartLine) parseStartLineStateFn {
 func parseStartLineResponse(s *StartLine) parseStartLineStateFn {
 	parts := strings.SplitN(s.Val, " ", 3)
 	if len(parts) != 3 {
-		s.Error = errors.New("parseStartLineRespone err: err getting parts from LWS.")
+		s.Error = fmt.Errorf("%w: parseStartLineRespone err: err getting parts from LWS.", ErrBadStartLine)
 		return nil
 	}
 	charPos := strings.IndexRune(parts[0], '/')
 	if charPos == -1 {
-		s.Error = errors.New("parseStartLineRespone err: err getting proto char.")
+		s.Error = fmt.Errorf("%w: parseStartLineRespone err: err getting proto char.", ErrBadStartLine)
 		return nil
 	}
 	s.Proto = parts[0][0:charPos]
 	if len(parts[0])-1 < charPos+1 {
-		s.Error = errors.New("parseStartLineResponse err: proto char appears to be at end of proto.")
+		s.Error = fmt.Errorf("%w: parseStartLineResponse err: proto char appears to be at end of proto.", ErrBadStartLine)
 		return nil
 	}
 	s.Version = parts[0][charPos+1:]
@@ -92,22 +93,23 @@ func parseStartLineResponse(s *StartLine) parseStartLineStateFn {
 func parseStartLineRequest(s *StartLine) parseStartLineStateFn {
 	parts := strings.SplitN(s.Val, " ", 3)
 	if len(parts) != 3 {
-		s.Error = errors.New("parseStartLineRequest err: request line did split on LWS correctly.")
+		s.Error = fmt.Errorf("%w: parseStartLineRequest err: request line did split on LWS correctly.", ErrBadStartLine)
 		return nil
 	}
 	s.Method = parts[0]
-	s.URI = ParseURI(parts[1])
+	s.URI = reuseURI(s.spareURI, parts[1])
+	s.spareURI = s.URI
 	if s.URI.Error != nil {
-		s.Error = errors.New("parseStartLineRequest err: err in URI: " + s.URI.Error.Error())
+		s.Error = fmt.Errorf("%w: parseStartLineRequest err: err in URI: %w", ErrBadStartLine, s.URI.Error)
 		return nil
 	}
 	charPos := strings.IndexRune(parts[2], '/')
 	if charPos == -1 {
-		s.Error = errors.New("parseStartLineRequest err: could not get \"/\" pos in parts[2].")
+		s.Error = fmt.Errorf("%w: parseStartLineRequest err: could not get \"/\" pos in parts[2].", ErrBadStartLine)
 		return nil
 	}
 	if len(parts[2])-1 < charPos+1 {
-		s.Error = errors.New("parseStartLineRequest err: \"/\" char appears to be at end of line.")
+		s.Error = fmt.Errorf("%w: parseStartLineRequest err: \"/\" char appears to be at end of line.", ErrBadStartLine)
 		return nil
 	}
 	s.Proto = parts[2][0:charPos]
@@ -120,3 +122,27 @@ func ParseStartLine(str string) *StartLine {
 	s.run()
 	return s
 }
+
+// reuseStartLine parses str into s (after resetting it) or into a
+// new *StartLine if s is nil.  The uri that s parsed before is
+// reused (not one that was put in .URI by hand).
+func reuseStartLine(s *StartLine, str string) *StartLine {
+	if s == nil {
+		return ParseStartLine(str)
+	}
+	*s = StartLine{Val: str, spareURI: s.spareURI}
+	s.run()
+	return s
+}
+
+// String returns the start line rendered from its parsed fields
+func (s *StartLine) String() string {
+	if s.Type == SIP_RESPONSE {
+		return s.Proto + "/" + s.Version + " " + s.Resp + " " + s.RespText
+	}
+	uri := ""
+	if s.URI != nil {
+		uri = s.URI.String()
+	}
+	return s.Method + " " + uri + " " + s.Proto + "/" + s.Version
+}
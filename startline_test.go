@@ -51,3 +51,12 @@ func TestStartLine(t *testing.T) {
 		t.Errorf("[TestStartLine] Should have a no version err when parsing request line: \"INVITE foo@bar.com SIP/\".")
 	}
 }
+
+func TestStartLineString(t *testing.T) {
+	for _, str := range []string{"SIP/2.0 487 Request Cancelled", "INVITE sip:+15554440000@0.0.0.0;user=phone SIP/2.0"} {
+		s := ParseStartLine(str)
+		if s.String() != str {
+			t.Errorf("[TestStartLineString] Error rendering startline %q.  Received: %q", str, s.String())
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// streamReadSize is the size of each read from the io.Reader
+	streamReadSize = 4096
+	// STREAM_MAX_MSG_SIZE is the default for StreamParser.MaxMsgSize
+	STREAM_MAX_MSG_SIZE = 65535
+)
+
+var (
+	crlf     = []byte("\r\n")
+	crlfCrlf = []byte("\r\n\r\n")
+)
+
+// StreamParser frames SIP msgs out of a byte stream (i.e. SIP over
+// TCP or TLS) using the Content-Length hdr as RFC 3261 18.3 requires.
+// Msgs can be split across reads or arrive back to back.  CRLF
+// keep-alives (RFC 5626 double CRLF pings and single CRLF pongs)
+// between msgs are skipped.
+// The fields are as follows:
+// -- MaxMsgSize is the largest msg (hdrs and body) that is buffered
+// before Next returns an error (STREAM_MAX_MSG_SIZE by default)
+// -- OnPing (if not nil) is called for every double CRLF ping so that
+// the caller can send back a single CRLF pong
+// A StreamParser is not safe for use by more than one goroutine.
+type StreamParser struct {
+	MaxMsgSize int
+	OnPing     func()
+	r          io.Reader
+	buf        []byte
+	err        error
+}
+
+// NewStreamParser returns a *StreamParser that reads from r.  r can
+// be nil if the data is going to be passed in with Feed instead.
+func NewStreamParser(r io.Reader) *StreamParser {
+	return &StreamParser{MaxMsgSize: STREAM_MAX_MSG_SIZE, r: r}
+}
+
+// Feed adds b to the data that is waiting to be framed
+func (p *StreamParser) Feed(b []byte) {
+	p.buf = append(p.buf, b...)
+}
+
+// Buffered returns the number of bytes that have been read or fed
+// but not yet returned as part of a msg
+func (p *StreamParser) Buffered() int {
+	return len(p.buf)
+}
+
+// Next returns the next complete msg.  If there is not a complete msg
+// buffered it reads from the io.Reader until there is one.  If the
+// parser has no io.Reader (i.e. it is being fed with Feed) then Next
+// returns nil, nil when more data is needed.  At the end of the
+// stream Next returns io.EOF (or io.ErrUnexpectedEOF if it ends in the
+// middle of a msg).  Framing errors (i.e. a msg with no Content-Length)
+// leave the stream in an unknown state so every call after one of
+// them returns the same error.
+func (p *StreamParser) Next() (*SipMsg, error) {
+	for {
+		if p.err != nil {
+			return nil, p.err
+		}
+		s, err := p.frame()
+		if err != nil {
+			p.err = err
+			return nil, err
+		}
+		if s != nil {
+			return s, nil
+		}
+		if p.r == nil {
+			return nil, nil
+		}
+		if err := p.read(); err != nil {
+			if err == io.EOF && len(p.buf) != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			p.err = err
+			return nil, err
+		}
+	}
+}
+
+// read reads the next chunk from the io.Reader into the buffer
+func (p *StreamParser) read() error {
+	if cap(p.buf)-len(p.buf) < streamReadSize {
+		n := make([]byte, len(p.buf), 2*cap(p.buf)+streamReadSize)
+		copy(n, p.buf)
+		p.buf = n
+	}
+	n, err := p.r.Read(p.buf[len(p.buf):cap(p.buf)])
+	p.buf = p.buf[0 : len(p.buf)+n]
+	if n > 0 {
+		return nil
+	}
+	if err == nil {
+		return io.ErrNoProgress
+	}
+	return err
+}
+
+// skipKeepAlives drops any CRLF keep-alives from the front of the
+// buffer.  It returns false if the buffer is only a partial keep-alive.
+func (p *StreamParser) skipKeepAlives() bool {
+	for bytes.HasPrefix(p.buf, crlf) {
+		switch {
+		case bytes.HasPrefix(p.buf, crlfCrlf):
+			p.buf = p.buf[4:]
+			if p.OnPing != nil {
+				p.OnPing()
+			}
+		case len(p.buf) < 4 && bytes.HasPrefix(crlfCrlf, p.buf):
+			// could still be the start of a ping
+			return false
+		default:
+			p.buf = p.buf[2:]
+		}
+	}
+	if len(p.buf) == 1 && p.buf[0] == '\r' {
+		return false
+	}
+	return true
+}
+
+// frame returns the msg at the front of the buffer if it is complete
+func (p *StreamParser) frame() (*SipMsg, error) {
+	if !p.skipKeepAlives() {
+		return nil, nil
+	}
+	eof := bytes.Index(p.buf, crlfCrlf)
+	if eof == -1 {
+		if len(p.buf) > p.MaxMsgSize {
+			return nil, fmt.Errorf("%w: StreamParser.Next err: no end of hdrs found within MaxMsgSize.", ErrMsgTooLarge)
+		}
+		return nil, nil
+	}
+	cl, err := getStreamContentLength(p.buf[0:eof])
+	if err != nil {
+		return nil, err
+	}
+	total := eof + 4 + cl
+	if total > p.MaxMsgSize {
+		return nil, fmt.Errorf("%w: StreamParser.Next err: msg is larger than MaxMsgSize.", ErrMsgTooLarge)
+	}
+	if len(p.buf) < total {
+		return nil, nil
+	}
+	s := ParseMsg(string(p.buf[0:total]))
+	switch {
+	case len(p.buf) == total:
+		// nothing left so the buffer can be reused from the start
+		p.buf = p.buf[0:0]
+	default:
+		p.buf = p.buf[total:]
+	}
+	return s, nil
+}
+
+// getStreamContentLength returns the value of the Content-Length (or
+// "l") hdr from the hdrs of a msg
+func getStreamContentLength(hdrs []byte) (int, error) {
+	for _, line := range bytes.Split(hdrs, crlf) {
+		sp := bytes.IndexByte(line, ':')
+		if sp == -1 {
+			continue
+		}
+		if canonicalHdr(strings.TrimSpace(string(line[0:sp]))) != SIP_HDR_CONTENT_LENGTH {
+			continue
+		}
+		cl, err := strconv.Atoi(strings.TrimSpace(string(line[sp+1:])))
+		if err != nil || cl < 0 {
+			return 0, fmt.Errorf("%w: StreamParser.Next err: invalid Content-Length: %s", ErrBadContentLength, line[sp+1:])
+		}
+		return cl, nil
+	}
+	return 0, fmt.Errorf("%w: StreamParser.Next err: no Content-Length hdr found.", ErrNoContentLength)
+}
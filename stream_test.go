@@ -0,0 +1,93 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var testStreamOptions = "OPTIONS sip:carol@chicago.com SIP/2.0\r\nVia: SIP/2.0/TCP pc33.atlanta.com;branch=z9hG4bKhjhs8ass877\r\nTo: <sip:carol@chicago.com>\r\nFrom: Alice <sip:alice@atlanta.com>;tag=1928301774\r\nCall-ID: a84b4c76e66710\r\nCSeq: 63104 OPTIONS\r\nl: 0\r\n\r\n"
+var testStreamMessage = "MESSAGE sip:user2@domain.com SIP/2.0\r\nVia: SIP/2.0/TCP user1pc.domain.com;branch=z9hG4bK776sgdkse\r\nTo: <sip:user2@domain.com>\r\nFrom: <sip:user1@domain.com>;tag=49583\r\nCall-ID: asd88asd77a@1.2.3.4\r\nCSeq: 1 MESSAGE\r\nContent-Type: text/plain\r\nContent-Length: 18\r\n\r\nWatson, come here."
+
+func TestStreamParser(t *testing.T) {
+	stream := "\r\n\r\n" + testStreamOptions + "\r\n" + testStreamMessage + testStreamOptions
+	pings := 0
+	p := NewStreamParser(iotest.OneByteReader(strings.NewReader(stream)))
+	p.OnPing = func() { pings++ }
+	methods := []string{SIP_METHOD_OPTIONS, SIP_METHOD_MESSAGE, SIP_METHOD_OPTIONS}
+	for i := range methods {
+		s, err := p.Next()
+		if err != nil {
+			t.Fatalf("[TestStreamParser] Error getting msg %d.  Received: %s", i, err.Error())
+		}
+		if s.Error != nil {
+			t.Errorf("[TestStreamParser] Error parsing msg %d.  Received: %s", i, s.Error.Error())
+		}
+		if s.StartLine.Method != methods[i] {
+			t.Errorf("[TestStreamParser] Msg %d should be a %s but received: %s", i, methods[i], s.StartLine.Method)
+		}
+		if methods[i] == SIP_METHOD_MESSAGE && s.Body != "Watson, come here." {
+			t.Errorf("[TestStreamParser] Body of the MESSAGE is wrong.  Received: %q", s.Body)
+		}
+	}
+	if pings != 1 {
+		t.Errorf("[TestStreamParser] Should have seen 1 ping but received: %d", pings)
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("[TestStreamParser] Should get io.EOF at the end of the stream.  Received: %v", err)
+	}
+}
+
+func TestStreamParserFeed(t *testing.T) {
+	p := NewStreamParser(nil)
+	p.Feed([]byte(testStreamMessage[0:60]))
+	if s, err := p.Next(); s != nil || err != nil {
+		t.Errorf("[TestStreamParserFeed] Should need more data after a partial msg.")
+	}
+	p.Feed([]byte(testStreamMessage[60 : len(testStreamMessage)-4]))
+	if s, err := p.Next(); s != nil || err != nil {
+		t.Errorf("[TestStreamParserFeed] Should need more data when the body is not complete.")
+	}
+	p.Feed([]byte(testStreamMessage[len(testStreamMessage)-4:] + "\r\n"))
+	s, err := p.Next()
+	if err != nil || s == nil {
+		t.Fatalf("[TestStreamParserFeed] Should get a msg once the body is complete.  Received err: %v", err)
+	}
+	if s.Body != "Watson, come here." {
+		t.Errorf("[TestStreamParserFeed] Body is wrong.  Received: %q", s.Body)
+	}
+	if s, err := p.Next(); s != nil || err != nil {
+		t.Errorf("[TestStreamParserFeed] Should need more data after a trailing CRLF.")
+	}
+	p.Feed([]byte(testStreamOptions))
+	s, err = p.Next()
+	if err != nil || s == nil || s.StartLine.Method != SIP_METHOD_OPTIONS {
+		t.Fatalf("[TestStreamParserFeed] The pong before the OPTIONS should be skipped.  Received err: %v", err)
+	}
+	if p.Buffered() != 0 {
+		t.Errorf("[TestStreamParserFeed] Nothing should be buffered but received: %d", p.Buffered())
+	}
+}
+
+func TestStreamParserErrors(t *testing.T) {
+	p := NewStreamParser(strings.NewReader("OPTIONS sip:carol@chicago.com SIP/2.0\r\nCSeq: 1 OPTIONS\r\n\r\n"))
+	if _, err := p.Next(); !errors.Is(err, ErrNoContentLength) {
+		t.Errorf("[TestStreamParserErrors] A msg without a Content-Length should be ErrNoContentLength.  Received: %v", err)
+	}
+	p = NewStreamParser(strings.NewReader(testStreamMessage[0:50]))
+	if _, err := p.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("[TestStreamParserErrors] A stream that ends mid msg should return io.ErrUnexpectedEOF.  Received: %v", err)
+	}
+	p = NewStreamParser(strings.NewReader(testStreamMessage))
+	p.MaxMsgSize = 100
+	if _, err := p.Next(); !errors.Is(err, ErrMsgTooLarge) {
+		t.Errorf("[TestStreamParserErrors] A msg larger than MaxMsgSize should be ErrMsgTooLarge.  Received: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strings"
+)
+
+// The checks in this file are only run when a msg is parsed with
+// ParseOptions{Strict: true}.  Each one returns the name of the rule
+// from docs/rfc3261.grammar.txt that the value does not match (or ""
+// if it does) so that the ParseError can say which rule failed.
+
+// isTokenChar returns true if c is allowed in a token
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-.!%*_+`'~", c) != -1
+}
+
+// isToken returns true if s matches the token rule
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWord returns true if s matches the word rule (used by callid)
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) && strings.IndexByte("()<>:\\\"/[]?{}", s[i]) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigits returns true if s is 1*DIGIT
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHostChars returns true if s is made up of the chars that can be
+// in a host or host:port (including an IPv6 reference)
+func isHostChars(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) && s[i] != ':' && s[i] != '[' && s[i] != ']' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCtl returns true if s has a control char other than HTAB
+func hasCtl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 0x20 && s[i] != '\t') || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// isSipVersion returns true if s matches "SIP" "/" 1*DIGIT "." 1*DIGIT
+func isSipVersion(s string) bool {
+	if len(s) < 7 || !strings.EqualFold(s[0:4], SIP_PROTO+"/") {
+		return false
+	}
+	dot := strings.IndexByte(s[4:], '.')
+	if dot == -1 {
+		return false
+	}
+	return isDigits(s[4:4+dot]) && isDigits(s[5+dot:])
+}
+
+// checkParams checks the ";" separated generic-params in s.  If
+// tokenParam is not blank the value of that param must be a token
+// and tokenRule is returned if it is not (i.e. "branch" and
+// "via-branch").
+func checkParams(s string, tokenParam string, tokenRule string) string {
+	for _, p := range splitQuoted(s, ';') {
+		p = strings.TrimSpace(p)
+		name, val, hasVal := strings.Cut(p, "=")
+		name = strings.TrimSpace(name)
+		if !isToken(name) {
+			return "generic-param"
+		}
+		if !hasVal {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if tokenParam != "" && strings.EqualFold(name, tokenParam) {
+			if !isToken(val) {
+				return tokenRule
+			}
+			continue
+		}
+		switch {
+		case val != "" && val[0] == '"':
+			if !isQuotedString(val) {
+				return "quoted-string"
+			}
+		case !isHostChars(val):
+			return "gen-value"
+		}
+	}
+	return ""
+}
+
+// checkStartLine checks the Request-Line or Status-Line
+func checkStartLine(s *StartLine, str string) string {
+	if s.Type == SIP_REQUEST {
+		parts := strings.Split(str, " ")
+		switch {
+		case len(parts) != 3:
+			return "Request-Line"
+		case !isToken(parts[0]):
+			return "Method"
+		case parts[1] == "" || hasCtl(parts[1]):
+			return "Request-URI"
+		case !isSipVersion(parts[2]):
+			return "SIP-Version"
+		}
+		return ""
+	}
+	parts := strings.SplitN(str, " ", 3)
+	switch {
+	case len(parts) != 3:
+		return "Status-Line"
+	case !isSipVersion(parts[0]):
+		return "SIP-Version"
+	case len(parts[1]) != 3 || !isDigits(parts[1]) || parts[1][0] < '1' || parts[1][0] > '6':
+		return "Status-Code"
+	case hasCtl(parts[2]):
+		return "Reason-Phrase"
+	}
+	return ""
+}
+
+// checkCallId checks the callid rule (word [ "@" word ])
+func checkCallId(str string) string {
+	left, right, at := strings.Cut(str, "@")
+	if !isWord(left) || (at && !isWord(right)) {
+		return "callid"
+	}
+	return ""
+}
+
+// checkCseq checks the CSeq rule (1*DIGIT LWS Method)
+func checkCseq(str string) string {
+	sp := strings.IndexAny(str, " \t")
+	if sp == -1 || !isDigits(str[0:sp]) || !isToken(strings.TrimLeft(str[sp:], " \t")) {
+		return "CSeq"
+	}
+	return ""
+}
+
+// checkVia checks each via-parm of a Via hdr
+func checkVia(str string) string {
+	for _, v := range splitQuoted(str, ',') {
+		v = strings.TrimSpace(v)
+		// sent-protocol is three tokens separated by SLASH (which
+		// can have whitespace around it)
+		rest := v
+		for i := 0; i < 3; i++ {
+			end := 0
+			for end < len(rest) && isTokenChar(rest[end]) {
+				end++
+			}
+			if end == 0 {
+				return "sent-protocol"
+			}
+			rest = rest[end:]
+			if i < 2 {
+				rest = strings.TrimLeft(rest, " \t")
+				if rest == "" || rest[0] != '/' {
+					return "sent-protocol"
+				}
+				rest = strings.TrimLeft(rest[1:], " \t")
+			}
+		}
+		switch {
+		case rest == "":
+			return "via-parm"
+		case rest[0] != ' ' && rest[0] != '\t':
+			return "sent-protocol"
+		}
+		sentBy, params, hasParams := strings.Cut(strings.TrimLeft(rest, " \t"), ";")
+		sentBy = strings.TrimSpace(sentBy)
+		if !isHostChars(sentBy) {
+			return "sent-by"
+		}
+		if _, port := splitSentBy(sentBy); port != "" && !isPort(port) {
+			return "sent-by"
+		}
+		if hasParams {
+			if rule := checkParams(params, "branch", "via-branch"); rule != "" {
+				return rule
+			}
+		}
+	}
+	return ""
+}
+
+// checkNameAddr checks a name-addr or addr-spec followed by params
+// (i.e. the value of a From or To hdr)
+func checkNameAddr(str string) string {
+	str = strings.TrimSpace(str)
+	rest := str
+	switch {
+	case strings.HasPrefix(str, "\""):
+		end := quotedStringEnd(str)
+		if end == -1 {
+			return "display-name"
+		}
+		rest = strings.TrimLeft(str[end+1:], " \t")
+		if !strings.HasPrefix(rest, "<") {
+			return "name-addr"
+		}
+	default:
+		lt := strings.IndexByte(str, '<')
+		if lt != -1 {
+			for _, t := range strings.Fields(str[0:lt]) {
+				if !isToken(t) {
+					return "display-name"
+				}
+			}
+			rest = str[lt:]
+		}
+	}
+	var uri, params string
+	switch {
+	case strings.HasPrefix(rest, "<"):
+		gt := strings.IndexByte(rest, '>')
+		if gt == -1 {
+			return "name-addr"
+		}
+		uri = rest[1:gt]
+		params = strings.TrimLeft(rest[gt+1:], " \t")
+		if params != "" {
+			if params[0] != ';' {
+				return "name-addr"
+			}
+			params = params[1:]
+		}
+	default:
+		uri, params, _ = strings.Cut(rest, ";")
+	}
+	if uri == "" || strings.IndexAny(uri, " \t") != -1 || hasCtl(uri) {
+		return "addr-spec"
+	}
+	if params != "" {
+		return checkParams(params, "tag", "tag-param")
+	}
+	return ""
+}
+
+// checkHdr checks the name and value of a hdr
+func checkHdr(name string, hdr string, val string) string {
+	if !isToken(name) {
+		return "header-name"
+	}
+	if hasCtl(val) {
+		return "header-value"
+	}
+	switch hdr {
+	case SIP_HDR_CALL_ID:
+		return checkCallId(val)
+	case SIP_HDR_CONTENT_LENGTH:
+		if !isDigits(val) {
+			return "Content-Length"
+		}
+	case SIP_HDR_CSEQ:
+		return checkCseq(val)
+	case SIP_HDR_EXPIRES, SIP_HDR_MIN_EXPIRES:
+		if !isDigits(val) {
+			return "delta-seconds"
+		}
+	case SIP_HDR_FROM, SIP_HDR_TO:
+		return checkNameAddr(val)
+	case SIP_HDR_MAX_FORWARDS:
+		if !isDigits(val) {
+			return "Max-Forwards"
+		}
+	case SIP_HDR_VIA:
+		return checkVia(val)
+	}
+	return ""
+}
+
+// grammarErr records a ParseError for a value that does not match
+// the rule
+func (s *SipMsg) grammarErr(kind ParseErrorKind, hdr string, rule string, val string) {
+	e := &ParseError{Header: hdr, Line: s.hdrLine, Offset: s.hdrStart, Value: val, Kind: kind, Rule: rule}
+	if kind == PARSE_ERR_START_LINE {
+		e.Line, e.Offset = 1, 0
+	}
+	e.Err = fmt.Errorf("%w: %s rule does not match: %s", ErrGrammar, rule, val)
+	s.addParseError(e)
+}
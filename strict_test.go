@@ -0,0 +1,63 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrictValid(t *testing.T) {
+	for _, m := range []string{testInviteMsg, testOkMsg} {
+		s := ParseMsgWithOptions(m, ParseOptions{Strict: true})
+		if s.Error != nil {
+			t.Errorf("[TestStrictValid] A valid msg should not have errors in strict mode.  Received: %s", s.Error.Error())
+		}
+	}
+}
+
+func TestStrictRules(t *testing.T) {
+	base := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\nTo: Bob <sip:bob@biloxi.com>\r\nFrom: \"Alice\" <sip:alice@atlanta.com>;tag=1928301774\r\nCall-ID: a84b4c76e66710@pc33.atlanta.com\r\nCSeq: 314159 INVITE\r\nMax-Forwards: 70\r\nContent-Length: 0\r\n\r\n"
+	tests := []struct {
+		old  string
+		new  string
+		rule string
+	}{
+		{"INVITE sip:bob@biloxi.com SIP/2.0", "INV(ITE sip:bob@biloxi.com SIP/2.0", "Method"},
+		{"INVITE sip:bob@biloxi.com SIP/2.0", "INVITE sip:bob@biloxi.com SIP/2", "SIP-Version"},
+		{"INVITE sip:bob@biloxi.com SIP/2.0", "INVITE sip:bob@biloxi.com SIP/2.0 x", "Request-Line"},
+		{"Via: SIP/2.0/UDP pc33", "Via: SIP/2.0/U(DP pc33", "sent-protocol"},
+		{"branch=z9hG4bK776asdhds", "branch=\"z9hG4bK776asdhds\"", "via-branch"},
+		{"To: Bob <sip:bob@biloxi.com>", "To: Bob <sip:bob@biloxi.com", "name-addr"},
+		{"\"Alice\"", "\"Alice", "display-name"},
+		{"tag=1928301774", "tag=19283@01774", "tag-param"},
+		{"Call-ID: a84b4c76e66710@pc33.atlanta.com", "Call-ID: a84b4c76 e66710", "callid"},
+		{"CSeq: 314159 INVITE", "CSeq: 31a4159 INVITE", "CSeq"},
+		{"Max-Forwards: 70", "Max-Forwards: seventy", "Max-Forwards"},
+		{"Content-Length: 0", "Content Length: 0", "header-name"},
+	}
+	for _, tt := range tests {
+		m := strings.Replace(base, tt.old, tt.new, 1)
+		s := ParseMsg(m)
+		if s.Error != nil && tt.rule != "header-name" {
+			t.Errorf("[TestStrictRules] %q should parse without strict mode.  Received: %s", tt.new, s.Error.Error())
+		}
+		s = ParseMsgWithOptions(m, ParseOptions{Strict: true})
+		if len(s.Errors) == 0 {
+			t.Errorf("[TestStrictRules] %q should be an error in strict mode.", tt.new)
+			continue
+		}
+		e := s.Errors[0]
+		if e.Rule != tt.rule || !errors.Is(e, ErrGrammar) {
+			t.Errorf("[TestStrictRules] %q should fail the %q rule.  Received: %s", tt.new, tt.rule, e.Error())
+		}
+	}
+	s := ParseMsgWithOptions("SIP/2.0 2000 OK\r\nContent-Length: 0\r\n\r\n", ParseOptions{Strict: true})
+	if len(s.Errors) != 1 || s.Errors[0].Rule != "Status-Code" || s.Errors[0].Line != 1 {
+		t.Errorf("[TestStrictRules] A 4 digit status code should fail the Status-Code rule.")
+	}
+}
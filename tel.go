@@ -0,0 +1,238 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// telVisualSeparators are the chars that can be in a tel number
+	// just to make it easier to read (RFC 3966 5.1.1)
+	telVisualSeparators = "-.()"
+)
+
+// TelURI is a parsed RFC 3966 tel uri (i.e.
+// tel:+1-212-555-0100;ext=123).  It is in URI.Tel when the scheme of
+// a URI is tel.
+// The fields are as follows:
+// -- Number is the number as received (with any visual separators)
+// -- Global is true for a global number (one that starts with "+")
+// -- PhoneContext is the phone-context param (which a local number
+// is supposed to have)
+// -- Ext is the ext (extension) param
+// -- Isub is the isub (ISDN subaddress) param
+// -- Npdi is true if the npdi (number portability dip indicator)
+// param is present (RFC 4694)
+// -- Rn is the rn (routing number) param (RFC 4694)
+// -- Cic is the cic (carrier identification code) param (RFC 4694)
+// -- Params are any other params
+type TelURI struct {
+	Number       string
+	Global       bool
+	PhoneContext string
+	Ext          string
+	Isub         string
+	Npdi         bool
+	Rn           string
+	Cic          string
+	Params       []*Param
+}
+
+// ParseTelURI parses a tel uri with or without the "tel:" scheme
+func ParseTelURI(s string) (*TelURI, error) {
+	if len(s) > 4 && strings.EqualFold(s[0:4], TEL_SCHEME+":") {
+		s = s[4:]
+	}
+	t := &TelURI{}
+	semi := strings.IndexByte(s, ';')
+	if semi == -1 {
+		semi = len(s)
+	}
+	t.Number = s[0:semi]
+	if err := t.checkNumber(); err != nil {
+		return nil, err
+	}
+	params, err := getUriParams(nil, s[semi:], ';')
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		switch strings.ToLower(p.Param) {
+		case "phone-context":
+			t.PhoneContext = p.Val
+		case "ext":
+			t.Ext = p.Val
+		case "isub":
+			t.Isub = p.Val
+		case "npdi":
+			t.Npdi = true
+		case "rn":
+			t.Rn = p.Val
+		case "cic":
+			t.Cic = p.Val
+		default:
+			t.Params = append(t.Params, p)
+		}
+	}
+	return t, nil
+}
+
+// checkNumber makes sure .Number is a global-number-digits or a
+// local-number-digits and sets .Global
+func (t *TelURI) checkNumber() error {
+	n := t.Number
+	if strings.HasPrefix(n, "+") {
+		t.Global = true
+		n = n[1:]
+	}
+	digits := 0
+	for i := 0; i < len(n); i++ {
+		switch {
+		case n[i] >= '0' && n[i] <= '9':
+			digits++
+		case !t.Global && (unhex(n[i]) != -1 || n[i] == '*' || n[i] == '#'):
+			digits++
+		case strings.IndexByte(telVisualSeparators, n[i]) != -1:
+		default:
+			return fmt.Errorf("%w: ParseTelURI err: invalid char in number: %s", ErrBadURI, t.Number)
+		}
+	}
+	if digits == 0 {
+		return fmt.Errorf("%w: ParseTelURI err: no digits in number: %s", ErrBadURI, t.Number)
+	}
+	return nil
+}
+
+// Digits returns the number without any visual separators (i.e.
+// "+12125550100" for "+1-212-555-0100")
+func (t *TelURI) Digits() string {
+	if strings.IndexAny(t.Number, telVisualSeparators) == -1 {
+		return t.Number
+	}
+	n := make([]byte, 0, len(t.Number))
+	for i := 0; i < len(t.Number); i++ {
+		if strings.IndexByte(telVisualSeparators, t.Number[i]) == -1 {
+			n = append(n, t.Number[i])
+		}
+	}
+	return string(n)
+}
+
+// params returns all of the params of the uri in the order RFC 3966
+// 5.1.5 asks for (ext or isub first and then the phone-context)
+func (t *TelURI) params() []*Param {
+	var p []*Param
+	if t.Ext != "" {
+		p = append(p, &Param{Param: "ext", Val: t.Ext})
+	}
+	if t.Isub != "" {
+		p = append(p, &Param{Param: "isub", Val: t.Isub})
+	}
+	if t.PhoneContext != "" {
+		p = append(p, &Param{Param: "phone-context", Val: t.PhoneContext})
+	}
+	if t.Rn != "" {
+		p = append(p, &Param{Param: "rn", Val: t.Rn})
+	}
+	if t.Cic != "" {
+		p = append(p, &Param{Param: "cic", Val: t.Cic})
+	}
+	if t.Npdi {
+		p = append(p, &Param{Param: "npdi"})
+	}
+	return append(p, t.Params...)
+}
+
+// subscriber returns the telephone-subscriber (the number and the
+// params) without the scheme
+func (t *TelURI) subscriber() string {
+	return t.Number + writeUriParams(t.params(), ";", uriParamUnreserved)
+}
+
+// String returns the uri rendered from its parsed fields
+func (t *TelURI) String() string {
+	return TEL_SCHEME + ":" + t.subscriber()
+}
+
+// Equal returns true if t and o are the same number as defined by
+// RFC 3966 4 (visual separators are ignored and the params can be in
+// any order)
+func (t *TelURI) Equal(o *TelURI) bool {
+	if t == nil || o == nil {
+		return t == o
+	}
+	if t.Global != o.Global || !strings.EqualFold(t.Digits(), o.Digits()) {
+		return false
+	}
+	if !strings.EqualFold(t.PhoneContext, o.PhoneContext) || t.Ext != o.Ext || t.Isub != o.Isub {
+		return false
+	}
+	if t.Npdi != o.Npdi || t.Rn != o.Rn || t.Cic != o.Cic || len(t.Params) != len(o.Params) {
+		return false
+	}
+	for i := range t.Params {
+		if !hasUriHeader(o.Params, t.Params[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// clone returns a deep copy of the uri
+func (t *TelURI) clone() *TelURI {
+	if t == nil {
+		return nil
+	}
+	n := *t
+	n.Params = cloneParams(t.Params)
+	return &n
+}
+
+// parseUriTel parses the rest of a tel uri into .Tel
+func parseUriTel(u *URI) uriStateFn {
+	u.Tel, u.Error = ParseTelURI(u.rest)
+	if u.Error != nil {
+		return nil
+	}
+	u.User = u.Tel.Number
+	u.UriParams = append(u.UriParams, u.Tel.params()...)
+	u.rest = ""
+	return nil
+}
+
+// ToTel returns a tel uri for the uri.  A tel uri is returned as a
+// copy and a sip or sips uri has to have the user=phone param (RFC
+// 3261 19.1.6) in which case the user part is used for the number.
+// nil is returned if the uri can not be converted.
+func (u *URI) ToTel() *URI {
+	switch {
+	case u.Tel != nil:
+		return u.clone()
+	case (u.Scheme == SIP_SCHEME || u.Scheme == SIPS_SCHEME) && u.Param("user") != nil && strings.EqualFold(u.Param("user").Val, "phone"):
+		t := ParseURI(TEL_SCHEME + ":" + u.User + writeUriParams(u.UserParams, ";", uriParamUnreserved))
+		if t.Error != nil {
+			return nil
+		}
+		return t
+	}
+	return nil
+}
+
+// ToSip returns a sip uri with user=phone for a tel uri and the host
+// (i.e. the gateway) as RFC 3261 19.1.6 describes.  nil is returned
+// if the uri is not a tel uri.
+func (u *URI) ToSip(host string) *URI {
+	if u.Tel == nil {
+		return nil
+	}
+	s := ParseURI(SIP_SCHEME + ":" + u.Tel.subscriber() + "@" + host + ";user=phone")
+	if s.Error != nil {
+		return nil
+	}
+	return s
+}
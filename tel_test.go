@@ -0,0 +1,72 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestTelURI(t *testing.T) {
+	u := ParseURI("tel:+1-212-555-0100;phone-context=example.com;ext=123")
+	if u.Error != nil {
+		t.Fatalf("[TestTelURI] Error parsing tel uri.  Received: %s", u.Error.Error())
+	}
+	if u.Tel == nil || !u.Tel.Global || u.Tel.Number != "+1-212-555-0100" || u.Tel.Digits() != "+12125550100" {
+		t.Fatalf("[TestTelURI] Global number was not parsed correctly.")
+	}
+	if u.Tel.PhoneContext != "example.com" || u.Tel.Ext != "123" || u.Host != "" || u.User != "+1-212-555-0100" {
+		t.Errorf("[TestTelURI] Params were not parsed correctly.")
+	}
+	if u.String() != "tel:+1-212-555-0100;ext=123;phone-context=example.com" {
+		t.Errorf("[TestTelURI] Tel uri did not render correctly.  Received: %q", u.String())
+	}
+	u = ParseURI("tel:7042;phone-context=cs.columbia.edu;isub=1a2")
+	if u.Error != nil || u.Tel.Global || u.Tel.PhoneContext != "cs.columbia.edu" || u.Tel.Isub != "1a2" {
+		t.Errorf("[TestTelURI] Local number was not parsed correctly.")
+	}
+	u = ParseURI("tel:+1-800-555-1212;npdi;rn=+1-215-555-0000;cic=+1-6789;foo=bar")
+	if u.Error != nil || !u.Tel.Npdi || u.Tel.Rn != "+1-215-555-0000" || u.Tel.Cic != "+1-6789" || len(u.Tel.Params) != 1 {
+		t.Errorf("[TestTelURI] Number portability params were not parsed correctly.")
+	}
+	for _, bad := range []string{"tel:+1-212-CALL", "tel:;ext=1", "tel:+"} {
+		if ParseURI(bad).Error == nil {
+			t.Errorf("[TestTelURI] %q should be an error.", bad)
+		}
+	}
+	if !ParseURI("tel:+1-212-555-0100;ext=1;phone-context=x").Equal(ParseURI("tel:+1.212.555.0100;phone-context=X;ext=1")) {
+		t.Errorf("[TestTelURI] Visual separators and param order should not matter for Equal.")
+	}
+	if ParseURI("tel:+12125550100").Equal(ParseURI("tel:+12125550101")) {
+		t.Errorf("[TestTelURI] Different numbers should not be equal.")
+	}
+}
+
+func TestTelURIFrom(t *testing.T) {
+	f := getFrom("tel:+1-212-555-0100;tag=887s")
+	if f.Error != nil || f.Tag != "887s" || f.URI.Tel == nil || len(f.URI.Tel.Params) != 0 {
+		t.Errorf("[TestTelURIFrom] The params of a tel uri without bracks belong to the hdr.")
+	}
+	if f.String() != "<tel:+1-212-555-0100>;tag=887s" {
+		t.Errorf("[TestTelURIFrom] Unexpected from hdr.  Received: %q", f.String())
+	}
+}
+
+func TestTelURIConvert(t *testing.T) {
+	s := ParseURI("tel:+1-212-555-0100;ext=123").ToSip("gateway.com")
+	if s == nil || s.String() != "sip:+1-212-555-0100;ext=123@gateway.com;user=phone" {
+		t.Fatalf("[TestTelURIConvert] Error converting to a sip uri.  Received: %v", s)
+	}
+	tel := s.ToTel()
+	if tel == nil || tel.Tel == nil || tel.String() != "tel:+1-212-555-0100;ext=123" {
+		t.Fatalf("[TestTelURIConvert] Error converting back to a tel uri.  Received: %v", tel)
+	}
+	if ParseURI("sip:alice@atlanta.com").ToTel() != nil {
+		t.Errorf("[TestTelURIConvert] A sip uri without user=phone can not be converted.")
+	}
+	if ParseURI("sip:alice@atlanta.com").ToSip("gateway.com") != nil {
+		t.Errorf("[TestTelURIConvert] Only a tel uri can be converted to a sip uri.")
+	}
+}
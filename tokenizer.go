@@ -0,0 +1,142 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"strings"
+)
+
+// The functions in this file are the shared tokenizer for hdr values.
+// They know about the parts of the RFC 3261 25.1 grammar that a plain
+// strings.Split does not:
+// -- a quoted-string (i.e. "Smith, John" or realm="a,b") is one token
+// no matter what is inside of it
+// -- a quoted-pair (i.e. \" inside of a quoted-string) does not end
+// the quoted-string
+// -- a uri in angle bracks (i.e. <sip:a@b;lr>) is one token
+// -- LWS (spaces and tabs) around a token is not part of it
+
+// trimLWS removes the LWS from both ends of s
+func trimLWS(s string) string {
+	return strings.Trim(s, " \t")
+}
+
+// quotedStringEnd returns the index of the closing DQUOTE of the
+// quoted-string that starts at s[0] or -1 if it is not a valid one
+func quotedStringEnd(s string) int {
+	if s == "" || s[0] != '"' {
+		return -1
+	}
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			// quoted-pair
+			if i+1 == len(s) || s[i+1] == '\r' || s[i+1] == '\n' || s[i+1] > 0x7f {
+				return -1
+			}
+			i++
+		case s[i] == '"':
+			return i
+		case (s[i] < 0x20 && s[i] != '\t') || s[i] == 0x7f:
+			return -1
+		}
+	}
+	return -1
+}
+
+// isQuotedString returns true if s is exactly one quoted-string
+func isQuotedString(s string) bool {
+	return quotedStringEnd(s) == len(s)-1
+}
+
+// unquoteStr returns the value of a quoted-string (without the
+// quotes and with any quoted-pairs decoded) or s as is if it is not
+// quoted
+func unquoteStr(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+	n := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		n = append(n, s[i])
+	}
+	return string(n)
+}
+
+// indexUnquoted returns the index of the first c in s that is not
+// inside of a quoted-string or -1 if there isn't one
+func indexUnquoted(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitQuoted splits s on sep when sep is not inside of a
+// quoted-string or angle bracks.  The parts are returned as is (with
+// any LWS and empty parts) so that they can still be checked against
+// the grammar.
+func splitQuoted(s string, sep byte) []string {
+	parts := make([]string, 0, strings.Count(s, string(sep))+1)
+	quoted, brack := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '<' && sep != '<':
+			brack = true
+		case s[i] == '>' && sep != '>':
+			brack = false
+		case !brack && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitList splits s on sep (just like splitQuoted) and returns the
+// parts without LWS.  Empty parts (i.e. from "a,,b") are dropped as
+// RFC 3261 7.3.1 allows.
+func splitList(s string, sep byte) []string {
+	parts := splitQuoted(s, sep)
+	list := parts[0:0]
+	for i := range parts {
+		if p := trimLWS(parts[i]); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// appendList appends the comma separated values in str to l so that
+// every instance of a list hdr ends up in the same slice.  An empty
+// first instance still gives a non nil (empty) slice.
+func appendList(l []string, str string) []string {
+	if l == nil {
+		return splitList(str, ',')
+	}
+	return append(l, splitList(str, ',')...)
+}
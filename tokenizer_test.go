@@ -0,0 +1,97 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		val   string
+		sep   byte
+		parts []string
+	}{
+		{`"Smith, John" <sip:j@x>, <sip:k@y;a=b,c>`, ',', []string{`"Smith, John" <sip:j@x>`, `<sip:k@y;a=b,c>`}},
+		{`realm="a,b", nonce="x\",y" ,, qop=auth`, ',', []string{`realm="a,b"`, `nonce="x\",y"`, `qop=auth`}},
+		{"SIP ;cause=200 ;\ttext=\"a;b\"", ';', []string{"SIP", "cause=200", `text="a;b"`}},
+		{" ", ',', []string{}},
+	}
+	for _, tt := range tests {
+		parts := splitList(tt.val, tt.sep)
+		if len(parts) != len(tt.parts) {
+			t.Errorf("[TestSplitList] Expected %d parts for %q but received: %q", len(tt.parts), tt.val, parts)
+			continue
+		}
+		for i := range parts {
+			if parts[i] != tt.parts[i] {
+				t.Errorf("[TestSplitList] Part %d of %q should be %q but received: %q", i, tt.val, tt.parts[i], parts[i])
+			}
+		}
+	}
+	if p := splitQuoted("a;;b", ';'); len(p) != 3 || p[1] != "" {
+		t.Errorf("[TestSplitList] splitQuoted should keep empty parts.  Received: %q", p)
+	}
+}
+
+func TestUnquoteStr(t *testing.T) {
+	tests := map[string]string{
+		`"abc"`:         "abc",
+		`"a \"b\" \\c"`: `a "b" \c`,
+		`abc`:           "abc",
+		`"`:             `"`,
+	}
+	for in, out := range tests {
+		if unquoteStr(in) != out {
+			t.Errorf("[TestUnquoteStr] %q should be %q but received: %q", in, out, unquoteStr(in))
+		}
+	}
+	if unquoteStr(quoteStr(`a "b" \c`)) != `a "b" \c` {
+		t.Errorf("[TestUnquoteStr] unquoteStr should undo quoteStr.")
+	}
+}
+
+func TestTokenizedHdrs(t *testing.T) {
+	f := getFrom(`"Smith, \"JJ\" <John>" <sip:j@x.com>;tag=1;foo="a;b"`)
+	if f.Error != nil || f.Name != `Smith, "JJ" <John>` || f.URI.Host != "x.com" || f.Tag != "1" {
+		t.Errorf("[TestTokenizedHdrs] From with a quoted name was not parsed correctly.  Received: %q", f.Name)
+	}
+	if len(f.Params) != 1 || f.Params[0].Val != `"a;b"` {
+		t.Errorf("[TestTokenizedHdrs] A semicolon in a quoted param should not split it.")
+	}
+	if f.String() != `"Smith, \"JJ\" <John>" <sip:j@x.com>;foo="a;b";tag=1` {
+		t.Errorf("[TestTokenizedHdrs] Unexpected from.  Received: %q", f.String())
+	}
+	if name, _ := getName("Bob   Smith <sip:b@x.com>"); name != "Bob Smith" {
+		t.Errorf("[TestTokenizedHdrs] LWS in a token display name should be collapsed.  Received: %q", name)
+	}
+	a := &Authorization{Val: `Digest realm="a,b", nonce="x\"y", qop=auth`}
+	if err := a.parse(); err != nil || len(a.Params) != 3 {
+		t.Fatalf("[TestTokenizedHdrs] Authorization with quoted commas was not parsed correctly.")
+	}
+	if a.GetParam("realm").Val != "a,b" || a.GetParam("nonce").Val != `x"y` || a.GetParam("qop").Val != "auth" {
+		t.Errorf("[TestTokenizedHdrs] Authorization params were not unquoted correctly.")
+	}
+	r := &Reason{Val: `SIP;cause=480;text="Busy; \"try\" later"`}
+	r.parse()
+	if r.Proto != "SIP" || r.Cause != "480" || r.Text != `Busy; "try" later` {
+		t.Errorf("[TestTokenizedHdrs] Reason with a quoted text was not parsed correctly.  Received: %q", r.Text)
+	}
+	w := &Warning{Val: `399 host "a \"b\""`}
+	if w.parse() != nil || w.Text != `a "b"` {
+		t.Errorf("[TestTokenizedHdrs] Warning text was not unquoted correctly.  Received: %q", w.Text)
+	}
+	s := &SipMsg{}
+	s.parseRoute(`<sip:p1.example.com;lr>, "a,b" <sip:p2.example.com;lr>`)
+	if len(s.Route) != 2 || s.Route[1].Host != "p2.example.com" {
+		t.Errorf("[TestTokenizedHdrs] Route with a quoted comma was not parsed correctly.")
+	}
+	p := &PAssertedId{Val: `"Doe, <J>" <sip:j@x.com>;foo=bar`}
+	p.parse()
+	if p.Error != nil || p.Name != "Doe, <J>" || p.URI.Host != "x.com" || len(p.Params) != 1 {
+		t.Errorf("[TestTokenizedHdrs] P-Asserted-Identity with a quoted name was not parsed correctly.")
+	}
+}
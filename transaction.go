@@ -0,0 +1,434 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The RFC 3261 17 transaction layer is made up of:
+// -- ClientTransaction (clienttxn.go) for the INVITE (17.1.1) and
+// non-INVITE (17.1.2) client transactions
+// -- ServerTransaction (servertxn.go) for the INVITE (17.2.1) and
+// non-INVITE (17.2.2) server transactions
+// -- TxnTable (this file) which finds the transaction that a msg
+// from the transport belongs to (17.1.3 and 17.2.3)
+// The transactions do no I/O of their own.  Msgs are sent with
+// TxnConfig.Send and the timers run on TxnConfig.Clock so that a
+// test can move the time along without sleeping.
+
+const (
+	// SIP_T1 is the RTT estimate (RFC 3261 17.1.1.1)
+	SIP_T1 = 500 * time.Millisecond
+	// SIP_T2 is the max retransmit interval for non-INVITE requests
+	// and INVITE responses
+	SIP_T2 = 4 * time.Second
+	// SIP_T4 is the max time a msg will remain in the network
+	SIP_T4 = 5 * time.Second
+	// SIP_TIMER_D is how long an INVITE client transaction absorbs
+	// retransmissions of a final response on an unreliable transport
+	SIP_TIMER_D = 32 * time.Second
+	// SIP_TIMER_TRYING is how long an INVITE server transaction waits
+	// for the TU to respond before it sends a 100 Trying (17.2.1)
+	SIP_TIMER_TRYING = 200 * time.Millisecond
+)
+
+// TxnState is the state of a transaction
+type TxnState int
+
+const (
+	TXN_STATE_CALLING TxnState = iota
+	TXN_STATE_TRYING
+	TXN_STATE_PROCEEDING
+	TXN_STATE_COMPLETED
+	TXN_STATE_CONFIRMED
+	TXN_STATE_TERMINATED
+)
+
+// txnStates holds the names of the TxnState's
+var txnStates = [...]string{
+	TXN_STATE_CALLING:    "Calling",
+	TXN_STATE_TRYING:     "Trying",
+	TXN_STATE_PROCEEDING: "Proceeding",
+	TXN_STATE_COMPLETED:  "Completed",
+	TXN_STATE_CONFIRMED:  "Confirmed",
+	TXN_STATE_TERMINATED: "Terminated",
+}
+
+// String returns the name of the state
+func (s TxnState) String() string {
+	if s < 0 || int(s) >= len(txnStates) {
+		return "Unknown"
+	}
+	return txnStates[s]
+}
+
+// Timer is a timer started by a Clock
+type Timer interface {
+	// Stop stops the timer and returns false if it already fired
+	Stop() bool
+}
+
+// Clock is the time source of the transactions.  The default uses
+// the time package.  A test can use a Clock that only fires its
+// timers when the test moves it along.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// AfterFunc calls f (in its own goroutine or not) once d has
+	// passed.  f may even be called before AfterFunc returns (i.e.
+	// by a test Clock for a d that has already passed).
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// realClock is the Clock that uses the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// TxnConfig is the config of a transaction
+// The fields are as follows:
+// -- Clock runs the timers (the time package if nil)
+// -- T1, T2 and T4 are the RFC 3261 timer values (SIP_T1, SIP_T2 and
+// SIP_T4 if 0)
+// -- TimerC is the proxy INVITE timer (RFC 3261 16.6 step 11).  If it
+// is not 0 a client INVITE transaction calls OnTimerC when it fires.
+// -- Reliable is true if the transport is reliable (i.e. TCP) in
+// which case nothing is retransmitted and the timers that absorb
+// retransmissions (D, I, J and K) are 0
+// -- Send sends a msg to the transport.  It is called with the
+// transaction locked so it must not call back into it.
+type TxnConfig struct {
+	Clock    Clock
+	T1       time.Duration
+	T2       time.Duration
+	T4       time.Duration
+	TimerC   time.Duration
+	Reliable bool
+	Send     func(msg *SipMsg) error
+}
+
+// withDefaults returns a copy of the config with the defaults filled
+// in
+func (c *TxnConfig) withDefaults() TxnConfig {
+	n := TxnConfig{}
+	if c != nil {
+		n = *c
+	}
+	if n.Clock == nil {
+		n.Clock = realClock{}
+	}
+	if n.T1 == 0 {
+		n.T1 = SIP_T1
+	}
+	if n.T2 == 0 {
+		n.T2 = SIP_T2
+	}
+	if n.T4 == 0 {
+		n.T4 = SIP_T4
+	}
+	return n
+}
+
+// unreliable returns d for an unreliable transport and 0 for a
+// reliable one
+func (c *TxnConfig) unreliable(d time.Duration) time.Duration {
+	if c.Reliable {
+		return 0
+	}
+	return d
+}
+
+// txnTimer is a running timer of a transaction.  armed is set once
+// the Clock has returned it.
+type txnTimer struct {
+	Timer
+	armed atomic.Bool
+}
+
+// txn is what the client and server transactions have in common
+type txn struct {
+	cfg    TxnConfig
+	mu     sync.Mutex
+	key    string
+	state  TxnState
+	timers map[string]*txnTimer
+	// onDone is called once the transaction is terminated (i.e. to
+	// remove it from a TxnTable)
+	onDone func()
+}
+
+// Key returns the key that the transaction is matched by
+func (t *txn) Key() string {
+	return t.key
+}
+
+// State returns the state of the transaction
+func (t *txn) State() TxnState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// startTimer starts the named timer (i.e. "A").  When it fires fire
+// is called with t.mu held and the funcs it returns are called once
+// it is released.  t.mu must be held.
+func (t *txn) startTimer(name string, d time.Duration, fire func() []func()) {
+	t.stopTimer(name)
+	tm := new(txnTimer)
+	run := func() {
+		t.mu.Lock()
+		if t.timers[name] != tm {
+			// stopped (or restarted) after it was due
+			t.mu.Unlock()
+			return
+		}
+		delete(t.timers, name)
+		after := fire()
+		t.mu.Unlock()
+		runAll(after)
+	}
+	tm.Timer = t.cfg.Clock.AfterFunc(d, func() {
+		if !tm.armed.Load() {
+			// called before AfterFunc returned, maybe by the
+			// goroutine that holds t.mu
+			go run()
+			return
+		}
+		run()
+	})
+	tm.armed.Store(true)
+	t.timers[name] = tm
+}
+
+// stopTimer stops the named timer.  t.mu must be held.
+func (t *txn) stopTimer(name string) {
+	if tm := t.timers[name]; tm != nil {
+		tm.Stop()
+		delete(t.timers, name)
+	}
+}
+
+// terminate moves the transaction to the Terminated state and stops
+// all of its timers.  It returns the funcs to call once t.mu is
+// released.  t.mu must be held.
+func (t *txn) terminate(onTerminated func()) []func() {
+	if t.state == TXN_STATE_TERMINATED {
+		return nil
+	}
+	t.state = TXN_STATE_TERMINATED
+	for name := range t.timers {
+		t.stopTimer(name)
+	}
+	return []func(){onTerminated, t.onDone}
+}
+
+// runAll calls each of the funcs that is not nil
+func runAll(fns []func()) {
+	for _, f := range fns {
+		if f != nil {
+			f()
+		}
+	}
+}
+
+// isRFC3261Branch returns true if the branch starts with the magic
+// cookie (i.e. it was made by an RFC 3261 element and is unique)
+func isRFC3261Branch(branch string) bool {
+	return strings.HasPrefix(branch, SIP_BRANCH_MAGIC_COOKIE)
+}
+
+// topVia returns the top Via of the msg or nil if there isn't one
+func topVia(msg *SipMsg) *Via {
+	if via := msg.GetVia(); len(via) != 0 {
+		return via[0]
+	}
+	return nil
+}
+
+// ClientTxnKey returns the key of the client transaction that a
+// response belongs to (or that a request creates): the branch of the
+// top Via and the CSeq method (RFC 3261 17.1.3)
+func ClientTxnKey(msg *SipMsg) (string, error) {
+	via, cseq := topVia(msg), msg.GetCseq()
+	if via == nil || via.Branch == "" || cseq == nil || cseq.Method == "" {
+		return "", fmt.Errorf("%w: ClientTxnKey err: no Via branch or CSeq method", ErrTransaction)
+	}
+	return via.Branch + "|" + cseq.Method, nil
+}
+
+// serverTxnKey returns the key of the server transaction for the
+// request as if its method was method.  With an RFC 3261 branch it
+// is the branch, sent-by and method (RFC 3261 17.2.3).  Otherwise
+// (RFC 2543) it is the Request-URI, From tag, Call-ID, CSeq and top
+// Via.  The To tag of an RFC 2543 request is checked separately
+// since the ACK has the tag of the response.
+func serverTxnKey(req *SipMsg, method string) (string, error) {
+	via, cseq := topVia(req), req.GetCseq()
+	if via == nil || cseq == nil || req.StartLine == nil || req.StartLine.URI == nil {
+		return "", fmt.Errorf("%w: ServerTxnKey err: no Via, CSeq or Request-URI", ErrTransaction)
+	}
+	if method == SIP_METHOD_ACK {
+		method = SIP_METHOD_INVITE
+	}
+	if isRFC3261Branch(via.Branch) {
+		return via.Branch + "|" + strings.ToLower(via.SentBy) + "|" + method, nil
+	}
+	from := req.GetFrom()
+	if from == nil {
+		return "", fmt.Errorf("%w: ServerTxnKey err: no From", ErrTransaction)
+	}
+	return "2543|" + req.StartLine.URI.String() + "|" + from.Tag + "|" + req.CallId + "|" + cseq.Digit + "|" + method + "|" + via.String(), nil
+}
+
+// ServerTxnKey returns the key of the server transaction that a
+// request belongs to (or creates).  An ACK belongs to the INVITE
+// transaction that it acknowledges.
+func ServerTxnKey(req *SipMsg) (string, error) {
+	if req.StartLine == nil {
+		return "", fmt.Errorf("%w: ServerTxnKey err: no Request-Line", ErrTransaction)
+	}
+	return serverTxnKey(req, req.StartLine.Method)
+}
+
+// toTag returns the To tag of the msg or "" if there isn't one
+func toTag(msg *SipMsg) string {
+	if to := msg.GetTo(); to != nil {
+		return to.Tag
+	}
+	return ""
+}
+
+// TxnTable holds the transactions of a transaction layer and finds
+// the one that a msg from the transport belongs to.  A transaction
+// is removed once it is terminated.  It is safe for concurrent use.
+type TxnTable struct {
+	mu      sync.Mutex
+	clients map[string]*ClientTransaction
+	servers map[string]*ServerTransaction
+}
+
+// NewTxnTable returns an empty *TxnTable
+func NewTxnTable() *TxnTable {
+	return &TxnTable{clients: make(map[string]*ClientTransaction), servers: make(map[string]*ServerTransaction)}
+}
+
+// NewClient returns a new client transaction for the request that is
+// in the table until it terminates.  It still has to be started.
+func (t *TxnTable) NewClient(req *SipMsg, cfg *TxnConfig) (*ClientTransaction, error) {
+	tx, err := NewClientTransaction(req, cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.clients[tx.key] != nil {
+		return nil, fmt.Errorf("%w: NewClient err: transaction exists: %s", ErrTransaction, tx.key)
+	}
+	t.clients[tx.key] = tx
+	tx.onDone = func() { t.remove(tx.key, tx, nil) }
+	return tx, nil
+}
+
+// NewServer returns a new server transaction for the request that is
+// in the table until it terminates.  It still has to be started.
+func (t *TxnTable) NewServer(req *SipMsg, cfg *TxnConfig) (*ServerTransaction, error) {
+	tx, err := NewServerTransaction(req, cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.servers[tx.key] != nil {
+		return nil, fmt.Errorf("%w: NewServer err: transaction exists: %s", ErrTransaction, tx.key)
+	}
+	t.servers[tx.key] = tx
+	tx.onDone = func() { t.remove(tx.key, nil, tx) }
+	return tx, nil
+}
+
+// remove removes a transaction from the table (if it is still the
+// one for the key)
+func (t *TxnTable) remove(key string, c *ClientTransaction, s *ServerTransaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c != nil && t.clients[key] == c {
+		delete(t.clients, key)
+	}
+	if s != nil && t.servers[key] == s {
+		delete(t.servers, key)
+	}
+}
+
+// Len returns the number of transactions in the table
+func (t *TxnTable) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.clients) + len(t.servers)
+}
+
+// MatchResponse returns the client transaction that the response
+// belongs to or nil if there isn't one
+func (t *TxnTable) MatchResponse(resp *SipMsg) *ClientTransaction {
+	key, err := ClientTxnKey(resp)
+	if err != nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clients[key]
+}
+
+// MatchRequest returns the server transaction that the request (a
+// retransmission or an ACK for a non-2xx response) belongs to or nil
+// if there isn't one
+func (t *TxnTable) MatchRequest(req *SipMsg) *ServerTransaction {
+	key, err := ServerTxnKey(req)
+	if err != nil {
+		return nil
+	}
+	t.mu.Lock()
+	tx := t.servers[key]
+	t.mu.Unlock()
+	if tx == nil || !tx.rfc2543 {
+		return tx
+	}
+	if req.StartLine.Method == SIP_METHOD_ACK {
+		if toTag(req) != tx.responseToTag() {
+			return nil
+		}
+	} else if toTag(req) != toTag(tx.Request) {
+		return nil
+	}
+	return tx
+}
+
+// MatchCancel returns the INVITE server transaction that a CANCEL is
+// for (RFC 3261 9.2) or nil if there isn't one.  The CANCEL itself
+// has its own (non-INVITE) server transaction.
+func (t *TxnTable) MatchCancel(cancel *SipMsg) *ServerTransaction {
+	key, err := serverTxnKey(cancel, SIP_METHOD_INVITE)
+	if err != nil {
+		return nil
+	}
+	t.mu.Lock()
+	tx := t.servers[key]
+	t.mu.Unlock()
+	if tx != nil && tx.rfc2543 && toTag(cancel) != toTag(tx.Request) {
+		return nil
+	}
+	return tx
+}
@@ -0,0 +1,262 @@
+// Copyright 2011, Shelby Ramsey.   All rights reserved.
+// Use of this code is governed by a BSD license that can be
+// found in the LICENSE.txt file.
+
+package sipparser
+
+// Imports from the go standard library
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock that only fires its timers when Advance is
+// called
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*testTimer
+}
+
+type testTimer struct {
+	c    *testClock
+	at   time.Time
+	f    func()
+	done bool
+}
+
+func (t *testTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	stopped := !t.done
+	t.done = true
+	return stopped
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Unix(0, 0)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &testTimer{c: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock along by d firing the timers that are due
+// in order
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		var next *testTimer
+		for _, t := range c.timers {
+			if !t.done && !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		c.now, next.done = next.at, true
+		c.mu.Unlock()
+		next.f()
+		c.mu.Lock()
+	}
+}
+
+// testTransport records the msgs that are sent
+type testTransport struct {
+	sent []*SipMsg
+	err  error
+}
+
+func (tt *testTransport) send(msg *SipMsg) error {
+	if tt.err != nil {
+		return tt.err
+	}
+	tt.sent = append(tt.sent, msg)
+	return nil
+}
+
+// count returns how many of the sent msgs have the method (for a
+// request) or status code (for a response)
+func (tt *testTransport) count(kind string) int {
+	n := 0
+	for _, m := range tt.sent {
+		if m.StartLine.Method == kind || m.StartLine.Resp == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func testTxnConfig(c *testClock, tt *testTransport) *TxnConfig {
+	return &TxnConfig{Clock: c, Send: tt.send}
+}
+
+func TestTxnKeys(t *testing.T) {
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	ck, err := ClientTxnKey(inv)
+	if err != nil || ck != inv.Via[0].Branch+"|INVITE" {
+		t.Errorf("[TestTxnKeys] Wrong client key.  Received: %q", ck)
+	}
+	resp := ParseMsg(NewResponse(inv, 180, "").String())
+	if k, _ := ClientTxnKey(resp); k != ck {
+		t.Errorf("[TestTxnKeys] Response should have the key of the request.  Received: %q", k)
+	}
+	rcvd := ParseMsg(inv.String())
+	sk, err := ServerTxnKey(rcvd)
+	if err != nil || sk != inv.Via[0].Branch+"|"+inv.Via[0].SentBy+"|INVITE" {
+		t.Errorf("[TestTxnKeys] Wrong server key.  Received: %q", sk)
+	}
+	ack := NewAckForNon2xx(rcvd, NewResponse(rcvd, 486, ""))
+	if k, _ := ServerTxnKey(ParseMsg(ack.String())); k != sk {
+		t.Errorf("[TestTxnKeys] ACK should have the key of the INVITE.  Received: %q", k)
+	}
+	if k, _ := serverTxnKey(rcvd, SIP_METHOD_CANCEL); k == sk {
+		t.Errorf("[TestTxnKeys] CANCEL should have its own key.")
+	}
+	old := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=1234\r\nFrom: <sip:alice@atlanta.com>;tag=1928301774\r\nTo: <sip:bob@biloxi.com>\r\nCall-ID: a84b4c76e66710\r\nCSeq: 314159 INVITE\r\nContent-Length: 0\r\n\r\n"
+	k2543, err := ServerTxnKey(ParseMsg(old))
+	if err != nil || k2543 != "2543|sip:bob@biloxi.com|1928301774|a84b4c76e66710|314159|INVITE|SIP/2.0/UDP pc33.atlanta.com;branch=1234" {
+		t.Errorf("[TestTxnKeys] Wrong RFC 2543 key.  Received: %q", k2543)
+	}
+	if _, err := ClientTxnKey(ParseMsg("SIP/2.0 200 OK\r\nCSeq: 1 INVITE\r\n\r\n")); !errors.Is(err, ErrTransaction) {
+		t.Errorf("[TestTxnKeys] A msg without a Via should be an ErrTransaction.")
+	}
+	if TXN_STATE_CONFIRMED.String() != "Confirmed" || TxnState(99).String() != "Unknown" {
+		t.Errorf("[TestTxnKeys] Wrong state names.")
+	}
+}
+
+func TestTxnTable(t *testing.T) {
+	c, tt := newTestClock(), &testTransport{}
+	table := NewTxnTable()
+	inv := NewRequest(SIP_METHOD_INVITE, ParseURI("sip:bob@biloxi.com"))
+	ctx, err := table.NewClient(inv, testTxnConfig(c, tt))
+	if err != nil {
+		t.Fatalf("[TestTxnTable] Error creating client transaction.  Received: %s", err.Error())
+	}
+	if _, err := table.NewClient(inv, testTxnConfig(c, tt)); !errors.Is(err, ErrTransaction) {
+		t.Errorf("[TestTxnTable] A second transaction for the same key should be an ErrTransaction.")
+	}
+	ctx.Start()
+	// the server side of the same INVITE
+	rcvd := ParseMsg(tt.sent[0].String())
+	stx, err := table.NewServer(rcvd, testTxnConfig(c, tt))
+	if err != nil {
+		t.Fatalf("[TestTxnTable] Error creating server transaction.  Received: %s", err.Error())
+	}
+	stx.Start()
+	if table.MatchRequest(ParseMsg(rcvd.String())) != stx || table.MatchCancel(ParseMsg(NewCancel(rcvd).String())) != stx {
+		t.Errorf("[TestTxnTable] Retransmission and CANCEL should match the server transaction.")
+	}
+	busy := NewResponse(rcvd, 486, "")
+	if err := stx.Respond(busy); err != nil {
+		t.Fatalf("[TestTxnTable] Error responding.  Received: %s", err.Error())
+	}
+	if table.MatchResponse(ParseMsg(busy.String())) != ctx {
+		t.Fatalf("[TestTxnTable] Response should match the client transaction.")
+	}
+	ctx.Receive(ParseMsg(busy.String()))
+	ack := tt.sent[len(tt.sent)-1]
+	if ack.StartLine.Method != SIP_METHOD_ACK || table.MatchRequest(ParseMsg(ack.String())) != stx {
+		t.Fatalf("[TestTxnTable] ACK should match the server transaction.")
+	}
+	stx.Receive(ParseMsg(ack.String()))
+	if table.Len() != 2 {
+		t.Errorf("[TestTxnTable] Should have 2 transactions.  Received: %d", table.Len())
+	}
+	c.Advance(SIP_TIMER_D)
+	if table.Len() != 0 || table.MatchResponse(busy) != nil {
+		t.Errorf("[TestTxnTable] Terminated transactions should be removed.  Received: %d", table.Len())
+	}
+
+	// RFC 2543 requests are matched on the To tag too
+	old := "INVITE sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP pc33.atlanta.com;branch=1234\r\nFrom: <sip:alice@atlanta.com>;tag=1928301774\r\nTo: <sip:bob@biloxi.com>\r\nCall-ID: a84b4c76e66710\r\nCSeq: 314159 INVITE\r\nContent-Length: 0\r\n\r\n"
+	stx, err = table.NewServer(ParseMsg(old), testTxnConfig(c, tt))
+	if err != nil {
+		t.Fatalf("[TestTxnTable] Error creating RFC 2543 server transaction.  Received: %s", err.Error())
+	}
+	resp := NewResponse(stx.Request, 404, "")
+	stx.Respond(resp)
+	oldAck := NewAckForNon2xx(stx.Request, resp)
+	if table.MatchRequest(ParseMsg(oldAck.String())) != stx {
+		t.Errorf("[TestTxnTable] RFC 2543 ACK should match on the To tag of the response.")
+	}
+	oldAck.To.Tag = "other"
+	if table.MatchRequest(ParseMsg(oldAck.String())) != nil {
+		t.Errorf("[TestTxnTable] RFC 2543 ACK with another To tag should not match.")
+	}
+	if table.MatchRequest(ParseMsg(old)) != stx {
+		t.Errorf("[TestTxnTable] RFC 2543 retransmission should match.")
+	}
+}
+
+func TestTxnRealClock(t *testing.T) {
+	tt := &testTransport{}
+	var mu sync.Mutex
+	tx, err := NewClientTransaction(NewRequest(SIP_METHOD_OPTIONS, ParseURI("sip:bob@biloxi.com")), &TxnConfig{T1: time.Millisecond, Send: func(msg *SipMsg) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return tt.send(msg)
+	}})
+	if err != nil {
+		t.Fatalf("[TestTxnRealClock] Error creating transaction.  Received: %s", err.Error())
+	}
+	done := make(chan bool, 1)
+	tx.OnTimeout = func() { done <- true }
+	tx.Start()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("[TestTxnRealClock] Timer F did not fire.")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if tx.State() != TXN_STATE_TERMINATED || len(tt.sent) < 2 {
+		t.Errorf("[TestTxnRealClock] Request should have been retransmitted before the timeout.  Received: %d", len(tt.sent))
+	}
+}
+
+// elapsedClock is a Clock whose timers have all passed already so it
+// calls f before AfterFunc returns
+type elapsedClock struct {
+	realClock
+}
+
+func (elapsedClock) AfterFunc(d time.Duration, f func()) Timer {
+	f()
+	return time.NewTimer(0)
+}
+
+func TestTxnElapsedClock(t *testing.T) {
+	done := make(chan bool, 1)
+	tx, err := NewClientTransaction(NewRequest(SIP_METHOD_OPTIONS, ParseURI("sip:bob@biloxi.com")), &TxnConfig{Clock: elapsedClock{}})
+	if err != nil {
+		t.Fatalf("[TestTxnElapsedClock] Error creating transaction.  Received: %s", err.Error())
+	}
+	tx.OnTimeout = func() { done <- true }
+	go tx.Start()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("[TestTxnElapsedClock] A timer that fires before AfterFunc returns should not deadlock the transaction.")
+	}
+	if tx.State() != TXN_STATE_TERMINATED {
+		t.Errorf("[TestTxnElapsedClock] Timer F should terminate the transaction.  Received: %s", tx.State())
+	}
+}
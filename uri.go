@@ -6,6 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
+	"fmt"
 	"strings"
 )
 
@@ -15,25 +16,52 @@ const (
 	TEL_SCHEME  = "tel"
 )
 
+// These are the chars (other than alphanum) that can be in each part
+// of a SIP-URI without being escaped (RFC 3261 25.1).  Everything
+// else is escaped when a uri is rendered.
+const (
+	uriUnreserved      = "-_.!~*'()"
+	uriUserUnreserved  = uriUnreserved + "&=+$,?/"
+	uriPassUnreserved  = uriUnreserved + "&=+$,"
+	uriParamUnreserved = uriUnreserved + "[]/:&+$"
+	uriHdrUnreserved   = uriUnreserved + "[]/?:+$"
+)
+
 // uriStateFn is just a type used by the parse method
 type uriStateFn func(*URI) uriStateFn
 
-// URI is a struct that holds an error (hopefully nil), the raw value, 
-// and the parsed uri.
+// URI is a struct that holds an error (hopefully nil), the raw value,
+// and the parsed uri.  The user, password, params and headers are
+// stored with any escaped chars (i.e. "%40") decoded and are escaped
+// again by String.
 // Fields are as follows:
 // -- Error is the error (or nil)
 // -- Scheme is the scheme (i.e. sip)
 // -- Raw is the raw value of the uri
-// -- UserInfo is the user:password;userparams=foo;
+// -- UserInfo is the user:password;userparams=foo as received
 // -- User is the user (i.e. the phone number)
 // -- UserPassword is the user password
+// -- UserParams are the params in the user part (i.e. the npdi and
+// rn in sip:15555551000;npdi=yes;rn=15555551999@0.0.0.0)
 // -- HostInfo is the host:port combination
-// -- Host is the host
+// -- Host is the host.  An IPv6 reference keeps its bracks (i.e.
+// "[2001:db8::1]").
 // -- Port is the port (if any)
 // -- UriParams are the uri's parameters
+// -- Headers are the headers after the "?" (i.e. the subject in
+// sip:carol@chicago.com?subject=project)
 // -- Secure is if the scheme is "sips"
-// -- atPos is just used by the parser to identify where the
-//   "@" char is in the .Raw field (or 0 if not present)
+// -- Tel is the parsed tel uri if the scheme is tel (see tel.go).
+// For a tel uri .User is the number, .UriParams are the params and
+// String renders the uri from .Tel.
+// -- URN is the parsed urn if the scheme is urn (see absuri.go)
+// -- Opaque, Path, Query and Fragment are the parts of an absolute
+// uri with any other scheme (i.e. http, cid or mailto).  A uri with
+// an authority (http://host/path) uses the user, host and port
+// fields and .Path and .Query.  One without (cid:foo@bar) has
+// everything but the fragment in .Opaque.
+// -- rest is just used by the parser to hold the part of .Raw
+// that has not been parsed yet
 type URI struct {
 	Error        error  // error if any
 	Scheme       string // scheme .. i.e. tel, sip, sips,etc.
@@ -41,12 +69,20 @@ type URI struct {
 	UserInfo     string // this is everything before the "@"
 	User         string // this is the actual called party
 	UserPassword string // this is the password (i.e. alice:passwd@bob.com)
+	UserParams   []*Param
 	HostInfo     string // this is everything after the @ or the entire uri
 	Host         string // the host in the uri
-	Port         string // the port 
+	Port         string // the port
 	UriParams    []*Param
+	Headers      []*Param
 	Secure       bool // Indicates SIP-URI or SIPS-URI (true for SIPS-URI)
-	atPos        int
+	Tel          *TelURI
+	URN          *URN
+	Opaque       string
+	Path         string
+	Query        string
+	Fragment     string
+	rest         string
 }
 
 // NewURI is a convenience function that creates a *URI for you
@@ -63,6 +99,26 @@ func ParseURI(s string) *URI {
 	return u
 }
 
+// reset clears the uri so it can be reused for s.  The param slices
+// are kept (emptied) so their memory gets reused too.
+func (u *URI) reset(s string) {
+	p := u.UriParams[0:0]
+	up := u.UserParams[0:0]
+	h := u.Headers[0:0]
+	*u = URI{Raw: s, UriParams: p, UserParams: up, Headers: h}
+}
+
+// reuseURI parses s into u (after resetting it) or into a new *URI
+// if u is nil
+func reuseURI(u *URI, s string) *URI {
+	if u == nil {
+		return ParseURI(s)
+	}
+	u.reset(s)
+	u.Parse()
+	return u
+}
+
 // Parse parses the .Raw field
 func (u *URI) Parse() {
 	for state := parseUri; state != nil; {
@@ -73,152 +129,433 @@ func (u *URI) Parse() {
 // parseUri is the for loop that does the actual parsing
 func parseUri(u *URI) uriStateFn {
 	if u.Error == nil {
+		u.rest = u.Raw
 		return parseUriGetScheme
 	}
 	return nil
 }
 
-// parseUriGetAt determines if there is an "@" character in the
-// .Raw field
-func parseUriGetAt(u *URI) uriStateFn {
-	for i := range u.Raw {
-		if u.Raw[i] == '@' {
-			u.atPos = i
+func parseUriGetScheme(u *URI) uriStateFn {
+	colon := strings.IndexByte(u.rest, ':')
+	if colon == -1 {
+		return parseUriUser
+	}
+	switch {
+	case strings.EqualFold(u.rest[0:colon], SIP_SCHEME):
+		u.Scheme = SIP_SCHEME
+	case strings.EqualFold(u.rest[0:colon], SIPS_SCHEME):
+		u.Scheme = SIPS_SCHEME
+		u.Secure = true
+	case strings.EqualFold(u.rest[0:colon], TEL_SCHEME):
+		u.Scheme = TEL_SCHEME
+		u.rest = u.rest[colon+1:]
+		if strings.IndexByte(u.rest, '@') == -1 {
+			return parseUriTel
+		}
+		// not really a tel uri (i.e. tel:5554448000@myfoo.com) but
+		// they show up so it is parsed like a sip uri
+		return parseUriUser
+	case strings.EqualFold(u.rest[0:colon], URN_SCHEME):
+		u.Scheme = URN_SCHEME
+		u.rest = u.rest[colon+1:]
+		return parseUriUrn
+	case strings.EqualFold(u.rest[0:colon], IM_SCHEME):
+		// im and pres uris are user@host just like sip
+		u.Scheme = IM_SCHEME
+	case strings.EqualFold(u.rest[0:colon], PRES_SCHEME):
+		u.Scheme = PRES_SCHEME
+	case isScheme(u.rest[0:colon]):
+		rest := u.rest[colon+1:]
+		if !absUriSchemes[strings.ToLower(u.rest[0:colon])] && (strings.IndexByte(rest, '@') != -1 || isDigits(strings.TrimSpace(rest))) {
+			// no scheme (i.e. alice:secret@atlanta.com or
+			// atlanta.com:5060)
 			return parseUriUser
 		}
+		u.Scheme = strings.ToLower(u.rest[0:colon])
+		u.rest = rest
+		return parseUriAbs
+	default:
+		return parseUriUser
+	}
+	u.rest = u.rest[colon+1:]
+	return parseUriUser
+}
+
+// parseUriUser gets the userinfo (everything before the "@") which is
+// user *( ";" user-param ) [ ":" password ]
+func parseUriUser(u *URI) uriStateFn {
+	at := strings.IndexByte(u.rest, '@')
+	if at == -1 {
+		return parseUriHost
+	}
+	u.UserInfo = u.rest[0:at]
+	u.rest = u.rest[at+1:]
+	user := u.UserInfo
+	semi := strings.IndexByte(user, ';')
+	if semi != -1 {
+		if u.UserParams, u.Error = getUriParams(u.UserParams, user[semi+1:], ';'); u.Error != nil {
+			return nil
+		}
+		user = user[0:semi]
+	}
+	if colon := strings.IndexByte(user, ':'); colon != -1 {
+		if u.UserPassword, u.Error = unescape(user[colon+1:]); u.Error != nil {
+			return nil
+		}
+		user = user[0:colon]
+	}
+	u.User, u.Error = unescape(user)
+	if u.Error != nil {
+		return nil
 	}
 	return parseUriHost
 }
 
-func parseUriGetScheme(u *URI) uriStateFn {
-	sLen := len(u.Raw)
+// parseUriHost gets the host and port.  The host can be an IPv6
+// reference (i.e. [2001:db8::1]) so the port is only looked for
+// after the closing brack.
+func parseUriHost(u *URI) uriStateFn {
+	end := strings.IndexAny(u.rest, ";?")
+	if end == -1 {
+		end = len(u.rest)
+	}
+	u.HostInfo = u.rest[0:end]
+	u.rest = u.rest[end:]
+	hostEnd := 0
 	switch {
-	case sLen > 4:
-		if u.Raw[0:4] == "sip:" {
-			u.Raw = u.Raw[4:]
-			u.Scheme = SIP_SCHEME
-			return parseUriGetAt
-		}
-		if u.Raw[0:4] == "tel:" {
-			u.Raw = u.Raw[4:]
-			u.Scheme = TEL_SCHEME
-			return parseUriGetAt
-		}
-		if sLen > 5 && u.Raw[0:5] == "sips:" {
-			u.Scheme = SIPS_SCHEME
-			u.Raw = u.Raw[5:]
-			return parseUriGetAt
+	case strings.HasPrefix(u.HostInfo, "["):
+		hostEnd = strings.IndexByte(u.HostInfo, ']') + 1
+		if hostEnd == 0 {
+			u.Error = fmt.Errorf("%w: parseUriHost err: no closing brack on IPv6 reference in: %s", ErrBadURI, u.Raw)
+			return nil
 		}
 	default:
-		return parseUriGetAt
+		hostEnd = strings.IndexByte(u.HostInfo, ':')
+		if hostEnd == -1 {
+			hostEnd = len(u.HostInfo)
+		}
+	}
+	u.Host = u.HostInfo[0:hostEnd]
+	if u.Host == "" {
+		u.Error = fmt.Errorf("%w: parseUriHost err: no host found in: %s", ErrBadURI, u.Raw)
+		return nil
 	}
-	return parseUriGetAt
+	if hostEnd < len(u.HostInfo) {
+		if u.HostInfo[hostEnd] != ':' {
+			u.Error = fmt.Errorf("%w: parseUriHost err: unexpected chars after host in: %s", ErrBadURI, u.Raw)
+			return nil
+		}
+		u.Port = cleanWs(u.HostInfo[hostEnd+1:])
+		if !isDigits(u.Port) {
+			u.Error = fmt.Errorf("%w: parseUriHost err: invalid port in: %s", ErrBadURI, u.Raw)
+			return nil
+		}
+	}
+	return parseUriParams
 }
 
-func parseUriUser(u *URI) uriStateFn {
-	if u.atPos == 0 {
-		return parseUriHost
+// parseUriParams gets the ";" separated uri params
+func parseUriParams(u *URI) uriStateFn {
+	if !strings.HasPrefix(u.rest, ";") {
+		return parseUriHeaders
 	}
-	firstSemi := strings.IndexRune(u.Raw[0:u.atPos], ';')
-	colon := 0
-	if firstSemi != -1 {
-		if u.UriParams == nil {
-			u.UriParams = make([]*Param, 0)
+	end := strings.IndexByte(u.rest, '?')
+	if end == -1 {
+		end = len(u.rest)
+	}
+	if u.UriParams, u.Error = getUriParams(u.UriParams, u.rest[1:end], ';'); u.Error != nil {
+		return nil
+	}
+	u.rest = u.rest[end:]
+	return parseUriHeaders
+}
+
+// parseUriHeaders gets the "&" separated headers after the "?"
+func parseUriHeaders(u *URI) uriStateFn {
+	if !strings.HasPrefix(u.rest, "?") {
+		return nil
+	}
+	u.Headers, u.Error = getUriParams(u.Headers, u.rest[1:], '&')
+	u.rest = ""
+	return nil
+}
+
+// getUriParams appends the sep separated params in s to p with their
+// names and values unescaped
+func getUriParams(p []*Param, s string, sep byte) ([]*Param, error) {
+	for s != "" {
+		end := strings.IndexByte(s, sep)
+		if end == -1 {
+			end = len(s)
 		}
-		if len(u.Raw[0:u.atPos])-1 > firstSemi+1 {
-			params := strings.Split(u.Raw[firstSemi+1:], ";")
-			for i := range params {
-				u.UriParams = append(u.UriParams, getParam(params[i]))
+		if strings.TrimSpace(s[0:end]) != "" {
+			pm := getParam(s[0:end])
+			var err error
+			if pm.Param, err = unescape(pm.Param); err != nil {
+				return p, err
 			}
+			if pm.Val, err = unescape(pm.Val); err != nil {
+				return p, err
+			}
+			p = append(p, pm)
+		}
+		if end == len(s) {
+			break
 		}
+		s = s[end+1:]
 	}
+	return p, nil
+}
+
+// unhex returns the value of a hex digit or -1
+func unhex(c byte) int {
 	switch {
-	case firstSemi != -1:
-		for i := range u.Raw[0:firstSemi] {
-			if u.Raw[i] == ':' {
-				if u.atPos > i+1 {
-					u.UserPassword = u.Raw[0:i]
-					colon = i
-					break
-				}
-			}
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// unescape decodes the escaped ("%" HEXDIG HEXDIG) chars in s.  s is
+// returned as is (without allocating) if there aren't any.
+func unescape(s string) (string, error) {
+	if strings.IndexByte(s, '%') == -1 {
+		return s, nil
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b = append(b, s[i])
+			continue
 		}
-	default:
-		for i := range u.Raw[0:u.atPos] {
-			if u.Raw[i] == ':' {
-				if u.atPos > i+1 {
-					u.UserPassword = u.Raw[i+1 : u.atPos]
-					colon = i
-					break
-				}
-			}
+		if i+2 >= len(s) || unhex(s[i+1]) == -1 || unhex(s[i+2]) == -1 {
+			return s, fmt.Errorf("%w: unescape err: invalid escape in: %s", ErrBadURI, s)
 		}
+		b = append(b, byte(unhex(s[i+1])<<4|unhex(s[i+2])))
+		i += 2
 	}
-	switch {
-	case colon != 0:
-		u.User = u.Raw[0:colon]
-	default:
+	return string(b), nil
+}
+
+// escape escapes every char in s that is not alphanum or in allowed.
+// s is returned as is (without allocating) if nothing needs escaping.
+func escape(s string, allowed string) string {
+	const hexChars = "0123456789ABCDEF"
+	ok := func(c byte) bool {
+		return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || (c < 0x80 && strings.IndexByte(allowed, c) != -1)
+	}
+	i := 0
+	for i < len(s) && ok(s[i]) {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+	b := make([]byte, 0, len(s)+8)
+	b = append(b, s[0:i]...)
+	for ; i < len(s); i++ {
 		switch {
-		case firstSemi != -1:
-			u.User = u.Raw[0:firstSemi]
+		case ok(s[i]):
+			b = append(b, s[i])
 		default:
-			u.User = u.Raw[0:u.atPos]
+			b = append(b, '%', hexChars[s[i]>>4], hexChars[s[i]&0x0f])
 		}
 	}
-	return parseUriHost
+	return string(b)
 }
 
-func parseUriHost(u *URI) uriStateFn {
-	firstSemi := strings.IndexRune(u.Raw[u.atPos:], ';')
-	if firstSemi != -1 {
-		if u.UriParams == nil {
-			u.UriParams = make([]*Param, 0)
-		}
-		if len(u.Raw[u.atPos:])-1 > firstSemi+1 {
-			uriparams := strings.Split(u.Raw[u.atPos:][firstSemi+1:], ";")
-			for i := range uriparams {
-				u.UriParams = append(u.UriParams, getParam(uriparams[i]))
-			}
+// writeUriParams renders the params with their names and values
+// escaped
+func writeUriParams(p []*Param, sep string, allowed string) string {
+	str := ""
+	for i := range p {
+		str += sep + escape(p[i].Param, allowed)
+		if p[i].Val != "" {
+			str += "=" + escape(p[i].Val, allowed)
 		}
 	}
-	colon := 0
-	if firstSemi != -1 {
-		for i := range u.Raw[u.atPos : u.atPos+firstSemi] {
-			if i != len(u.Raw[u.atPos+1:u.atPos+firstSemi]) {
-				if u.Raw[u.atPos+1 : u.atPos+firstSemi][i] == ':' {
-					u.Port = cleanWs(u.Raw[u.atPos+1 : u.atPos+firstSemi][i+1:])
-					colon = i
-				}
-				if colon != 0 {
-					break
-				}
-			}
+	return str
+}
+
+// Param returns the uri param with the name (which is not case
+// sensitive) or nil if there isn't one
+func (u *URI) Param(name string) *Param {
+	for i := range u.UriParams {
+		if strings.EqualFold(u.UriParams[i].Param, name) {
+			return u.UriParams[i]
 		}
-		switch {
-		case colon == 0:
-			u.Host = u.Raw[u.atPos+1 : u.atPos+firstSemi]
-		default:
-			u.Host = u.Raw[u.atPos+1 : u.atPos+colon+1]
-		}
-	}
-	if firstSemi == -1 {
-		for i := range u.Raw[u.atPos+1:] {
-			if i != len(u.Raw[u.atPos+1:]) {
-				if u.Raw[u.atPos+1:][i] == ':' {
-					u.Port = cleanWs(u.Raw[u.atPos+1:][i+1:])
-					colon = i
-				}
-				if colon != 0 {
-					break
-				}
-			}
+	}
+	return nil
+}
+
+// SetParam sets the value of the uri param with the name (adding it
+// if it is not there).  val can be blank for a flag (i.e. "lr").
+func (u *URI) SetParam(name string, val string) {
+	if p := u.Param(name); p != nil {
+		p.Val = val
+		return
+	}
+	u.UriParams = append(u.UriParams, &Param{Param: name, Val: val})
+}
+
+// Transport returns the lower case value of the transport param
+// (i.e. "tcp") or "" if there isn't one
+func (u *URI) Transport() string {
+	if p := u.Param("transport"); p != nil {
+		return strings.ToLower(p.Val)
+	}
+	return ""
+}
+
+// Maddr returns the value of the maddr param (the address to send
+// the request to instead of the host) or "" if there isn't one
+func (u *URI) Maddr() string {
+	if p := u.Param("maddr"); p != nil {
+		return p.Val
+	}
+	return ""
+}
+
+// Lr returns true if the uri has the lr param (i.e. it is for a
+// loose router)
+func (u *URI) Lr() bool {
+	return u.Param("lr") != nil
+}
+
+// uriEqualParams are the uri params that have to be in both uris (or
+// neither) for them to be equal (RFC 3261 19.1.4)
+var uriEqualParams = []string{"user", "ttl", "method", "maddr", "transport"}
+
+// Equal returns true if u and o are equivalent as defined by RFC 3261
+// 19.1.4:
+// -- the schemes have to match (so a sip and a sips uri are never
+// equal)
+// -- the user, password and user params are compared case sensitive
+// and everything else is not
+// -- escaped chars are the same as the chars they stand for
+// -- the host and port have to match (a missing port is not the same
+// as the default port)
+// -- the user, ttl, method, maddr and transport params have to be in
+// both uris (or neither) and match.  Other params only have to match
+// if they are in both uris.
+// -- every header has to be in both uris and match
+func (u *URI) Equal(o *URI) bool {
+	if u == nil || o == nil {
+		return u == o
+	}
+	if u.Tel != nil || o.Tel != nil {
+		return u.Tel.Equal(o.Tel)
+	}
+	if u.URN != nil || o.URN != nil {
+		return u.URN.Equal(o.URN)
+	}
+	if u.Opaque != o.Opaque || u.Path != o.Path || u.Query != o.Query || u.Fragment != o.Fragment {
+		return false
+	}
+	if u.Scheme != o.Scheme || u.User != o.User || u.UserPassword != o.UserPassword {
+		return false
+	}
+	if !strings.EqualFold(u.Host, o.Host) || u.Port != o.Port {
+		return false
+	}
+	if len(u.UserParams) != len(o.UserParams) {
+		return false
+	}
+	for i := range u.UserParams {
+		if u.UserParams[i].Param != o.UserParams[i].Param || u.UserParams[i].Val != o.UserParams[i].Val {
+			return false
 		}
-		switch {
-		case colon == 0:
-			u.Host = u.Raw[u.atPos+1:]
-		default:
-			u.Host = u.Raw[u.atPos+1 : u.atPos+colon+1]
+	}
+	for _, name := range uriEqualParams {
+		if (u.Param(name) == nil) != (o.Param(name) == nil) {
+			return false
 		}
 	}
-	return nil
+	for i := range u.UriParams {
+		p := o.Param(u.UriParams[i].Param)
+		if p != nil && !strings.EqualFold(p.Val, u.UriParams[i].Val) {
+			return false
+		}
+	}
+	if len(u.Headers) != len(o.Headers) {
+		return false
+	}
+	for i := range u.Headers {
+		if !hasUriHeader(o.Headers, u.Headers[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasUriHeader returns true if h is in hdrs (the name and value are
+// not case sensitive)
+func hasUriHeader(hdrs []*Param, h *Param) bool {
+	for i := range hdrs {
+		if strings.EqualFold(hdrs[i].Param, h.Param) && strings.EqualFold(hdrs[i].Val, h.Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the uri rendered from its parsed fields so that
+// any changes made to them are reflected in the output
+func (u *URI) String() string {
+	switch {
+	case u.Tel != nil:
+		return u.Tel.String()
+	case u.URN != nil:
+		return u.URN.String()
+	case u.isAbs():
+		return u.absString()
+	}
+	str := ""
+	if u.Scheme != "" {
+		str = u.Scheme + ":"
+	}
+	if u.User != "" {
+		str += escape(u.User, uriUserUnreserved)
+		str += writeUriParams(u.UserParams, ";", uriParamUnreserved)
+		if u.UserPassword != "" {
+			str += ":" + escape(u.UserPassword, uriPassUnreserved)
+		}
+		str += "@"
+	}
+	str += u.Host
+	if u.Port != "" {
+		str += ":" + u.Port
+	}
+	str += writeUriParams(u.UriParams, ";", uriParamUnreserved)
+	if len(u.Headers) != 0 {
+		str += "?" + writeUriParams(u.Headers, "&", uriHdrUnreserved)[1:]
+	}
+	return str
+}
+
+// Clone returns a deep copy of the uri.  Use it to keep a uri of a
+// msg that is going to be passed to Parser.Release.
+func (u *URI) Clone() *URI {
+	return u.clone()
+}
+
+// clone returns a deep copy of the uri
+func (u *URI) clone() *URI {
+	if u == nil {
+		return nil
+	}
+	n := *u
+	n.UserParams = cloneParams(u.UserParams)
+	n.UriParams = cloneParams(u.UriParams)
+	n.Headers = cloneParams(u.Headers)
+	n.Tel = u.Tel.clone()
+	if u.URN != nil {
+		urn := *u.URN
+		n.URN = &urn
+	}
+	return &n
 }
@@ -33,3 +33,100 @@ func TestUri(t *testing.T) {
 		t.Errorf("[TestUri] Error parsing URI \"tel:5554448000@myfoo.com\".  Host should be \"myfoo.com\" but received: " + u.Host)
 	}
 }
+
+func TestUriString(t *testing.T) {
+	s := "sip:alice:secret@example.com:5060;transport=tcp;lr"
+	u := ParseURI(s)
+	if u.String() != s {
+		t.Errorf("[TestUriString] Error rendering uri %q.  Received: %q", s, u.String())
+	}
+	u = ParseURI("sip:example.com")
+	if u.Host != "example.com" {
+		t.Errorf("[TestUriString] Error parsing uri \"sip:example.com\".  Host should be \"example.com\" but received: %q", u.Host)
+	}
+	if u.String() != "sip:example.com" {
+		t.Errorf("[TestUriString] Error rendering uri \"sip:example.com\".  Received: %q", u.String())
+	}
+}
+
+func TestUriGrammar(t *testing.T) {
+	u := ParseURI("sip:alice@[2001:db8::1]:5060;transport=TCP;maddr=239.255.255.1;lr")
+	if u.Error != nil {
+		t.Fatalf("[TestUriGrammar] Error parsing IPv6 uri.  Received: %s", u.Error.Error())
+	}
+	if u.Host != "[2001:db8::1]" || u.Port != "5060" {
+		t.Errorf("[TestUriGrammar] IPv6 host or port is wrong.  Received: %q and %q", u.Host, u.Port)
+	}
+	if u.Transport() != "tcp" || u.Maddr() != "239.255.255.1" || !u.Lr() {
+		t.Errorf("[TestUriGrammar] transport, maddr or lr is wrong.")
+	}
+	u = ParseURI("sip:[::1]")
+	if u.Error != nil || u.Host != "[::1]" || u.Port != "" {
+		t.Errorf("[TestUriGrammar] IPv6 host without a port is wrong.  Received: %q", u.Host)
+	}
+	u = ParseURI("sips:carol%40home:pa%2Fss@chicago.com;x%3Dy=a%20b?subject=project%20x&priority=urgent")
+	if u.Error != nil {
+		t.Fatalf("[TestUriGrammar] Error parsing escaped uri.  Received: %s", u.Error.Error())
+	}
+	if !u.Secure || u.User != "carol@home" || u.UserPassword != "pa/ss" {
+		t.Errorf("[TestUriGrammar] Escaped user or password was not decoded.  Received: %q and %q", u.User, u.UserPassword)
+	}
+	if len(u.UriParams) != 1 || u.UriParams[0].Param != "x=y" || u.UriParams[0].Val != "a b" {
+		t.Errorf("[TestUriGrammar] Escaped param was not decoded.")
+	}
+	if len(u.Headers) != 2 || u.Headers[0].Param != "subject" || u.Headers[0].Val != "project x" || u.Headers[1].Val != "urgent" {
+		t.Errorf("[TestUriGrammar] Headers were not parsed.")
+	}
+	if u.String() != "sips:carol%40home:pa%2Fss@chicago.com;x%3Dy=a%20b?subject=project%20x&priority=urgent" {
+		t.Errorf("[TestUriGrammar] Escaped uri did not render the same.  Received: %q", u.String())
+	}
+	u = ParseURI("sip:15555551000;npdi=yes;rn=15555551999@0.0.0.0:5060;user=phone")
+	if len(u.UserParams) != 2 || u.UserParams[1].Val != "15555551999" || len(u.UriParams) != 1 {
+		t.Errorf("[TestUriGrammar] User params should be separate from the uri params.")
+	}
+	if u.String() != "sip:15555551000;npdi=yes;rn=15555551999@0.0.0.0:5060;user=phone" {
+		t.Errorf("[TestUriGrammar] User params did not render the same.  Received: %q", u.String())
+	}
+	u.SetParam("lr", "")
+	u.SetParam("user", "ip")
+	if u.String() != "sip:15555551000;npdi=yes;rn=15555551999@0.0.0.0:5060;user=ip;lr" {
+		t.Errorf("[TestUriGrammar] SetParam did not update the params.  Received: %q", u.String())
+	}
+	for _, bad := range []string{"sip:alice@[2001:db8::1", "sip:alice@host:50a", "sip:al%2@host", "sip:alice@"} {
+		if u = ParseURI(bad); u.Error == nil {
+			t.Errorf("[TestUriGrammar] %q should be an error.", bad)
+		}
+	}
+}
+
+// the examples from RFC 3261 19.1.4
+func TestUriEqual(t *testing.T) {
+	equal := [][2]string{
+		{"sip:%61lice@atlanta.com;transport=TCP", "sip:alice@AtLanTa.CoM;Transport=tcp"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com;newparam=5"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com;security=on"},
+		{"sip:carol@chicago.com;newparam=5", "sip:carol@chicago.com;security=on"},
+		{"sip:biloxi.com;transport=tcp;method=REGISTER?to=sip:bob%40biloxi.com", "sip:biloxi.com;method=REGISTER;transport=tcp?to=sip:bob%40biloxi.com"},
+		{"sip:alice@atlanta.com?subject=project%20x&priority=urgent", "sip:alice@atlanta.com?priority=urgent&subject=project%20x"},
+	}
+	for _, e := range equal {
+		if !ParseURI(e[0]).Equal(ParseURI(e[1])) || !ParseURI(e[1]).Equal(ParseURI(e[0])) {
+			t.Errorf("[TestUriEqual] %q and %q should be equal.", e[0], e[1])
+		}
+	}
+	notEqual := [][2]string{
+		{"SIP:ALICE@AtLanTa.CoM;Transport=udp", "sip:alice@AtLanTa.CoM;Transport=UDP"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com:5060"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com;transport=udp"},
+		{"sip:bob@biloxi.com", "sip:bob@biloxi.com:6000;transport=tcp"},
+		{"sip:carol@chicago.com", "sip:carol@chicago.com?Subject=next%20meeting"},
+		{"sip:bob@phone21.boxesbybob.com", "sip:bob@192.0.2.4"},
+		{"sip:carol@chicago.com", "sips:carol@chicago.com"},
+		{"sip:carol@chicago.com;security=on", "sip:carol@chicago.com;security=off"},
+	}
+	for _, e := range notEqual {
+		if ParseURI(e[0]).Equal(ParseURI(e[1])) || ParseURI(e[1]).Equal(ParseURI(e[0])) {
+			t.Errorf("[TestUriEqual] %q and %q should not be equal.", e[0], e[1])
+		}
+	}
+}
@@ -13,7 +13,13 @@ func cleanWs(s string) (ns string) {
 	if s == "" {
 		return ""
 	}
-	v := strings.Split(strings.TrimSpace(s), " ")
+	s = strings.TrimSpace(s)
+	if strings.Index(s, "  ") == -1 {
+		// nothing to collapse so the trimmed string can be
+		// returned without allocating
+		return s
+	}
+	v := strings.Split(s, " ")
 	if len(v) == 1 {
 		return v[0]
 	}
@@ -60,68 +66,79 @@ func cleanBrack(s string) string {
 	return n
 }
 
-func getQuoteChars(s string) (one int, two int, chk bool) {
-	ct := 0
-	for i := range s {
-		if s[i] == '"' {
-			switch {
-			case ct == 0:
-				one = i
-				ct = 1
-			case ct == 1:
-				two = i
-				return one, two, true
-			default:
-				return one, two, false
-			}
-		}
-	}
-	return 0, 0, false
-}
-
+// getBracks returns the index of the "<" and ">" around the uri in a
+// name-addr.  A "<" inside of the display name (i.e. "a<b" <sip:b>)
+// is skipped.
 func getBracks(s string) (one int, two int, chk bool) {
-	one = strings.IndexRune(s, '<')
+	one = indexUnquoted(s, '<')
 	if one == -1 {
 		return 0, 0, false
 	}
-	two = strings.IndexRune(s, '>')
+	two = strings.IndexByte(s[one:], '>')
 	if two == -1 {
 		return 0, 0, false
 	}
-	if two < one {
-		return 0, 0, false
-	}
-	return one, two, true
+	return one, one + two, true
 }
 
+// getName returns the display name of a name-addr and the index of
+// where it ends (the closing quote or the "<").  A quoted display name
+// is returned without the quotes and with any quoted-pairs decoded
+// (i.e. "Smith, \"JJ\" John" is Smith, "JJ" John) and LWS in an
+// unquoted one is collapsed.
 func getName(s string) (name string, end int) {
 	if s == "" {
 		return "", 0
 	}
-	posOne, posTwo, chk := getQuoteChars(s)
-	if chk == true {
-		if len(s)-1 > posTwo {
-			return strings.TrimSpace(s[posOne+1 : posTwo]), posTwo
+	start := len(s) - len(strings.TrimLeft(s, " \t"))
+	if start < len(s) && s[start] == '"' {
+		end = quotedStringEnd(s[start:])
+		if end == -1 || start+end == len(s)-1 {
+			return "", 0
 		}
-		return "", 0
-	}
-	posOne = strings.IndexRune(s, '<')
-	if posOne == -1 {
-		return "", 0
+		return unquoteStr(s[start : start+end+1]), start + end
 	}
-	if posOne == 0 {
+	end = strings.IndexByte(s, '<')
+	if end <= 0 {
 		return "", 0
 	}
-	return strings.TrimSpace(s[0:posOne]), posOne
+	return cleanWs(trimLWS(s[0:end])), end
 }
 
+// getCommaSeperated returns the comma separated values in str or nil
+// if there is only one
 func getCommaSeperated(str string) []string {
-	s := strings.Split(str, ",")
-	if len(s) == 1 {
+	s := splitList(str, ',')
+	if len(s) < 2 {
 		return nil
 	}
+	return s
+}
+
+// quoteStr wraps s in double quotes escaping any quote or
+// backslash chars inside of it
+func quoteStr(s string) string {
+	if strings.IndexAny(s, "\"\\") == -1 {
+		return "\"" + s + "\""
+	}
+	n := "\""
 	for i := range s {
-		s[i] = strings.TrimSpace(s[i])
+		if s[i] == '"' || s[i] == '\\' {
+			n += "\\"
+		}
+		n += s[i : i+1]
 	}
-	return s
+	return n + "\""
+}
+
+// nameAddr renders a display name and uri as "name" <uri>
+func nameAddr(name string, u *URI) string {
+	str := ""
+	if name != "" {
+		str = quoteStr(name) + " "
+	}
+	if u != nil {
+		str += "<" + u.String() + ">"
+	}
+	return str
 }
@@ -6,12 +6,32 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
 type viaStateFn func(v *Via) viaStateFn
 
+// Via is a single via-parm.  A Via hdr with more than one comma
+// separated via-parm (i.e. "SIP/2.0/UDP a;branch=1, SIP/2.0/TCP
+// b;branch=2") is parsed into one Via for each.
+// The fields are as follows:
+// -- State is the parser state
+// -- Error is the error (or nil)
+// -- Via is the raw value of the via-parm
+// -- Proto is the protocol (i.e. "SIP")
+// -- Version is the version (i.e. "2.0")
+// -- Transport is the transport (i.e. "UDP")
+// -- SentBy is the host:port combination
+// -- Host is the host from the sent-by.  An IPv6 reference keeps its
+// bracks (i.e. "[2001:db8::1]").
+// -- Port is the port from the sent-by (if any).  A port that is not
+// a number from 1 to 65535 is an error.
+// -- Branch, Received, RPort, Maddr and TTL are the values of the
+// branch, received, rport, maddr and ttl params
+// -- Alias is true if the alias param (RFC 5923) is present
+// -- Params are any other params
 type Via struct {
 	State      string
 	Error      error
@@ -20,12 +40,18 @@ type Via struct {
 	Version    string
 	Transport  string
 	SentBy     string
+	Host       string
+	Port       string
 	Branch     string
 	Received   string
 	RPort      string
+	Maddr      string
+	TTL        string
+	Alias      bool
 	Params     []*Param
 	protoEnd   int
 	paramStart int
+	rport      bool
 }
 
 func (v *Via) parse() {
@@ -44,8 +70,15 @@ func (v *Via) addParam(s string) {
 		v.Branch = p.Val
 	case p.Param == "rport":
 		v.RPort = p.Val
+		v.rport = true
 	case p.Param == "received":
 		v.Received = p.Val
+	case p.Param == "maddr":
+		v.Maddr = p.Val
+	case p.Param == "ttl":
+		v.TTL = p.Val
+	case p.Param == "alias":
+		v.Alias = true
 	default:
 		v.Params = append(v.Params, p)
 	}
@@ -55,6 +88,41 @@ func (v *Via) AddReceived(s string) {
 	v.Received = s
 }
 
+// String returns the via rendered from its parsed fields (i.e.
+// SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK...) or the raw value if it
+// did not parse
+func (v *Via) String() string {
+	if v.Error != nil {
+		return v.Via
+	}
+	str := v.Proto + "/" + v.Version + "/" + v.Transport + " " + v.SentBy
+	if v.Branch != "" {
+		str += ";branch=" + v.Branch
+	}
+	if v.Received != "" {
+		str += ";received=" + v.Received
+	}
+	switch {
+	case v.RPort != "":
+		str += ";rport=" + v.RPort
+	case v.rport:
+		str += ";rport"
+	}
+	if v.Maddr != "" {
+		str += ";maddr=" + v.Maddr
+	}
+	if v.TTL != "" {
+		str += ";ttl=" + v.TTL
+	}
+	if v.Alias {
+		str += ";alias"
+	}
+	for i := range v.Params {
+		str += ";" + v.Params[i].String()
+	}
+	return str
+}
+
 func parseViaState(v *Via) viaStateFn {
 	if v.Error != nil {
 		return nil
@@ -65,12 +133,12 @@ func parseViaState(v *Via) viaStateFn {
 func parseViaGetProto(v *Via) viaStateFn {
 	v.protoEnd = strings.Index(v.Via, " ")
 	if v.protoEnd == -1 {
-		v.Error = errors.New("parseViaGetProto err: could not get LWS char.")
+		v.Error = fmt.Errorf("%w: parseViaGetProto err: could not get LWS char.", ErrBadVia)
 		return nil
 	}
 	protoParts := strings.SplitN(v.Via[0:v.protoEnd], "/", 3)
 	if len(protoParts) != 3 {
-		v.Error = errors.New("parseViaGetProto err: split err on proto char.")
+		v.Error = fmt.Errorf("%w: parseViaGetProto err: split err on proto char.", ErrBadVia)
 		return nil
 	}
 	v.Proto = protoParts[0]
@@ -88,7 +156,7 @@ func parseViaGetParams(v *Via) viaStateFn {
 		v.paramStart = pChar
 	}
 	if len(v.Via)-1 > pChar+1 {
-		parts := strings.Split(v.Via[pChar+1:], ";")
+		parts := splitQuoted(v.Via[pChar+1:], ';')
 		if len(parts) == 1 {
 			v.addParam(parts[0])
 			return parseViaGetHostPort
@@ -102,11 +170,75 @@ func parseViaGetParams(v *Via) viaStateFn {
 
 func parseViaGetHostPort(v *Via) viaStateFn {
 	if v.protoEnd == 0 {
-		v.Error = errors.New("parseViaGetHostPort err: protoEnd is 0.")
+		v.Error = fmt.Errorf("%w: parseViaGetHostPort err: protoEnd is 0.", ErrBadVia)
 		return nil
 	}
-	if v.protoEnd < v.paramStart {
-		v.SentBy = v.Via[v.protoEnd+1 : v.paramStart]
+	switch {
+	case v.paramStart == 0:
+		v.SentBy = strings.TrimSpace(v.Via[v.protoEnd+1:])
+	case v.protoEnd < v.paramStart:
+		v.SentBy = strings.TrimSpace(v.Via[v.protoEnd+1 : v.paramStart])
+	}
+	v.Host, v.Port = splitSentBy(v.SentBy)
+	switch {
+	case v.Host == "":
+		v.Error = fmt.Errorf("%w: parseViaGetHostPort err: no host in sent-by: %s", ErrBadVia, v.SentBy)
+	case v.Port != "" && !isPort(v.Port):
+		v.Error = fmt.Errorf("%w: parseViaGetHostPort err: bad port in sent-by: %s", ErrBadVia, v.SentBy)
 	}
 	return nil
 }
+
+// isPort returns true if s is a port number (1*DIGIT from 1 to 65535)
+func isPort(s string) bool {
+	if !isDigits(s) {
+		return false
+	}
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// splitSentBy splits a sent-by (host [ ":" port ]) into the host and
+// port.  An IPv6 reference has to be in bracks (i.e. "[::1]:5060")
+// for it to have a port.
+func splitSentBy(s string) (string, string) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return s, ""
+		}
+		if strings.HasPrefix(s[end+1:], ":") {
+			return s[0 : end+1], s[end+2:]
+		}
+		return s[0 : end+1], ""
+	}
+	colon := strings.IndexByte(s, ':')
+	if colon == -1 || strings.IndexByte(s[colon+1:], ':') != -1 {
+		// no port or an IPv6 address without bracks
+		return s, ""
+	}
+	return s[0:colon], s[colon+1:]
+}
+
+// reset clears the via so it can be reused for s.  The Params slice
+// is kept (emptied) so its memory gets reused too.
+func (v *Via) reset(s string) {
+	p := v.Params[0:0]
+	*v = Via{Via: s, Params: p}
+}
+
+// Clone returns a deep copy of the via.  Use it to keep a via of a
+// msg that is going to be passed to Parser.Release.
+func (v *Via) Clone() *Via {
+	return v.clone()
+}
+
+// clone returns a deep copy of the via
+func (v *Via) clone() *Via {
+	if v == nil {
+		return nil
+	}
+	n := *v
+	n.Params = cloneParams(v.Params)
+	return &n
+}
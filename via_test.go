@@ -6,6 +6,8 @@ package sipparser
 
 // Imports from the go standard library
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -29,3 +31,82 @@ func TestVia(t *testing.T) {
 		t.Errorf("[TestVia] Error parsing via \"SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK05B1a4c756d527cb513\".  Sent by should be \"0.0.0.0:5060\" but received: " + sm.Via[0].SentBy + ".")
 	}
 }
+
+func TestViaString(t *testing.T) {
+	s := "SIP/2.0/UDP 0.0.0.0:5060;branch=z9hG4bK05B1a4c756d527cb513;received=1.1.1.1;rport"
+	v := &Via{Via: s}
+	v.parse()
+	if v.String() != s {
+		t.Errorf("[TestViaString] Error rendering via %q.  Received: %q", s, v.String())
+	}
+	v = &Via{Via: "SIP/2.0/TCP 0.0.0.0:5060"}
+	v.parse()
+	if v.SentBy != "0.0.0.0:5060" {
+		t.Errorf("[TestViaString] Via without params should have SentBy \"0.0.0.0:5060\" but received: %q", v.SentBy)
+	}
+}
+
+func TestViaMultiValue(t *testing.T) {
+	sm := &SipMsg{}
+	sm.parseVia(`SIP/2.0/UDP a.com;branch=1;foo="x,y", SIP/2.0/TCP [2001:db8::1]:5070;branch=2;maddr=224.2.0.1;ttl=16;alias`)
+	if sm.Error != nil {
+		t.Fatalf("[TestViaMultiValue] Error parsing via.  Received: %s", sm.Error.Error())
+	}
+	if len(sm.Via) != 2 {
+		t.Fatalf("[TestViaMultiValue] Expected 2 vias but received: %d", len(sm.Via))
+	}
+	if sm.Via[0].SentBy != "a.com" || sm.Via[0].Host != "a.com" || sm.Via[0].Port != "" || sm.Via[0].Branch != "1" {
+		t.Errorf("[TestViaMultiValue] First via was not parsed correctly.")
+	}
+	if len(sm.Via[0].Params) != 1 || sm.Via[0].Params[0].Val != `"x,y"` {
+		t.Errorf("[TestViaMultiValue] A comma in a quoted param should not split the via.")
+	}
+	v := sm.Via[1]
+	if v.Transport != "TCP" || v.SentBy != "[2001:db8::1]:5070" || v.Host != "[2001:db8::1]" || v.Port != "5070" || v.Branch != "2" {
+		t.Errorf("[TestViaMultiValue] Second via was not parsed correctly.")
+	}
+	if v.Maddr != "224.2.0.1" || v.TTL != "16" || !v.Alias || len(v.Params) != 0 {
+		t.Errorf("[TestViaMultiValue] Maddr, ttl and alias were not parsed correctly.")
+	}
+	if v.String() != "SIP/2.0/TCP [2001:db8::1]:5070;branch=2;maddr=224.2.0.1;ttl=16;alias" {
+		t.Errorf("[TestViaMultiValue] Unexpected via.  Received: %q", v.String())
+	}
+	sm = &SipMsg{}
+	sm.parseVia("SIP/2.0/UDP 10.0.0.1:5060;branch=1, garbage")
+	if sm.Error == nil || len(sm.Via) != 2 || sm.Via[0].Host != "10.0.0.1" || sm.Via[0].Port != "5060" {
+		t.Errorf("[TestViaMultiValue] A bad via-parm should be an error without losing the good one.")
+	}
+	if sm.Via[1].Error == nil || sm.Via[1].String() != "garbage" {
+		t.Errorf("[TestViaMultiValue] A bad via-parm should be kept with its error and render as received.")
+	}
+	for _, bad := range []string{"host:abc", "host:0", "host:65536", "[::1]:5x"} {
+		sm = &SipMsg{}
+		sm.parseVia("SIP/2.0/UDP " + bad + ";branch=1")
+		if !errors.Is(sm.Error, ErrBadVia) {
+			t.Errorf("[TestViaMultiValue] A sent-by of %q should be an error.", bad)
+		}
+	}
+	m := "OPTIONS sip:bob@biloxi.com SIP/2.0\r\nVia: SIP/2.0/UDP host:abc;branch=z9hG4bK1\r\nContent-Length: 0\r\n\r\n"
+	strict := false
+	for _, e := range ParseMsgWithOptions(m, ParseOptions{Strict: true}).Errors {
+		strict = strict || e.Rule == "sent-by"
+	}
+	if !strict {
+		t.Errorf("[TestViaMultiValue] A bad sent-by port should fail the sent-by rule in strict mode.")
+	}
+	if str := ParseMsg(m).String(); !strings.Contains(str, "\r\nVia: SIP/2.0/UDP host:abc;branch=z9hG4bK1\r\n") {
+		t.Errorf("[TestViaMultiValue] A bad via should not be dropped when the msg is rendered.  Received: %q", str)
+	}
+	sm = &SipMsg{}
+	sm.parseVia(" , ")
+	if sm.Error == nil {
+		t.Errorf("[TestViaMultiValue] A via hdr without a via-parm should be an error.")
+	}
+	msg := ParseMsg("SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP a;branch=1, SIP/2.0/TCP b;branch=2\r\nVia: SIP/2.0/UDP c;branch=3\r\nContent-Length: 0\r\n\r\n")
+	if msg.Error != nil || len(msg.Via) != 3 || msg.Via[2].Host != "c" {
+		t.Fatalf("[TestViaMultiValue] Msg with a multi-value via was not parsed correctly.")
+	}
+	if ParseMsg(msg.String()).Via[1].Host != "b" {
+		t.Errorf("[TestViaMultiValue] Multi-value via did not render correctly.  Received: %q", msg.String())
+	}
+}
@@ -6,7 +6,7 @@ package sipparser
 
 // Imports from the go standard library
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -20,10 +20,15 @@ type Warning struct {
 func (w *Warning) parse() error {
 	parts := strings.SplitN(w.Val, " ", 3)
 	if len(parts) != 3 {
-		return errors.New("Warning.parse err: split on LWS was not correct.")
+		return fmt.Errorf("%w: Warning.parse err: split on LWS was not correct.", ErrBadWarning)
 	}
 	w.Code = parts[0]
 	w.Agent = parts[1]
-	w.Text = strings.Replace(parts[2], "\"", "", -1)
+	w.Text = unquoteStr(trimLWS(parts[2]))
 	return nil
 }
+
+// String returns the warning as code agent "text"
+func (w *Warning) String() string {
+	return w.Code + " " + w.Agent + " " + quoteStr(w.Text)
+}